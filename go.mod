@@ -8,9 +8,13 @@ require (
 	github.com/dop251/goja_nodejs v0.0.0-20230821135201-94e508132562
 	github.com/google/go-cmp v0.5.9
 	github.com/google/gopacket v1.1.19
+	github.com/miekg/dns v1.1.55
 	github.com/ooni/netem v0.0.0-20230824211724-219d252971fc
+	github.com/ooni/oohttp v0.6.3
 	github.com/ooni/probe-engine v0.25.1-0.20230830064439-fcc06b12dd9a
+	github.com/pion/stun v0.6.1
 	github.com/quic-go/quic-go v0.33.0
+	gitlab.com/yawning/utls.git v0.0.12-1
 )
 
 require (
@@ -26,12 +30,13 @@ require (
 	github.com/google/martian/v3 v3.3.2 // indirect
 	github.com/google/pprof v0.0.0-20230602150820-91b7bce49751 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
-	github.com/miekg/dns v1.1.55 // indirect
 	github.com/onsi/ginkgo/v2 v2.10.0 // indirect
 	github.com/ooni/oocrypto v0.5.3 // indirect
-	github.com/ooni/oohttp v0.6.3 // indirect
 	github.com/ooni/probe-assets v0.18.0 // indirect
 	github.com/oschwald/maxminddb-golang v1.11.0 // indirect
+	github.com/pion/dtls/v2 v2.2.7 // indirect
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/pion/transport/v2 v2.2.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/prometheus/client_golang v1.16.0 // indirect
 	github.com/prometheus/client_model v0.4.0 // indirect
@@ -41,7 +46,6 @@ require (
 	github.com/quic-go/qtls-go1-19 v0.3.2 // indirect
 	github.com/quic-go/qtls-go1-20 v0.2.2 // indirect
 	gitlab.com/yawning/bsaes.git v0.0.0-20190805113838-0a714cd429ec // indirect
-	gitlab.com/yawning/utls.git v0.0.12-1 // indirect
 	golang.org/x/crypto v0.11.0 // indirect
 	golang.org/x/exp v0.0.0-20230522175609-2e198f4a06a1 // indirect
 	golang.org/x/mod v0.11.0 // indirect
@@ -27,6 +27,16 @@ exports.compose = function (...args) {
     return composeN(args[0], args.slice(1))
 }
 
+exports.deadline = function (timeout, stage) {
+    return {
+        "stage_name": "deadline",
+        "arguments": {
+            "timeout": timeout,
+        },
+        "children": [stage]
+    }
+}
+
 exports.discard = function () {
     return {
         "stage_name": "discard",
@@ -53,19 +63,96 @@ exports.domainName = function (domain) {
     }
 }
 
-exports.httpConnectionTls = function () {
+exports.filterDnsLookupResult = function (options) {
     return {
-        "stage_name": "http_connection_tls",
+        "stage_name": "filter_dns_lookup_result",
+        "arguments": _filterArguments(options),
+        "children": []
+    }
+}
+
+exports.filterEndpoints = function (options) {
+    return {
+        "stage_name": "filter_endpoints",
+        "arguments": _filterArguments(options),
+        "children": []
+    }
+}
+
+function _filterArguments(options) {
+    return {
+        "bogons": (options || {})["bogons"] || "",
+        "family": (options || {})["family"] || "",
+        "max": (options || {})["max"] || 0,
+        "random": (options || {})["random"] || false,
+        "seed": (options || {})["seed"] || 0,
+    }
+}
+
+exports.firstSuccess = function (...stages) {
+    if (stages.length < 1) {
+        throw "firstSuccess called with zero stages"
+    }
+    return {
+        "stage_name": "first_success",
         "arguments": {},
+        "children": stages
+    }
+}
+
+exports.happyEyeballs = function (stage, delay) {
+    return {
+        "stage_name": "happy_eyeballs",
+        "arguments": {
+            "delay": delay || 0,
+        },
+        "children": [stage]
+    }
+}
+
+exports.httpConnectionTls = function (options) {
+    return {
+        "stage_name": "http_connection_tls",
+        "arguments": {
+            "protocol": (options || {})["protocol"] || "",
+        },
         "children": []
     }
 }
 
 exports.httpTransaction = function (options) {
-    // TODO(bassosimone): implement all the options
     return {
         "stage_name": "http_transaction",
-        "arguments": {},
+        "arguments": {
+            "accept_header": (options || {})["accept_header"] || "",
+            "accept_language_header": (options || {})["accept_language_header"] || "",
+            "headers": (options || {})["headers"] || [],
+            "host_header": (options || {})["host_header"] || "",
+            "include_response_body_snapshot": (options || {})["include_response_body_snapshot"] || false,
+            "referer_header": (options || {})["referer_header"] || "",
+            "request_body_base64": (options || {})["request_body_base64"] || "",
+            "request_body_text": (options || {})["request_body_text"] || "",
+            "request_method": (options || {})["request_method"] || "",
+            "response_body_snapshot_size": (options || {})["response_body_snapshot_size"] || 0,
+            "timeout": (options || {})["timeout"] || 0,
+            "url_host": (options || {})["url_host"] || "",
+            "url_path": (options || {})["url_path"] || "",
+            "url_raw_query": (options || {})["url_raw_query"] || "",
+            "url_scheme": (options || {})["url_scheme"] || "",
+            "user_agent_header": (options || {})["user_agent_header"] || "",
+        },
+        "children": []
+    }
+}
+
+exports.httpTransactionSequence = function (requests) {
+    return {
+        "stage_name": "http_transaction_sequence",
+        "arguments": {
+            "requests": (requests || []).map(function (options) {
+                return exports.httpTransaction(options)["arguments"]
+            }),
+        },
         "children": []
     }
 }
@@ -91,35 +178,170 @@ exports.newEndpoint = function (address, options) {
     }
 }
 
-exports.newEndpointPipeline = function (stage) {
+exports.newEndpointPipeline = function (stage, options) {
     return {
         "stage_name": "new_endpoint_pipeline",
-        "arguments": {},
+        "arguments": {
+            "parallelism": (options || {})["parallelism"] || 0,
+        },
         "children": [stage]
     }
 }
 
-exports.run = function (ast, zeroTime) {
-    return _ooni.runDSL(ast, zeroTime)
+exports.quicHandshake = function (options) {
+    return {
+        "stage_name": "quic_handshake",
+        "arguments": {
+            "alpn": (options || {})["alpn"] || [],
+            "cipher_suites": (options || {})["cipher_suites"] || [],
+            "client_hello_id": (options || {})["client_hello_id"] || "",
+            "curves": (options || {})["curves"] || [],
+            "handshake_idle_timeout": (options || {})["handshake_idle_timeout"] || 0,
+            "initial_packet_size": (options || {})["initial_packet_size"] || 0,
+            "max_idle_timeout": (options || {})["max_idle_timeout"] || 0,
+            "max_version": (options || {})["max_version"] || "",
+            "min_version": (options || {})["min_version"] || "",
+            "skip_verify": (options || {})["skip_verify"] || false,
+            "sni": (options || {})["sni"] || "",
+            "spki_pins": (options || {})["spki_pins"] || [],
+            "tags": (options || {})["tags"] || [],
+            "timeout": (options || {})["timeout"] || 0,
+            "verify_name": (options || {})["verify_name"] || "",
+            "versions": (options || {})["versions"] || [],
+            "x509_certs": (options || {})["x509_certs"] || [],
+        },
+        "children": []
+    }
+}
+
+exports.retry = function (stage, attempts, backoff) {
+    return {
+        "stage_name": "retry",
+        "arguments": {
+            "attempts": attempts,
+            "backoff": backoff || 0,
+        },
+        "children": [stage]
+    }
+}
+
+exports.run = function (ast, zeroTime, options) {
+    return _ooni.runDSL(ast, zeroTime, {
+        "concurrency_budget": (options || {})["concurrency_budget"] || 0,
+        "timeout": (options || {})["timeout"] || 0,
+    })
+}
+
+exports.stunBindingRequest = function (options) {
+    return {
+        "stage_name": "stun_binding_request",
+        "arguments": {
+            "tags": (options || {})["tags"] || [],
+            "timeout": (options || {})["timeout"] || 0,
+        },
+        "children": []
+    }
 }
 
-exports.tcpConnect = function () {
+exports.tcpConnect = function (options) {
     return {
         "stage_name": "tcp_connect",
-        "arguments": {},
+        "arguments": {
+            "timeout": (options || {})["timeout"] || 0,
+        },
+        "children": []
+    }
+}
+
+exports.tcpExchange = function (options) {
+    return {
+        "stage_name": "tcp_exchange",
+        "arguments": _exchangeArguments(options),
+        "children": []
+    }
+}
+
+exports.tlsExchange = function (options) {
+    return {
+        "stage_name": "tls_exchange",
+        "arguments": _exchangeArguments(options),
         "children": []
     }
 }
 
+function _exchangeArguments(options) {
+    return {
+        "delimiter_base64": (options || {})["delimiter_base64"] || "",
+        "delimiter_text": (options || {})["delimiter_text"] || "",
+        "max_bytes": (options || {})["max_bytes"] || 0,
+        "payload_base64": (options || {})["payload_base64"] || "",
+        "payload_text": (options || {})["payload_text"] || "",
+        "timeout": (options || {})["timeout"] || 0,
+    }
+}
+
 exports.tlsHandshake = function (options) {
     return {
         "stage_name": "tls_handshake",
         "arguments": {
             "alpn": (options || {})["alpn"] || [],
+            "cipher_suites": (options || {})["cipher_suites"] || [],
+            "client_hello_id": (options || {})["client_hello_id"] || "",
+            "client_hello_record_splits": (options || {})["client_hello_record_splits"] || [],
+            "client_hello_segment_splits": (options || {})["client_hello_segment_splits"] || [],
+            "client_hello_splits_sni": (options || {})["client_hello_splits_sni"] || false,
+            "curves": (options || {})["curves"] || [],
+            "max_version": (options || {})["max_version"] || "",
+            "min_version": (options || {})["min_version"] || "",
             "skip_verify": (options || {})["skip_verify"] || false,
             "sni": (options || {})["sni"] || "",
+            "spki_pins": (options || {})["spki_pins"] || [],
+            "timeout": (options || {})["timeout"] || 0,
             "x509_certs": (options || {})["x509_certs"] || [],
         },
         "children": []
     }
 }
+
+exports.udpExchange = function (options) {
+    return {
+        "stage_name": "udp_exchange",
+        "arguments": {
+            "payload_base64": (options || {})["payload_base64"] || "",
+            "payload_text": (options || {})["payload_text"] || "",
+            "tags": (options || {})["tags"] || [],
+            "timeout": (options || {})["timeout"] || 0,
+        },
+        "children": []
+    }
+}
+
+exports.webSocketExchange = function (options) {
+    return {
+        "stage_name": "websocket_exchange",
+        "arguments": _webSocketExchangeArguments(options),
+        "children": []
+    }
+}
+
+exports.webSocketExchangeTls = function (options) {
+    return {
+        "stage_name": "websocket_exchange_tls",
+        "arguments": _webSocketExchangeArguments(options),
+        "children": []
+    }
+}
+
+function _webSocketExchangeArguments(options) {
+    return {
+        "host_header": (options || {})["host_header"] || "",
+        "max_frames": (options || {})["max_frames"] || 0,
+        "messages": (options || {})["messages"] || [],
+        "origin_header": (options || {})["origin_header"] || "",
+        "subprotocols": (options || {})["subprotocols"] || [],
+        "timeout": (options || {})["timeout"] || 0,
+        "url_path": (options || {})["url_path"] || "",
+        "url_raw_query": (options || {})["url_raw_query"] || "",
+        "user_agent_header": (options || {})["user_agent_header"] || "",
+    }
+}
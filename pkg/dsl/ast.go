@@ -61,24 +61,48 @@ func NewASTLoader() *ASTLoader {
 	// compose.go
 	al.RegisterCustomLoaderRule(&composeLoader{})
 
+	// deadline.go
+	al.RegisterCustomLoaderRule(&deadlineLoader{})
+
 	// discard.go
 	al.RegisterCustomLoaderRule(&discardLoader{})
 
 	// dnsdomain.go
 	al.RegisterCustomLoaderRule(&domainNameLoader{})
 
+	// dnsdoh.go
+	al.RegisterCustomLoaderRule(&dnsLookupDoHLoader{})
+
+	// dnsdot.go
+	al.RegisterCustomLoaderRule(&dnsLookupDoTLoader{})
+
+	// dnsfilter.go
+	al.RegisterCustomLoaderRule(&filterDNSLookupResultLoader{})
+
 	// dnsgetaddrinfo.go
 	al.RegisterCustomLoaderRule(&dnsLookupGetaddrinfoLoader{})
 
 	// dnsparallel.go
 	al.RegisterCustomLoaderRule(&dnsLookupParallelLoader{})
 
+	// dnsquery.go
+	al.RegisterCustomLoaderRule(&dnsLookupQueryLoader{})
+
 	// dnsstatic.go
 	al.RegisterCustomLoaderRule(&dnsLookupStaticLoader{})
 
+	// dnstcp.go
+	al.RegisterCustomLoaderRule(&dnsLookupTCPLoader{})
+
 	// dnsudp.go
 	al.RegisterCustomLoaderRule(&dnsLookupUDPLoader{})
 
+	// endpointalpn.go
+	al.RegisterCustomLoaderRule(&filterEndpointsByALPNLoader{})
+
+	// endpointfilter.go
+	al.RegisterCustomLoaderRule(&filterEndpointsLoader{})
+
 	// endpointmake.go
 	al.RegisterCustomLoaderRule(&makeEndpointForPortLoader{})
 
@@ -94,12 +118,24 @@ func NewASTLoader() *ASTLoader {
 	// filter.go
 	al.RegisterCustomLoaderRule(&ifFilterExistsLoader{})
 
+	// firstsuccess.go
+	al.RegisterCustomLoaderRule(&firstSuccessLoader{})
+
+	// happyeyeballs.go
+	al.RegisterCustomLoaderRule(&happyEyeballsLoader{})
+
 	// httpcore.go
 	al.RegisterCustomLoaderRule(&httpTransactionLoader{})
 
 	// httpquic.go
 	al.RegisterCustomLoaderRule(&httpConnectionQUICLoader{})
 
+	// httpredirect.go
+	al.RegisterCustomLoaderRule(&httpFollowRedirectsLoader{})
+
+	// httpsequence.go
+	al.RegisterCustomLoaderRule(&httpTransactionSequenceLoader{})
+
 	// httptcp.go
 	al.RegisterCustomLoaderRule(&httpConnectionTCPLoader{})
 
@@ -118,12 +154,29 @@ func NewASTLoader() *ASTLoader {
 	// quichandshake.go
 	al.RegisterCustomLoaderRule(&quicHandshakeLoader{})
 
+	// retry.go
+	al.RegisterCustomLoaderRule(&retryLoader{})
+
+	// stun.go
+	al.RegisterCustomLoaderRule(&stunBindingRequestLoader{})
+
 	// tcpconnect.go
 	al.RegisterCustomLoaderRule(&tcpConnectLoader{})
 
+	// tcpexchange.go
+	al.RegisterCustomLoaderRule(&tcpExchangeLoader{})
+	al.RegisterCustomLoaderRule(&tlsExchangeLoader{})
+
 	// tlshandshake.go
 	al.RegisterCustomLoaderRule(&tlsHandshakeLoader{})
 
+	// udpexchange.go
+	al.RegisterCustomLoaderRule(&udpExchangeLoader{})
+
+	// websocket.go
+	al.RegisterCustomLoaderRule(&webSocketExchangeLoader{})
+	al.RegisterCustomLoaderRule(&webSocketExchangeTLSLoader{})
+
 	return al
 }
 
@@ -0,0 +1,203 @@
+package dsl
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// clientHelloSplitterConn is a [net.Conn] that splits the first write, which contains
+// the ClientHello, into several TLS records and/or several TCP segments.
+//
+// We first split the payload of the TLS record at the record splits offsets and then
+// we write each chunk of the resulting bytes, delimited by the segment splits offsets,
+// using a distinct write. Because Go disables Nagle's algorithm by default, each write
+// usually becomes a distinct TCP segment. We ignore offsets out of range.
+//
+// When relativeToSNI is true, the offsets are relative to the first byte of the server
+// name inside the server_name extension and we do not split a ClientHello without SNI.
+//
+// This type assumes that the TLS handshaker does not write concurrently, which is the
+// case while handshaking, and does not change any write after the first one.
+type clientHelloSplitterConn struct {
+	net.Conn
+	recordSplits  []int
+	relativeToSNI bool
+	segmentSplits []int
+	done          bool
+}
+
+// newClientHelloSplitterConn wraps the given conn to split the ClientHello unless there
+// are no splits, in which case it returns the original conn.
+func newClientHelloSplitterConn(conn net.Conn, recordSplits, segmentSplits []int, relativeToSNI bool) net.Conn {
+	if len(recordSplits) <= 0 && len(segmentSplits) <= 0 {
+		return conn
+	}
+	return &clientHelloSplitterConn{
+		Conn:          conn,
+		recordSplits:  recordSplits,
+		relativeToSNI: relativeToSNI,
+		segmentSplits: segmentSplits,
+		done:          false,
+	}
+}
+
+// Write implements net.Conn.
+func (c *clientHelloSplitterConn) Write(data []byte) (int, error) {
+	if c.done {
+		return c.Conn.Write(data)
+	}
+	c.done = true
+	recordSplits, segmentSplits := c.recordSplits, c.segmentSplits
+	if c.relativeToSNI {
+		recordSplits, segmentSplits = clientHelloSNIRelativeSplits(data, recordSplits, segmentSplits)
+	}
+	output := clientHelloSplitRecord(data, recordSplits)
+	for _, segment := range splitAtOffsets(output, segmentSplits) {
+		if _, err := c.Conn.Write(segment); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// clientHelloSNIRelativeSplits converts offsets relative to the first byte of the server
+// name to the offsets expected by [clientHelloSplitRecord] and [splitAtOffsets]. Because
+// the segment offsets are relative to the bytes we send, we account for the headers of the
+// records preceding the server name. If data does not contain exactly one TLS handshake
+// record containing a ClientHello with SNI, this function returns nil offsets.
+func clientHelloSNIRelativeSplits(data []byte, recordSplits, segmentSplits []int) ([]int, []int) {
+	if !clientHelloIsSingleRecord(data) {
+		return nil, nil
+	}
+	sni := clientHelloFindSNI(data[clientHelloRecordHeaderSize:])
+	if sni < 0 {
+		return nil, nil
+	}
+	recordSplits = shiftOffsets(recordSplits, sni)
+	headers := 1
+	for _, offset := range recordSplits {
+		if offset > 0 && offset <= sni {
+			headers++
+		}
+	}
+	segmentSplits = shiftOffsets(segmentSplits, sni+headers*clientHelloRecordHeaderSize)
+	return recordSplits, segmentSplits
+}
+
+// shiftOffsets returns a copy of the given offsets shifted by delta.
+func shiftOffsets(offsets []int, delta int) (out []int) {
+	for _, offset := range offsets {
+		out = append(out, offset+delta)
+	}
+	return
+}
+
+// clientHelloRecordHeaderSize is the size of the TLS record header.
+const clientHelloRecordHeaderSize = 5
+
+// clientHelloRecordTypeHandshake is the TLS record type of handshake messages.
+const clientHelloRecordTypeHandshake = 22
+
+// clientHelloSplitRecord splits the payload of the TLS handshake record contained by data at the
+// given offsets and returns the resulting TLS records. If data does not contain exactly one TLS
+// handshake record, this function returns data unmodified.
+func clientHelloSplitRecord(data []byte, offsets []int) []byte {
+	if len(offsets) <= 0 || !clientHelloIsSingleRecord(data) {
+		return data
+	}
+	header, payload := data[:clientHelloRecordHeaderSize], data[clientHelloRecordHeaderSize:]
+	var output []byte
+	for _, fragment := range splitAtOffsets(payload, offsets) {
+		output = append(output, header[:3]...)
+		output = binary.BigEndian.AppendUint16(output, uint16(len(fragment)))
+		output = append(output, fragment...)
+	}
+	return output
+}
+
+// clientHelloIsSingleRecord returns whether data contains exactly one TLS handshake record.
+func clientHelloIsSingleRecord(data []byte) bool {
+	return len(data) >= clientHelloRecordHeaderSize && data[0] == clientHelloRecordTypeHandshake &&
+		int(binary.BigEndian.Uint16(data[3:clientHelloRecordHeaderSize])) == len(data)-clientHelloRecordHeaderSize
+}
+
+// clientHelloFindSNI returns the offset of the first byte of the server name inside the
+// given ClientHello message or -1 if the message is not a ClientHello or lacks the SNI.
+func clientHelloFindSNI(msg []byte) int {
+	reader := &clientHelloReader{data: msg}
+	if reader.uint(1) != clientHelloMessageType {
+		return -1
+	}
+	reader.skip(3 + 2 + 32)     // length, legacy_version, and random
+	reader.skip(reader.uint(1)) // legacy_session_id
+	reader.skip(reader.uint(2)) // cipher_suites
+	reader.skip(reader.uint(1)) // legacy_compression_methods
+	extensionsSize := reader.uint(2)
+	end := reader.off + extensionsSize
+	for !reader.failed && reader.off+4 <= end {
+		kind, size := reader.uint(2), reader.uint(2)
+		if kind != clientHelloExtensionServerName {
+			reader.skip(size)
+			continue
+		}
+		reader.skip(2) // server_name_list length
+		if reader.uint(1) != clientHelloServerNameTypeHostName || reader.uint(2) <= 0 || reader.failed {
+			return -1
+		}
+		return reader.off
+	}
+	return -1
+}
+
+// clientHelloMessageType is the handshake message type of the ClientHello.
+const clientHelloMessageType = 1
+
+// clientHelloExtensionServerName is the type of the server_name extension.
+const clientHelloExtensionServerName = 0
+
+// clientHelloServerNameTypeHostName is the host_name server name type.
+const clientHelloServerNameTypeHostName = 0
+
+// clientHelloReader reads big-endian integers from a ClientHello and remembers
+// whether it failed because we tried to read past the end of the data.
+type clientHelloReader struct {
+	data   []byte
+	failed bool
+	off    int
+}
+
+// uint reads a big-endian integer using the given number of bytes.
+func (r *clientHelloReader) uint(size int) (value int) {
+	if r.failed || r.off+size > len(r.data) {
+		r.failed = true
+		return -1
+	}
+	for _, b := range r.data[r.off : r.off+size] {
+		value = value<<8 | int(b)
+	}
+	r.off += size
+	return value
+}
+
+// skip skips the given number of bytes.
+func (r *clientHelloReader) skip(size int) {
+	if r.failed || size < 0 || r.off+size > len(r.data) {
+		r.failed = true
+		return
+	}
+	r.off += size
+}
+
+// splitAtOffsets splits data at the given strictly increasing offsets, ignoring the
+// offsets that would produce empty chunks.
+func splitAtOffsets(data []byte, offsets []int) (chunks [][]byte) {
+	var start int
+	for _, offset := range offsets {
+		if offset <= start || offset >= len(data) {
+			continue
+		}
+		chunks = append(chunks, data[start:offset])
+		start = offset
+	}
+	return append(chunks, data[start:])
+}
@@ -0,0 +1,191 @@
+package dsl
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// clientHelloSplitterRecorderConn is a net.Conn recording each write.
+type clientHelloSplitterRecorderConn struct {
+	net.Conn
+	writes [][]byte
+}
+
+// Write implements net.Conn.
+func (c *clientHelloSplitterRecorderConn) Write(data []byte) (int, error) {
+	c.writes = append(c.writes, append([]byte{}, data...))
+	return len(data), nil
+}
+
+func TestClientHelloSplitterConn(t *testing.T) {
+	// record is a fake TLS handshake record with a 6 bytes payload
+	record := []byte{22, 3, 1, 0, 6, 'a', 'b', 'c', 'd', 'e', 'f'}
+
+	var testcases = []struct {
+		name          string
+		data          []byte
+		recordSplits  []int
+		segmentSplits []int
+		expect        [][]byte
+	}{{
+		name:          "with segment splits",
+		data:          record,
+		recordSplits:  []int{},
+		segmentSplits: []int{2, 7},
+		expect: [][]byte{
+			{22, 3},
+			{1, 0, 6, 'a', 'b'},
+			{'c', 'd', 'e', 'f'},
+		},
+	}, {
+		name:          "with record splits",
+		data:          record,
+		recordSplits:  []int{1, 4},
+		segmentSplits: []int{},
+		expect: [][]byte{{
+			22, 3, 1, 0, 1, 'a',
+			22, 3, 1, 0, 3, 'b', 'c', 'd',
+			22, 3, 1, 0, 2, 'e', 'f',
+		}},
+	}, {
+		name:          "with record and segment splits",
+		data:          record,
+		recordSplits:  []int{3},
+		segmentSplits: []int{8},
+		expect: [][]byte{
+			{22, 3, 1, 0, 3, 'a', 'b', 'c'},
+			{22, 3, 1, 0, 3, 'd', 'e', 'f'},
+		},
+	}, {
+		name:          "with offsets out of range",
+		data:          record,
+		recordSplits:  []int{6, 100},
+		segmentSplits: []int{0, 11},
+		expect:        [][]byte{record},
+	}, {
+		name:          "with data that is not a TLS handshake record",
+		data:          []byte("GET / HTTP/1.1\r\n"),
+		recordSplits:  []int{4},
+		segmentSplits: []int{},
+		expect:        [][]byte{[]byte("GET / HTTP/1.1\r\n")},
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &clientHelloSplitterRecorderConn{}
+			conn := newClientHelloSplitterConn(recorder, tc.recordSplits, tc.segmentSplits, false)
+
+			// the first write should be split
+			count, err := conn.Write(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(tc.data) {
+				t.Fatal("unexpected count", count)
+			}
+			if diff := cmp.Diff(tc.expect, recorder.writes); diff != "" {
+				t.Fatal(diff)
+			}
+
+			// the second write should not be split
+			recorder.writes = nil
+			if _, err := conn.Write(tc.data); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([][]byte{tc.data}, recorder.writes); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("without any split we return the original conn", func(t *testing.T) {
+		recorder := &clientHelloSplitterRecorderConn{}
+		if conn := newClientHelloSplitterConn(recorder, nil, nil, false); conn != recorder {
+			t.Fatal("expected the original conn")
+		}
+	})
+}
+
+// clientHelloSplitterEOFConn is a clientHelloSplitterRecorderConn whose Read returns io.EOF.
+type clientHelloSplitterEOFConn struct {
+	clientHelloSplitterRecorderConn
+}
+
+// Read implements net.Conn.
+func (c *clientHelloSplitterEOFConn) Read(data []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// clientHelloSplitterHandshake performs a TLS handshake using SNI and writing into a
+// conn returned by the factory and returns the bytes written by the client.
+func clientHelloSplitterHandshake(sni string, factory func(net.Conn) net.Conn) [][]byte {
+	recorder := &clientHelloSplitterEOFConn{}
+	config := &tls.Config{ServerName: sni, InsecureSkipVerify: true}
+	_ = tls.Client(factory(recorder), config).Handshake() // fails because of io.EOF
+	return recorder.writes
+}
+
+func TestClientHelloSplitterConnRelativeToSNI(t *testing.T) {
+	const sni = "www.example.com"
+
+	// obtain a real ClientHello and find the SNI
+	writes := clientHelloSplitterHandshake(sni, func(conn net.Conn) net.Conn { return conn })
+	if len(writes) != 1 {
+		t.Fatal("expected a single write", len(writes))
+	}
+	clientHello := writes[0]
+	sniOffset := clientHelloFindSNI(clientHello[clientHelloRecordHeaderSize:])
+	if sniOffset < 0 {
+		t.Fatal("cannot find the SNI")
+	}
+	if name := clientHello[clientHelloRecordHeaderSize+sniOffset:][:len(sni)]; string(name) != sni {
+		t.Fatal("unexpected SNI", string(name))
+	}
+
+	t.Run("we split the segments inside the SNI", func(t *testing.T) {
+		writes := clientHelloSplitterHandshake(sni, func(conn net.Conn) net.Conn {
+			return newClientHelloSplitterConn(conn, nil, []int{-1, 3}, true)
+		})
+		if len(writes) != 3 {
+			t.Fatal("expected three writes", len(writes))
+		}
+		if !bytes.HasSuffix(writes[1], []byte{byte(len(sni)), 'w', 'w', 'w'}) {
+			t.Fatal("unexpected second write", writes[1])
+		}
+		if !bytes.HasPrefix(writes[2], []byte(".example.com")) {
+			t.Fatal("unexpected third write", writes[2])
+		}
+	})
+
+	t.Run("we split the records inside the SNI", func(t *testing.T) {
+		writes := clientHelloSplitterHandshake(sni, func(conn net.Conn) net.Conn {
+			return newClientHelloSplitterConn(conn, []int{4}, []int{4}, true)
+		})
+		if len(writes) != 2 {
+			t.Fatal("expected two writes", len(writes))
+		}
+		// note that the random and the key shares change with each handshake
+		first, second := writes[0], writes[1]
+		if len(first) != clientHelloRecordHeaderSize+sniOffset+4 || !bytes.HasSuffix(first, []byte("www.")) {
+			t.Fatal("unexpected first record", first)
+		}
+		expectHeader := []byte{22, 3, 1, 0, byte(len(clientHello) - len(first))}
+		if !bytes.HasPrefix(second, append(expectHeader, []byte("example.com")...)) {
+			t.Fatal("unexpected second record", second)
+		}
+	})
+
+	t.Run("we do not split a ClientHello without SNI", func(t *testing.T) {
+		writes := clientHelloSplitterHandshake("", func(conn net.Conn) net.Conn {
+			return newClientHelloSplitterConn(conn, []int{4}, []int{4}, true)
+		})
+		if len(writes) != 1 {
+			t.Fatal("expected a single write", len(writes))
+		}
+	})
+}
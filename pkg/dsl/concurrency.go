@@ -0,0 +1,90 @@
+package dsl
+
+import "context"
+
+// ConcurrencyBudget is a semaphore limiting the number of workers that all the parallel
+// stages sharing the same [Runtime] run concurrently (see [ParallelRunWithConcurrencyBudget]).
+// A nil [*ConcurrencyBudget] is valid and means that there is no limit. The zero value of
+// this struct is invalid; please, use [NewConcurrencyBudget] to construct.
+//
+// Nested parallel stages do not deadlock because a worker that runs a nested parallel stage
+// gives back its slot while waiting for the nested workers and acquires it again later.
+type ConcurrencyBudget struct {
+	slots chan bool
+}
+
+// NewConcurrencyBudget creates a new [*ConcurrencyBudget] with the given number of slots. This
+// function returns nil, meaning that there is no limit, when size is zero or negative.
+func NewConcurrencyBudget(size int) *ConcurrencyBudget {
+	if size <= 0 {
+		return nil
+	}
+	return &ConcurrencyBudget{slots: make(chan bool, size)}
+}
+
+// Acquire blocks until there is a free slot or the context is done. This method returns
+// nil on success and the context error otherwise.
+func (cb *ConcurrencyBudget) Acquire(ctx context.Context) error {
+	if cb == nil {
+		return nil
+	}
+	select {
+	case cb.slots <- true:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release releases a slot previously acquired using [ConcurrencyBudget.Acquire].
+func (cb *ConcurrencyBudget) Release() {
+	if cb == nil {
+		return
+	}
+	<-cb.slots
+}
+
+// concurrencyBudgetSlot tracks whether a worker goroutine holds a slot of a budget.
+type concurrencyBudgetSlot struct {
+	cb   *ConcurrencyBudget
+	held bool
+}
+
+type concurrencyBudgetSlotKey struct{}
+
+// concurrencyBudgetSlotFromContext returns the slot held by the current worker (if any).
+func concurrencyBudgetSlotFromContext(ctx context.Context) *concurrencyBudgetSlot {
+	slot, _ := ctx.Value(concurrencyBudgetSlotKey{}).(*concurrencyBudgetSlot)
+	return slot
+}
+
+// concurrencyBudgetRun runs the given function holding a slot of the given budget.
+func concurrencyBudgetRun[T any](ctx context.Context, cb *ConcurrencyBudget, fx func(ctx context.Context) T) T {
+	slot := &concurrencyBudgetSlot{cb: cb}
+	if err := cb.Acquire(ctx); err == nil {
+		slot.held = true
+	}
+	// Note: when we cannot acquire a slot the context is done and we run the
+	// function anyway, so it fails and the caller observes the failure
+	output := fx(context.WithValue(ctx, concurrencyBudgetSlotKey{}, slot))
+	if slot.held {
+		cb.Release()
+	}
+	return output
+}
+
+// concurrencyBudgetLend gives back the slot held by the current worker (if any) while
+// running the given function, and acquires the slot again when the function returns.
+func concurrencyBudgetLend(ctx context.Context, cb *ConcurrencyBudget, fx func()) {
+	slot := concurrencyBudgetSlotFromContext(ctx)
+	if slot == nil || slot.cb != cb || !slot.held {
+		fx()
+		return
+	}
+	cb.Release()
+	slot.held = false
+	fx()
+	if err := cb.Acquire(ctx); err == nil {
+		slot.held = true
+	}
+}
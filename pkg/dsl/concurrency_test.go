@@ -0,0 +1,70 @@
+package dsl
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// concurrencyCounterStage is a stage counting the maximum number of concurrent runs.
+type concurrencyCounterStage struct {
+	current int
+	max     int
+	mu      sync.Mutex
+}
+
+// ASTNode implements Stage.
+func (sx *concurrencyCounterStage) ASTNode() *SerializableASTNode {
+	panic("not implemented")
+}
+
+// Run implements Stage.
+func (sx *concurrencyCounterStage) Run(ctx context.Context, rtx Runtime, input Maybe[*Void]) Maybe[*Void] {
+	sx.mu.Lock()
+	sx.current++
+	if sx.current > sx.max {
+		sx.max = sx.current
+	}
+	sx.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	sx.mu.Lock()
+	sx.current--
+	sx.mu.Unlock()
+	return input
+}
+
+func TestConcurrencyBudget(t *testing.T) {
+	for _, size := range []int{1, 2, 3} {
+		// create nested parallel stages with more parallelism than the budget
+		counter := &concurrencyCounterStage{}
+		newInner := func() Stage[*Void, *Void] {
+			return RunStagesInParallelWithParallelism(4, counter, counter, counter, counter)
+		}
+		pipeline := RunStagesInParallelWithParallelism(4, newInner(), newInner(), newInner(), newInner())
+
+		// run the stages making sure we do not deadlock
+		rtx := NewMinimalRuntime(log.Log, RuntimeOptionConcurrencyBudget(size))
+		done := make(chan Maybe[*Void])
+		go func() {
+			done <- pipeline.Run(context.Background(), rtx, NewValue(&Void{}))
+		}()
+		select {
+		case results := <-done:
+			if results.Error != nil {
+				t.Fatal(results.Error)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("the nested parallel stages deadlocked with size", size)
+		}
+
+		// make sure we honoured the budget
+		if counter.max > size {
+			t.Fatal("expected at most", size, "concurrent runs but got", counter.max)
+		}
+	}
+}
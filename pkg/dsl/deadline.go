@@ -0,0 +1,74 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Deadline returns a stage that runs the given stage with the given timeout. Use this stage at
+// the top of an AST to bound the total runtime of a measurement. A zero or negative timeout means
+// that there is no deadline. When the timeout expires, the operations that are running fail with
+// a timeout error and the stages that did not start yet return an [ErrSkip] (see [IsErrSkip]) and
+// record their name in the SkippedStages field of the [Observations], unless their input is the
+// error of a previous stage, which they return unmodified. Because the operations
+// that ran before the timeout expired already saved their [Observations], you can still collect
+// such [Observations] from the [Runtime].
+func Deadline[A, B any](timeout time.Duration, stage Stage[A, B]) Stage[A, B] {
+	return &deadlineStage[A, B]{timeout, stage}
+}
+
+type deadlineStage[A, B any] struct {
+	timeout time.Duration
+	stage   Stage[A, B]
+}
+
+type deadlineArguments struct {
+	Timeout time.Duration `json:"timeout"`
+}
+
+const deadlineStageName = "deadline"
+
+// ASTNode implements Stage.
+func (sx *deadlineStage[A, B]) ASTNode() *SerializableASTNode {
+	return &SerializableASTNode{
+		StageName: deadlineStageName,
+		Arguments: &deadlineArguments{sx.timeout},
+		Children:  []*SerializableASTNode{sx.stage.ASTNode()},
+	}
+}
+
+type deadlineLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*deadlineLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var args deadlineArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 1); err != nil {
+		return nil, err
+	}
+	runnable, err := loader.Load(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	// Note: like composeStage, deadlineStage does not create any Maybe and so we can
+	// use `any` because the inner stage creates correctly-typed Maybes.
+	return Deadline[any, any](args.Timeout, runnable), nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*deadlineLoader) StageName() string {
+	return deadlineStageName
+}
+
+// Run implements Stage.
+func (sx *deadlineStage[A, B]) Run(ctx context.Context, rtx Runtime, input Maybe[A]) Maybe[B] {
+	if sx.timeout <= 0 {
+		return sx.stage.Run(ctx, rtx, input)
+	}
+	ctx, cancel := context.WithTimeout(ctx, sx.timeout)
+	defer cancel()
+	return sx.stage.Run(ctx, rtx, input)
+}
@@ -0,0 +1,148 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// deadlineSleepStage is a stage that sleeps for the given time.
+type deadlineSleepStage[T any] struct {
+	d time.Duration
+}
+
+// ASTNode implements Stage.
+func (sx *deadlineSleepStage[T]) ASTNode() *SerializableASTNode {
+	return (&Identity[T]{}).ASTNode()
+}
+
+// Run implements Stage.
+func (sx *deadlineSleepStage[T]) Run(ctx context.Context, rtx Runtime, input Maybe[T]) Maybe[T] {
+	time.Sleep(sx.d)
+	return input
+}
+
+func TestDeadline(t *testing.T) {
+	t.Run("we skip the stages that did not run before the deadline", func(t *testing.T) {
+		// create a pipeline where the deadline expires before the lookup
+		pipeline := Deadline(10*time.Millisecond, Compose3(
+			Stage[string, string](&deadlineSleepStage[string]{100 * time.Millisecond}),
+			DNSLookupStatic("130.192.91.211"),
+			MakeEndpointsForPort(443),
+		))
+
+		// run the pipeline
+		metrics := NewAccountingMetrics()
+		rtx := NewMeasurexliteRuntime(log.Log, metrics, &NullProgressMeter{}, time.Now())
+		results := pipeline.Run(context.Background(), rtx, NewValue("nexa.polito.it"))
+
+		// make sure we skipped the stage
+		if !IsErrSkip(results.Error) {
+			t.Fatal("not an ErrSkip", results.Error)
+		}
+		if value := metrics.Snapshot()["dns_lookup_static_skipped_count"]; value != 1 {
+			t.Fatal("unexpected skipped count", value)
+		}
+
+		// make sure the observations record the stages that did not run
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		expect := []string{"dns_lookup_static"}
+		if diff := cmp.Diff(expect, observations.SkippedStages); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we record the skipped stages that are not operations", func(t *testing.T) {
+		// create a pipeline where the deadline expires before measuring the endpoints
+		pipeline := Deadline(10*time.Millisecond, Compose(
+			Stage[*DNSLookupResult, *DNSLookupResult](&deadlineSleepStage[*DNSLookupResult]{100 * time.Millisecond}),
+			MeasureMultipleEndpoints(
+				Compose(MakeEndpointsForPort(443), NewEndpointPipeline(Compose(TCPConnect(), Discard[*TCPConnection]()))),
+			),
+		))
+
+		// run the pipeline
+		rtx := NewMinimalRuntime(log.Log)
+		lookup := &DNSLookupResult{Domain: "nexa.polito.it", Addresses: []string{"130.192.91.211"}}
+		results := pipeline.Run(context.Background(), rtx, NewValue(lookup))
+		if !IsErrSkip(results.Error) {
+			t.Fatal("not an ErrSkip", results.Error)
+		}
+
+		// make sure the observations record the stages that did not run
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		expect := []string{
+			"measure_multiple_endpoints",
+			"compose",
+			"make_endpoints_for_port",
+			"new_endpoint_pipeline",
+			"compose",
+			"tcp_connect",
+			"discard",
+		}
+		if diff := cmp.Diff(expect, observations.SkippedStages); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we return the error of a previous stage after the deadline", func(t *testing.T) {
+		// create a pipeline where the previous stage fails after the deadline
+		pipeline := Deadline(10*time.Millisecond, Compose(
+			Stage[*Endpoint, *Endpoint](&deadlineSleepStage[*Endpoint]{100 * time.Millisecond}),
+			Compose3(TCPConnect(), TLSHandshake(), HTTPConnectionTLS()),
+		))
+
+		// run the pipeline with an input simulating a TCP connect failure
+		rtx := NewMinimalRuntime(log.Log)
+		connectErr := &ErrTCPConnect{netxlite.NewTopLevelGenericErrWrapper(netxlite.ErrOODNSNoSuchHost)}
+		results := pipeline.Run(context.Background(), rtx, NewError[*Endpoint](connectErr))
+		if IsErrSkip(results.Error) || !IsErrTCPConnect(results.Error) {
+			t.Fatal("unexpected error", results.Error)
+		}
+
+		// make sure the observations do not record any skipped stage
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		if len(observations.SkippedStages) != 0 {
+			t.Fatal("unexpected skipped stages", observations.SkippedStages)
+		}
+	})
+
+	t.Run("a zero timeout means that there is no deadline", func(t *testing.T) {
+		// load an AST where the timeout is missing
+		rawAST := []byte(`{"stage_name":"deadline","arguments":{},"children":[` +
+			`{"stage_name":"dns_lookup_static","arguments":{"addresses":["130.192.91.211"]},"children":[]}]}`)
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run the pipeline
+		rtx := NewMinimalRuntime(log.Log)
+		results := runnable.Run(context.Background(), rtx, NewValue("nexa.polito.it").AsGeneric())
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+	})
+
+	t.Run("we run the stage when the deadline does not expire", func(t *testing.T) {
+		pipeline := Deadline(time.Minute, DNSLookupStatic("130.192.91.211"))
+
+		// serialize and load the pipeline
+		rawAST := runtimex.Try1(json.Marshal(pipeline.ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run the pipeline
+		rtx := NewMinimalRuntime(log.Log)
+		results := runnable.Run(context.Background(), rtx, NewValue("nexa.polito.it").AsGeneric())
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+	})
+}
@@ -50,5 +50,8 @@ func (sx *discardStage[T]) Run(ctx context.Context, rtx Runtime, input Maybe[T])
 	if input.Error != nil {
 		return NewError[*Void](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*Void](err)
+	}
 	return NewValue(&Void{})
 }
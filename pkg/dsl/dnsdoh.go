@@ -0,0 +1,131 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+)
+
+// DNSLookupDoHOption is an option for [DNSLookupDoH].
+type DNSLookupDoHOption func(operation *dnsLookupDoHOperation)
+
+// DNSLookupDoHOptionTags allows configuring tags to include into measurements
+// generated by the [DNSLookupDoH] pipeline stage.
+func DNSLookupDoHOptionTags(tags ...string) DNSLookupDoHOption {
+	return func(operation *dnsLookupDoHOperation) {
+		operation.Tags = append(operation.Tags, tags...)
+	}
+}
+
+// DNSLookupDoHOptionTimeout configures the timeout of the [DNSLookupDoH] pipeline
+// stage; the default is 4s.
+func DNSLookupDoHOptionTimeout(value time.Duration) DNSLookupDoHOption {
+	return func(operation *dnsLookupDoHOperation) {
+		operation.Timeout = value
+	}
+}
+
+// DNSLookupDoH returns a stage that performs a DNS lookup using the given DNS-over-HTTPS
+// resolver URL (e.g., "https://dns.google/dns-query").
+//
+// This function returns an [ErrDNSLookup] if the error is a DNS lookup error. Remember to
+// use the [IsErrDNSLookup] predicate when setting an experiment test keys.
+func DNSLookupDoH(URL string, options ...DNSLookupDoHOption) Stage[string, *DNSLookupResult] {
+	operation := &dnsLookupDoHOperation{
+		URL:  URL,
+		Tags: []string{},
+	}
+	for _, option := range options {
+		option(operation)
+	}
+	return wrapOperation[string, *DNSLookupResult](operation)
+}
+
+type dnsLookupDoHOperation struct {
+	URL     string        `json:"url"`
+	Tags    []string      `json:"tags,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+const dnsLookupDoHStageName = "dns_lookup_doh"
+
+// ASTNode implements operation.
+func (sx *dnsLookupDoHOperation) ASTNode() *SerializableASTNode {
+	// Note: we serialize the structure because this gives us forward compatibility (i.e., we
+	// may add a field to a future version without breaking the AST structure and old probes will
+	// be fine as long as the zero value of the new field is the default)
+	return &SerializableASTNode{
+		StageName: dnsLookupDoHStageName,
+		Arguments: sx,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type dnsLookupDoHLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*dnsLookupDoHLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var op dnsLookupDoHOperation
+	if err := json.Unmarshal(node.Arguments, &op); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := wrapOperation[string, *DNSLookupResult](&op)
+	return &StageRunnableASTNode[string, *DNSLookupResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*dnsLookupDoHLoader) StageName() string {
+	return dnsLookupDoHStageName
+}
+
+// Run implements operation.
+func (sx *dnsLookupDoHOperation) Run(ctx context.Context, rtx Runtime, domain string) (*DNSLookupResult, error) {
+	// make sure the resolver URL is valid
+	if !ValidDoHURLs(sx.URL) {
+		return nil, &ErrException{&ErrInvalidURL{sx.URL}}
+	}
+
+	// create trace
+	trace := rtx.NewTrace(sx.Tags...)
+
+	// start the operation logger
+	ol := measurexlite.NewOperationLogger(
+		rtx.Logger(),
+		"[#%d] DNSLookupDoH url=%s domain=%s",
+		trace.Index(),
+		sx.URL,
+		domain,
+	)
+
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(sx.Timeout, defaultDNSLookupTimeout))
+	defer cancel()
+
+	// instantiate resolver
+	resolver := trace.NewParallelDNSOverHTTPSResolver(sx.URL)
+	defer resolver.CloseIdleConnections()
+
+	// do the lookup
+	addrs, err := resolver.LookupHost(ctx, domain)
+
+	// stop the operation logger
+	ol.Stop(err)
+
+	// save observations
+	rtx.SaveObservations(trace.ExtractObservations()...)
+
+	// handle the error case
+	if err != nil {
+		rtx.Metrics().Error(dnsLookupDoHStageName)
+		return nil, &ErrDNSLookup{err}
+	}
+
+	// handle the successful case
+	rtx.Metrics().Success(dnsLookupDoHStageName)
+	return newDNSLookupResult(domain, dnsLookupDoHStageName, trace, addrs...), nil
+}
@@ -0,0 +1,48 @@
+package dsl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apex/log"
+)
+
+func TestDNSLookupDoH(t *testing.T) {
+	t.Run("we correctly wrap DNS lookup errors", func(t *testing.T) {
+		// create a server that always fails the DoH round trip
+		srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srvr.Close()
+
+		// create a DoH pipeline
+		pipeline := DNSLookupDoH(srvr.URL)
+
+		// lookup using the pipeline
+		input := NewValue("www.example.com")
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, input)
+
+		// make sure the error is of the correct type
+		if !IsErrDNSLookup(results.Error) {
+			t.Fatal("not an ErrDNSLookup", results.Error)
+		}
+	})
+
+	t.Run("we return an exception for invalid URLs", func(t *testing.T) {
+		// create a DoH pipeline with an invalid URL
+		pipeline := DNSLookupDoH("\t")
+
+		// lookup using the pipeline
+		input := NewValue("www.example.com")
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, input)
+
+		// make sure the error is of the correct type
+		if !IsErrException(results.Error) {
+			t.Fatal("not an ErrException", results.Error)
+		}
+	})
+}
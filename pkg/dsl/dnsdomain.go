@@ -52,6 +52,9 @@ func (sx *domainNameStage) Run(ctx context.Context, rtx Runtime, input Maybe[*Vo
 	if input.Error != nil {
 		return NewError[string](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[string](err)
+	}
 	if !ValidDomainNames(sx.Domain) {
 		return NewError[string](&ErrException{&ErrInvalidDomain{sx.Domain}})
 	}
@@ -0,0 +1,134 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+)
+
+// DNSLookupDoTOption is an option for [DNSLookupDoT].
+type DNSLookupDoTOption func(operation *dnsLookupDoTOperation)
+
+// DNSLookupDoTOptionTags allows configuring tags to include into measurements
+// generated by the [DNSLookupDoT] pipeline stage.
+func DNSLookupDoTOptionTags(tags ...string) DNSLookupDoTOption {
+	return func(operation *dnsLookupDoTOperation) {
+		operation.Tags = append(operation.Tags, tags...)
+	}
+}
+
+// DNSLookupDoTOptionTimeout configures the timeout of the [DNSLookupDoT] pipeline
+// stage; the default is 4s.
+func DNSLookupDoTOptionTimeout(value time.Duration) DNSLookupDoTOption {
+	return func(operation *dnsLookupDoTOperation) {
+		operation.Timeout = value
+	}
+}
+
+// DNSLookupDoT returns a stage that performs a DNS lookup using the given DNS-over-TLS resolver
+// endpoint; use "ADDRESS:PORT" for IPv4 and "[ADDRESS]:PORT" for IPv6 endpoints. The sni argument
+// is the SNI to use for the TLS handshake; when empty, we use the endpoint IP address.
+//
+// This function returns an [ErrDNSLookup] if the error is a DNS lookup error. Remember to
+// use the [IsErrDNSLookup] predicate when setting an experiment test keys.
+func DNSLookupDoT(endpoint, sni string, options ...DNSLookupDoTOption) Stage[string, *DNSLookupResult] {
+	operation := &dnsLookupDoTOperation{
+		Endpoint: endpoint,
+		SNI:      sni,
+		Tags:     []string{},
+	}
+	for _, option := range options {
+		option(operation)
+	}
+	return wrapOperation[string, *DNSLookupResult](operation)
+}
+
+type dnsLookupDoTOperation struct {
+	Endpoint string        `json:"endpoint"`
+	SNI      string        `json:"sni,omitempty"`
+	Tags     []string      `json:"tags,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+}
+
+const dnsLookupDoTStageName = "dns_lookup_dot"
+
+// ASTNode implements operation.
+func (sx *dnsLookupDoTOperation) ASTNode() *SerializableASTNode {
+	// Note: we serialize the structure because this gives us forward compatibility (i.e., we
+	// may add a field to a future version without breaking the AST structure and old probes will
+	// be fine as long as the zero value of the new field is the default)
+	return &SerializableASTNode{
+		StageName: dnsLookupDoTStageName,
+		Arguments: sx,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type dnsLookupDoTLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*dnsLookupDoTLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var op dnsLookupDoTOperation
+	if err := json.Unmarshal(node.Arguments, &op); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := wrapOperation[string, *DNSLookupResult](&op)
+	return &StageRunnableASTNode[string, *DNSLookupResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*dnsLookupDoTLoader) StageName() string {
+	return dnsLookupDoTStageName
+}
+
+// Run implements operation.
+func (sx *dnsLookupDoTOperation) Run(ctx context.Context, rtx Runtime, domain string) (*DNSLookupResult, error) {
+	// make sure the target endpoint is valid
+	if !ValidEndpoints(sx.Endpoint) {
+		return nil, &ErrException{&ErrInvalidEndpoint{sx.Endpoint}}
+	}
+
+	// create trace
+	trace := rtx.NewTrace(sx.Tags...)
+
+	// start the operation logger
+	ol := measurexlite.NewOperationLogger(
+		rtx.Logger(),
+		"[#%d] DNSLookupDoT endpoint=%s sni=%s domain=%s",
+		trace.Index(),
+		sx.Endpoint,
+		sx.SNI,
+		domain,
+	)
+
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(sx.Timeout, defaultDNSLookupTimeout))
+	defer cancel()
+
+	// instantiate resolver
+	resolver := trace.NewParallelDNSOverTLSResolver(sx.Endpoint, sx.SNI)
+
+	// do the lookup
+	addrs, err := resolver.LookupHost(ctx, domain)
+
+	// stop the operation logger
+	ol.Stop(err)
+
+	// save observations
+	rtx.SaveObservations(trace.ExtractObservations()...)
+
+	// handle the error case
+	if err != nil {
+		rtx.Metrics().Error(dnsLookupDoTStageName)
+		return nil, &ErrDNSLookup{err}
+	}
+
+	// handle the successful case
+	rtx.Metrics().Success(dnsLookupDoTStageName)
+	return newDNSLookupResult(domain, dnsLookupDoTStageName, trace, addrs...), nil
+}
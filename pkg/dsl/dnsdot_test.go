@@ -0,0 +1,38 @@
+package dsl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/netemx"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestDNSLookupDoT(t *testing.T) {
+	t.Run("we correctly wrap DNS lookup errors", func(t *testing.T) {
+		// create the topology
+		topology := runtimex.Try1(netem.NewPPPTopology(
+			"10.0.0.99", "10.0.0.1", log.Log, &netem.LinkConfig{}))
+		defer topology.Close()
+
+		// Note: do not create any TCP listener, so the connection will fail
+
+		// run function using the client stack
+		netemx.WithCustomTProxy(topology.Client, func() {
+			// create a DoT pipeline
+			pipeline := DNSLookupDoT("10.0.0.1:853", "dns.example.com")
+
+			// lookup using the pipeline
+			input := NewValue("www.example.com")
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, input)
+
+			// make sure the error is of the correct type
+			if !IsErrDNSLookup(results.Error) {
+				t.Fatal("not an ErrDNSLookup", results.Error)
+			}
+		})
+	})
+}
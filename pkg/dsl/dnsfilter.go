@@ -0,0 +1,85 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// FilterDNSLookupResult returns a stage that filters the addresses of the [*DNSLookupResult]
+// given in input according to the given options (see [FilterEndpoints]). The output only
+// contains the provenance of the addresses we keep and the Bogons field of the output lists
+// the flagged bogon addresses. [MakeEndpointsForPort] marks the corresponding endpoints as
+// bogons. We do not filter the Answers field because it also contains non-address answers.
+func FilterDNSLookupResult(options ...AddressFilterOption) Stage[*DNSLookupResult, *DNSLookupResult] {
+	return &filterDNSLookupResultStage{newAddressFilterConfig(options...)}
+}
+
+type filterDNSLookupResultStage struct {
+	config addressFilterConfig
+}
+
+const filterDNSLookupResultStageName = "filter_dns_lookup_result"
+
+// ASTNode implements Stage.
+func (sx *filterDNSLookupResultStage) ASTNode() *SerializableASTNode {
+	// Note: we serialize the structure because this gives us forward compatibility (i.e., we
+	// may add a field to a future version without breaking the AST structure and old probes will
+	// be fine as long as the zero value of the new field is the default)
+	return &SerializableASTNode{
+		StageName: filterDNSLookupResultStageName,
+		Arguments: &sx.config,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type filterDNSLookupResultLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*filterDNSLookupResultLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var config addressFilterConfig
+	if err := json.Unmarshal(node.Arguments, &config); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := &filterDNSLookupResultStage{config}
+	return &StageRunnableASTNode[*DNSLookupResult, *DNSLookupResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*filterDNSLookupResultLoader) StageName() string {
+	return filterDNSLookupResultStageName
+}
+
+// Run implements Stage.
+func (sx *filterDNSLookupResultStage) Run(
+	ctx context.Context, rtx Runtime, input Maybe[*DNSLookupResult]) Maybe[*DNSLookupResult] {
+	if input.Error != nil {
+		return NewError[*DNSLookupResult](input.Error)
+	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*DNSLookupResult](err)
+	}
+	if err := sx.config.validate(); err != nil {
+		return NewError[*DNSLookupResult](err)
+	}
+
+	// create the output without modifying the input result
+	output := &DNSLookupResult{
+		Domain:     input.Value.Domain,
+		Addresses:  nil,
+		Answers:    input.Value.Answers,
+		Bogons:     nil,
+		Provenance: []*DNSAddressProvenance{},
+	}
+	for _, idx := range sx.config.filter(input.Value.Addresses...) {
+		addr := input.Value.Addresses[idx]
+		output.Addresses = append(output.Addresses, addr)
+		output.Provenance = append(output.Provenance, dnsAddressProvenance(addr, input.Value.Provenance...)...)
+		if sx.config.isFlaggedBogon(addr) || input.Value.isBogon(addr) {
+			output.Bogons = append(output.Bogons, addr)
+		}
+	}
+	return NewValue(output)
+}
@@ -0,0 +1,39 @@
+package dsl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterDNSLookupResult(t *testing.T) {
+	rtx := NewMinimalRuntime(log.Log)
+	pipeline := Compose3(
+		DNSLookupStatic("130.192.91.211", "10.0.0.1", "2001:4860:4860::8888"),
+		FilterDNSLookupResult(AddressFilterOptionFamily("ipv4"), AddressFilterOptionBogons("flag")),
+		MakeEndpointsForPort(443),
+	)
+	output := pipeline.Run(context.Background(), rtx, NewValue("www.example.com"))
+	if output.Error != nil {
+		t.Fatal(output.Error)
+	}
+
+	type endpointSummary struct {
+		Address    string
+		Bogon      bool
+		Provenance int
+	}
+	var got []endpointSummary
+	for _, epnt := range output.Value {
+		got = append(got, endpointSummary{epnt.Address, epnt.Bogon, len(epnt.Provenance)})
+	}
+	expect := []endpointSummary{
+		{Address: "130.192.91.211:443", Bogon: false, Provenance: 1},
+		{Address: "10.0.0.1:443", Bogon: true, Provenance: 1},
+	}
+	if diff := cmp.Diff(expect, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
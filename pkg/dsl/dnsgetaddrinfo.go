@@ -19,6 +19,14 @@ func DNSLookupGetaddrinfoOptionTags(tags ...string) DNSLookupGetaddrinfoOption {
 	}
 }
 
+// DNSLookupGetaddrinfoOptionTimeout configures the timeout of the [DNSLookupGetaddrinfo] pipeline
+// stage; the default is 4s.
+func DNSLookupGetaddrinfoOptionTimeout(value time.Duration) DNSLookupGetaddrinfoOption {
+	return func(operation *dnsLookupGetaddrinfoOperation) {
+		operation.Timeout = value
+	}
+}
+
 // DNSLookupGetaddrinfo returns a stage that performs DNS lookups using getaddrinfo.
 //
 // This function returns an [ErrDNSLookup] if the error is a DNS lookup error. Remember to
@@ -34,7 +42,8 @@ func DNSLookupGetaddrinfo(options ...DNSLookupGetaddrinfoOption) Stage[string, *
 }
 
 type dnsLookupGetaddrinfoOperation struct {
-	Tags []string `json:"tags,omitempty"`
+	Tags    []string      `json:"tags,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
 }
 
 const dnsLookupGetaddrinfoStageName = "dns_lookup_getaddrinfo"
@@ -85,7 +94,7 @@ func (op *dnsLookupGetaddrinfoOperation) Run(ctx context.Context, rtx Runtime, d
 	)
 
 	// setup
-	ctx, cancel := context.WithTimeout(ctx, 4*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(op.Timeout, defaultDNSLookupTimeout))
 	defer cancel()
 
 	// instantiate a resolver
@@ -108,5 +117,5 @@ func (op *dnsLookupGetaddrinfoOperation) Run(ctx context.Context, rtx Runtime, d
 
 	// handle the successful case
 	rtx.Metrics().Success(dnsLookupGetaddrinfoStageName)
-	return &DNSLookupResult{Domain: domain, Addresses: addrs}, nil
+	return newDNSLookupResult(domain, dnsLookupGetaddrinfoStageName, trace, addrs...), nil
 }
@@ -9,6 +9,103 @@ type DNSLookupResult struct {
 
 	// Addresses contains resolved addresses (if any).
 	Addresses []string
+
+	// Answers contains the OPTIONAL typed answers. Only stages sending raw DNS
+	// queries, such as [DNSLookupQuery], fill this field.
+	Answers []*DNSAnswer
+
+	// Bogons contains the OPTIONAL addresses flagged as bogons by [FilterDNSLookupResult].
+	Bogons []string
+
+	// Provenance contains an entry for each resolver that returned each address
+	// in Addresses. When several resolvers return the same address (e.g., when
+	// using [DNSLookupParallel]) there is an entry for each resolver.
+	Provenance []*DNSAddressProvenance
+}
+
+// DNSAddressProvenance describes which resolver returned an address.
+type DNSAddressProvenance struct {
+	// Address is the resolved IP address.
+	Address string
+
+	// StageName is the name of the resolver stage (e.g., "dns_lookup_udp").
+	StageName string
+
+	// Tags contains the tags of the trace used by the resolver stage.
+	Tags []string
+
+	// TraceIndex is the index of the trace used by the resolver stage or
+	// zero when the stage does not use any trace (e.g., [DNSLookupStatic]).
+	TraceIndex int64
+}
+
+// newDNSLookupResult creates a new [*DNSLookupResult] recording that the resolver
+// stage with the given name and trace has returned the given addresses.
+func newDNSLookupResult(domain, stageName string, trace Trace, addrs ...string) *DNSLookupResult {
+	result := &DNSLookupResult{
+		Domain:     domain,
+		Addresses:  addrs,
+		Answers:    nil,
+		Bogons:     nil,
+		Provenance: []*DNSAddressProvenance{},
+	}
+	for _, addr := range addrs {
+		provenance := &DNSAddressProvenance{
+			Address:    addr,
+			StageName:  stageName,
+			Tags:       []string{},
+			TraceIndex: 0,
+		}
+		if trace != nil {
+			provenance.Tags = trace.Tags()
+			provenance.TraceIndex = trace.Index()
+		}
+		result.Provenance = append(result.Provenance, provenance)
+	}
+	return result
+}
+
+// isBogon returns whether the given address has been flagged as a bogon.
+func (r *DNSLookupResult) isBogon(addr string) bool {
+	for _, entry := range r.Bogons {
+		if entry == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// DNSAnswer is a typed DNS answer.
+type DNSAnswer struct {
+	// Type is the answer type (e.g., "A", "CNAME", "HTTPS").
+	Type string
+
+	// Name is the name of the node to which this answer pertains.
+	Name string
+
+	// TTL is the answer time to live in seconds.
+	TTL uint32
+
+	// Address is the IP address contained by A and AAAA answers.
+	Address string
+
+	// Target is the target name of CNAME, NS, HTTPS and SVCB answers.
+	Target string
+
+	// Text contains the strings inside TXT answers.
+	Text []string
+
+	// Priority is the priority of HTTPS and SVCB answers.
+	Priority uint16
+
+	// ALPN contains the ALPN hints inside HTTPS and SVCB answers.
+	ALPN []string
+
+	// Port is the OPTIONAL port inside HTTPS and SVCB answers.
+	Port uint16
+
+	// IPHints contains the IPv4 and IPv6 hints inside HTTPS and SVCB answers.
+	IPHints []string
 }
 
 // ErrDNSLookup wraps errors occurred during a DNS lookup operation.
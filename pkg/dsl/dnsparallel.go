@@ -2,19 +2,37 @@ package dsl
 
 import (
 	"context"
+	"encoding/json"
 )
 
 // DNSLookupParallel returns a stage that runs several DNS lookup stages in parallel using a
 // pool of background goroutines. Note that this stage disregards the result of substages and
 // returns an empty list of addresses when all the substages have failed.
+//
+// The returned addresses are unique and sorted by the order of the substages and then by the
+// order in which each substage returned them. The returned provenance contains an entry for
+// each substage that returned each address, using the same ordering.
+//
+// This function is equivalent to calling [DNSLookupParallelWithParallelism] with zero parallelism.
 func DNSLookupParallel(stages ...Stage[string, *DNSLookupResult]) Stage[string, *DNSLookupResult] {
-	return &dnsLookupParallelStage{stages}
+	return DNSLookupParallelWithParallelism(0, stages...)
+}
+
+// DNSLookupParallelWithParallelism is like [DNSLookupParallel] but allows to configure the
+// number of background goroutines. When parallelism is zero or negative, we use five
+// background goroutines.
+func DNSLookupParallelWithParallelism(
+	parallelism int, stages ...Stage[string, *DNSLookupResult]) Stage[string, *DNSLookupResult] {
+	return &dnsLookupParallelStage{parallelArguments{parallelism}, stages}
 }
 
 type dnsLookupParallelStage struct {
+	args   parallelArguments
 	stages []Stage[string, *DNSLookupResult]
 }
 
+const dnsLookupParallelDefaultParallelism = 5
+
 const dnsLookupParallelStageName = "dns_lookup_parallel"
 
 // ASTNode implements Stage.
@@ -25,7 +43,7 @@ func (sx *dnsLookupParallelStage) ASTNode() *SerializableASTNode {
 	}
 	return &SerializableASTNode{
 		StageName: dnsLookupParallelStageName,
-		Arguments: nil,
+		Arguments: &sx.args,
 		Children:  nodes,
 	}
 }
@@ -34,7 +52,8 @@ type dnsLookupParallelLoader struct{}
 
 // Load implements ASTLoaderRule.
 func (*dnsLookupParallelLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
-	if err := loader.LoadEmptyArguments(node); err != nil {
+	var args parallelArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
 		return nil, err
 	}
 	runnables, err := loader.LoadChildren(node)
@@ -42,7 +61,7 @@ func (*dnsLookupParallelLoader) Load(loader *ASTLoader, node *LoadableASTNode) (
 		return nil, err
 	}
 	children := RunnableASTNodeListToStageList[string, *DNSLookupResult](runnables...)
-	stage := DNSLookupParallel(children...)
+	stage := DNSLookupParallelWithParallelism(args.Parallelism, children...)
 	return &StageRunnableASTNode[string, *DNSLookupResult]{stage}, nil
 }
 
@@ -57,6 +76,9 @@ func (sx *dnsLookupParallelStage) Run(ctx context.Context, rtx Runtime, input Ma
 	if input.Error != nil {
 		return NewError[*DNSLookupResult](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*DNSLookupResult](err)
+	}
 
 	// create list of workers to run
 	var workers []Worker[Maybe[*DNSLookupResult]]
@@ -65,32 +87,38 @@ func (sx *dnsLookupParallelStage) Run(ctx context.Context, rtx Runtime, input Ma
 	}
 
 	// run workers
-	const parallelism = 5
-	results := ParallelRun(ctx, parallelism, workers...)
+	parallelism := sx.args.parallelismOrDefault(dnsLookupParallelDefaultParallelism)
+	results := ParallelRunWithConcurrencyBudget(ctx, rtx.ConcurrencyBudget(), parallelism, workers...)
 
 	// route exceptions
 	if err := catch(results...); err != nil {
 		return NewError[*DNSLookupResult](err)
 	}
 
-	// make sure we remove duplicate IP addresses
-	uniq := make(map[string]int)
+	// create the output making sure we remove duplicate IP addresses
+	output := &DNSLookupResult{
+		Domain:     input.Value,
+		Addresses:  nil,
+		Answers:    nil,
+		Bogons:     nil,
+		Provenance: []*DNSAddressProvenance{},
+	}
+	uniq := make(map[string]bool)
 	for _, result := range results {
 		if result.Error != nil {
 			continue
 		}
 		for _, address := range result.Value.Addresses {
-			uniq[address]++
+			if !uniq[address] {
+				uniq[address] = true
+				output.Addresses = append(output.Addresses, address)
+			}
+			if result.Value.isBogon(address) && !output.isBogon(address) {
+				output.Bogons = append(output.Bogons, address)
+			}
 		}
-	}
-
-	// create the output and return it
-	output := &DNSLookupResult{
-		Domain:    input.Value,
-		Addresses: nil,
-	}
-	for address := range uniq {
-		output.Addresses = append(output.Addresses, address)
+		output.Answers = append(output.Answers, result.Value.Answers...)
+		output.Provenance = append(output.Provenance, result.Value.Provenance...)
 	}
 	return NewValue(output)
 }
@@ -0,0 +1,82 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestDNSLookupParallel(t *testing.T) {
+	t.Run("we preserve the order and the provenance of addresses", func(t *testing.T) {
+		pipeline := Compose(
+			DNSLookupParallel(
+				DNSLookupStatic("130.192.91.211", "2001:858:2:2:aabb::563b:1e28"),
+				DNSLookupStatic("130.192.91.231", "130.192.91.211"),
+			),
+			MakeEndpointsForPort(443),
+		)
+
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, NewValue("nexa.polito.it"))
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		newProvenance := func(address string) *DNSAddressProvenance {
+			return &DNSAddressProvenance{
+				Address:    address,
+				StageName:  dnsLookupStaticStageName,
+				Tags:       []string{},
+				TraceIndex: 0,
+			}
+		}
+		expect := []*Endpoint{{
+			Address: "130.192.91.211:443",
+			Domain:  "nexa.polito.it",
+			Provenance: []*DNSAddressProvenance{
+				newProvenance("130.192.91.211"),
+				newProvenance("130.192.91.211"),
+			},
+		}, {
+			Address:    "[2001:858:2:2:aabb::563b:1e28]:443",
+			Domain:     "nexa.polito.it",
+			Provenance: []*DNSAddressProvenance{newProvenance("2001:858:2:2:aabb::563b:1e28")},
+		}, {
+			Address:    "130.192.91.231:443",
+			Domain:     "nexa.polito.it",
+			Provenance: []*DNSAddressProvenance{newProvenance("130.192.91.231")},
+		}}
+		if diff := cmp.Diff(expect, results.Value); diff != "" {
+			t.Fatal(diff)
+		}
+
+		tags := results.Value[0].tags("antani")
+		expectTags := []string{
+			"antani",
+			"address_provenance=dns_lookup_static#0",
+			"address_provenance=dns_lookup_static#0",
+		}
+		if diff := cmp.Diff(expectTags, tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we serialize and load the parallelism", func(t *testing.T) {
+		stage := DNSLookupParallelWithParallelism(1, DNSLookupStatic("130.192.91.211"))
+		rawAST := runtimex.Try1(json.Marshal(stage.ASTNode()))
+		if !strings.Contains(string(rawAST), `"parallelism":1`) {
+			t.Fatal("unexpected AST", string(rawAST))
+		}
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+		if diff := cmp.Diff(rawAST, runtimex.Try1(json.Marshal(runnable.ASTNode()))); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -0,0 +1,320 @@
+package dsl
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// DNSLookupQueryOption is an option for [DNSLookupQuery].
+type DNSLookupQueryOption func(operation *dnsLookupQueryOperation)
+
+// DNSLookupQueryOptionSNI configures the SNI to use with the "dot" network; the
+// default is to use the IP address of the resolver endpoint.
+func DNSLookupQueryOptionSNI(value string) DNSLookupQueryOption {
+	return func(operation *dnsLookupQueryOperation) {
+		operation.SNI = value
+	}
+}
+
+// DNSLookupQueryOptionTags allows configuring tags to include into measurements
+// generated by the [DNSLookupQuery] pipeline stage.
+func DNSLookupQueryOptionTags(tags ...string) DNSLookupQueryOption {
+	return func(operation *dnsLookupQueryOperation) {
+		operation.Tags = append(operation.Tags, tags...)
+	}
+}
+
+// DNSLookupQueryOptionTimeout configures the timeout of the [DNSLookupQuery] pipeline
+// stage; the default is 4s.
+func DNSLookupQueryOptionTimeout(value time.Duration) DNSLookupQueryOption {
+	return func(operation *dnsLookupQueryOperation) {
+		operation.Timeout = value
+	}
+}
+
+// DNSLookupQuery returns a stage that sends a single raw DNS query with the given query type
+// (e.g., "CNAME", "HTTPS", "NS", "TXT") and returns the typed answers. The network is one of
+// "udp", "tcp", "dot", and "doh". The address is the resolver endpoint (e.g., "8.8.8.8:53") except
+// for the "doh" network where it is the resolver URL (e.g., "https://dns.google/dns-query").
+//
+// The returned [*DNSLookupResult] Addresses field contains the addresses inside A and AAAA answers
+// as well as the IP hints inside HTTPS and SVCB answers. The Answers field contains all the typed
+// answers. This function returns an [ErrDNSLookup] if the response does not contain any answer
+// for the given query type. Remember to use the [IsErrDNSLookup] predicate when setting an
+// experiment test keys.
+func DNSLookupQuery(
+	network, address, queryType string, options ...DNSLookupQueryOption) Stage[string, *DNSLookupResult] {
+	operation := &dnsLookupQueryOperation{
+		Address:   address,
+		Network:   network,
+		QueryType: queryType,
+		SNI:       "",
+		Tags:      []string{},
+		Timeout:   0,
+	}
+	for _, option := range options {
+		option(operation)
+	}
+	return wrapOperation[string, *DNSLookupResult](operation)
+}
+
+type dnsLookupQueryOperation struct {
+	Address   string        `json:"address"`
+	Network   string        `json:"network"`
+	QueryType string        `json:"query_type"`
+	SNI       string        `json:"sni,omitempty"`
+	Tags      []string      `json:"tags,omitempty"`
+	Timeout   time.Duration `json:"timeout,omitempty"`
+}
+
+const dnsLookupQueryStageName = "dns_lookup_query"
+
+// ASTNode implements operation.
+func (sx *dnsLookupQueryOperation) ASTNode() *SerializableASTNode {
+	// Note: we serialize the structure because this gives us forward compatibility (i.e., we
+	// may add a field to a future version without breaking the AST structure and old probes will
+	// be fine as long as the zero value of the new field is the default)
+	return &SerializableASTNode{
+		StageName: dnsLookupQueryStageName,
+		Arguments: sx,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type dnsLookupQueryLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*dnsLookupQueryLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var op dnsLookupQueryOperation
+	if err := json.Unmarshal(node.Arguments, &op); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := wrapOperation[string, *DNSLookupResult](&op)
+	return &StageRunnableASTNode[string, *DNSLookupResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*dnsLookupQueryLoader) StageName() string {
+	return dnsLookupQueryStageName
+}
+
+// Run implements operation.
+func (sx *dnsLookupQueryOperation) Run(ctx context.Context, rtx Runtime, domain string) (*DNSLookupResult, error) {
+	// make sure the query type is valid
+	qtype, good := dns.StringToType[strings.ToUpper(sx.QueryType)]
+	if !good {
+		return nil, &ErrException{&ErrInvalidDNSQueryType{sx.QueryType}}
+	}
+
+	// make sure the resolver network and address are valid
+	switch sx.Network {
+	case "doh":
+		if !ValidDoHURLs(sx.Address) {
+			return nil, &ErrException{&ErrInvalidURL{sx.Address}}
+		}
+	case "dot", "tcp", "udp":
+		if !ValidEndpoints(sx.Address) {
+			return nil, &ErrException{&ErrInvalidEndpoint{sx.Address}}
+		}
+	default:
+		return nil, &ErrException{&ErrInvalidDNSNetwork{sx.Network}}
+	}
+
+	// create trace
+	trace := rtx.NewTrace(sx.Tags...)
+
+	// start the operation logger
+	ol := measurexlite.NewOperationLogger(
+		rtx.Logger(),
+		"[#%d] DNSLookupQuery network=%s address=%s type=%s domain=%s",
+		trace.Index(),
+		sx.Network,
+		sx.Address,
+		sx.QueryType,
+		domain,
+	)
+
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(sx.Timeout, defaultDNSLookupTimeout))
+	defer cancel()
+
+	// instantiate the transport and the query
+	txp := sx.newTransport(rtx.Logger(), trace)
+	defer txp.CloseIdleConnections()
+	query := (&netxlite.DNSEncoderMiekg{}).Encode(domain, qtype, txp.RequiresPadding())
+
+	// perform the round trip
+	_, answers, err := trace.DNSRoundTrip(ctx, txp, query)
+
+	// stop the operation logger
+	ol.Stop(err)
+
+	// save observations
+	rtx.SaveObservations(trace.ExtractObservations()...)
+
+	// handle the error case
+	if err != nil {
+		rtx.Metrics().Error(dnsLookupQueryStageName)
+		return nil, &ErrDNSLookup{err}
+	}
+
+	// handle the successful case
+	rtx.Metrics().Success(dnsLookupQueryStageName)
+	output := newDNSLookupResult(domain, dnsLookupQueryStageName, trace, dnsAnswersAddresses(answers...)...)
+	output.Answers = answers
+	return output, nil
+}
+
+// newTransport creates the DNS transport using the trace dialer and TLS handshaker.
+func (sx *dnsLookupQueryOperation) newTransport(logger model.Logger, trace Trace) model.DNSTransport {
+	switch sx.Network {
+	case "doh":
+		// Note: we use the trace stdlib resolver to resolve the domain of the resolver URL,
+		// so the trace also contains the lookup of the resolver domain
+		dialer := netxlite.WrapDialer(logger, trace.NewStdlibResolver(), trace.NewDialerWithoutResolver())
+		tlsDialer := netxlite.NewTLSDialer(dialer, trace.NewTLSHandshakerStdlib())
+		return netxlite.NewDNSOverHTTPSTransportWithHTTPTransport(
+			netxlite.NewHTTPTransport(logger, dialer, tlsDialer), sx.Address)
+	case "dot":
+		tlsDialer := netxlite.NewTLSDialerWithConfig(
+			trace.NewDialerWithoutResolver(),
+			trace.NewTLSHandshakerStdlib(),
+			&tls.Config{
+				NextProtos: []string{"dot"},
+				RootCAs:    nil, // use the cached default Mozilla cert pool
+				ServerName: sx.SNI,
+			},
+		)
+		return netxlite.WrapDNSTransport(
+			netxlite.NewUnwrappedDNSOverTLSTransport(tlsDialer.DialTLSContext, sx.Address))
+	case "tcp":
+		dialer := trace.NewDialerWithoutResolver()
+		return netxlite.WrapDNSTransport(
+			netxlite.NewUnwrappedDNSOverTCPTransport(dialer.DialContext, sx.Address))
+	default:
+		dialer := trace.NewDialerWithoutResolver()
+		return netxlite.WrapDNSTransport(
+			netxlite.NewUnwrappedDNSOverUDPTransport(dialer, sx.Address))
+	}
+}
+
+// dnsDecodeResponse decodes the typed answers inside a DNS response and maps the response
+// Rcode and the lack of answers for the query type to the corresponding errors.
+func dnsDecodeResponse(query model.DNSQuery, response model.DNSResponse) ([]*DNSAnswer, error) {
+	// parse the raw response
+	msg := &dns.Msg{}
+	if err := msg.Unpack(response.Bytes()); err != nil {
+		return nil, netxlite.MaybeNewErrWrapper(netxlite.ClassifyResolverError, netxlite.ResolveOperation, err)
+	}
+
+	// map the Rcode to an error
+	var err error
+	switch msg.Rcode {
+	case dns.RcodeSuccess:
+		// nothing
+	case dns.RcodeNameError:
+		err = netxlite.ErrOODNSNoSuchHost
+	case dns.RcodeRefused:
+		err = netxlite.ErrOODNSRefused
+	case dns.RcodeServerFailure:
+		err = netxlite.ErrOODNSServfail
+	default:
+		err = netxlite.ErrOODNSMisbehaving
+	}
+	if err != nil {
+		return nil, netxlite.MaybeNewErrWrapper(netxlite.ClassifyResolverError, netxlite.ResolveOperation, err)
+	}
+
+	// decode the answers and make sure there's an answer for the query type
+	var (
+		answers []*DNSAnswer
+		found   bool
+	)
+	for _, rr := range msg.Answer {
+		answers = append(answers, newDNSAnswer(rr))
+		found = found || rr.Header().Rrtype == query.Type()
+	}
+	if !found {
+		return nil, netxlite.MaybeNewErrWrapper(
+			netxlite.ClassifyResolverError, netxlite.ResolveOperation, netxlite.ErrOODNSNoAnswer)
+	}
+	return answers, nil
+}
+
+// newDNSAnswer converts a resource record to a [*DNSAnswer].
+func newDNSAnswer(rr dns.RR) *DNSAnswer {
+	answer := &DNSAnswer{
+		Type: dns.TypeToString[rr.Header().Rrtype],
+		Name: rr.Header().Name,
+		TTL:  rr.Header().Ttl,
+	}
+	switch value := rr.(type) {
+	case *dns.A:
+		answer.Address = value.A.String()
+	case *dns.AAAA:
+		answer.Address = value.AAAA.String()
+	case *dns.CNAME:
+		answer.Target = value.Target
+	case *dns.NS:
+		answer.Target = value.Ns
+	case *dns.TXT:
+		answer.Text = value.Txt
+	case *dns.HTTPS:
+		fillDNSAnswerSVCB(answer, &value.SVCB)
+	case *dns.SVCB:
+		fillDNSAnswerSVCB(answer, value)
+	}
+	return answer
+}
+
+// fillDNSAnswerSVCB fills a [*DNSAnswer] using the content of an SVCB or HTTPS record.
+func fillDNSAnswerSVCB(answer *DNSAnswer, value *dns.SVCB) {
+	answer.Priority = value.Priority
+	answer.Target = value.Target
+	for _, kv := range value.Value {
+		switch param := kv.(type) {
+		case *dns.SVCBAlpn:
+			answer.ALPN = append(answer.ALPN, param.Alpn...)
+		case *dns.SVCBPort:
+			answer.Port = param.Port
+		case *dns.SVCBIPv4Hint:
+			for _, ip := range param.Hint {
+				answer.IPHints = append(answer.IPHints, ip.String())
+			}
+		case *dns.SVCBIPv6Hint:
+			for _, ip := range param.Hint {
+				answer.IPHints = append(answer.IPHints, ip.String())
+			}
+		}
+	}
+}
+
+// dnsAnswersAddresses returns the unique IP addresses inside A and AAAA answers
+// as well as the IP hints inside HTTPS and SVCB answers.
+func dnsAnswersAddresses(answers ...*DNSAnswer) (out []string) {
+	uniq := make(map[string]bool)
+	maybeAppend := func(address string) {
+		if address != "" && !uniq[address] {
+			uniq[address] = true
+			out = append(out, address)
+		}
+	}
+	for _, answer := range answers {
+		maybeAppend(answer.Address)
+		for _, address := range answer.IPHints {
+			maybeAppend(address)
+		}
+	}
+	return
+}
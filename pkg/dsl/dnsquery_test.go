@@ -0,0 +1,175 @@
+package dsl
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netemx"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestDNSLookupQuery(t *testing.T) {
+	t.Run("we correctly wrap DNS lookup errors", func(t *testing.T) {
+		// create the topology
+		topology := runtimex.Try1(netem.NewPPPTopology(
+			"10.0.0.99", "10.0.0.1", log.Log, &netem.LinkConfig{}))
+		defer topology.Close()
+
+		// Note: do not create any TCP listener, so the connection will fail
+
+		// run function using the client stack
+		netemx.WithCustomTProxy(topology.Client, func() {
+			// create a query pipeline
+			pipeline := DNSLookupQuery("tcp", "10.0.0.1:53", "HTTPS")
+
+			// lookup using the pipeline
+			input := NewValue("www.example.com")
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, input)
+
+			// make sure the error is of the correct type
+			if !IsErrDNSLookup(results.Error) {
+				t.Fatal("not an ErrDNSLookup", results.Error)
+			}
+		})
+	})
+
+	t.Run("we trace the connections used by the doh network", func(t *testing.T) {
+		// create a DoH server that returns a single A answer
+		srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := &dns.Msg{}
+			runtimex.Try0(query.Unpack(runtimex.Try1(io.ReadAll(r.Body))))
+			response := &dns.Msg{}
+			response.SetReply(query)
+			response.Answer = append(response.Answer, &dns.A{
+				Hdr: dns.RR_Header{
+					Name:   query.Question[0].Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    300,
+				},
+				A: net.IPv4(93, 184, 216, 34),
+			})
+			w.Header().Set("Content-Type", "application/dns-message")
+			w.Write(runtimex.Try1(response.Pack()))
+		}))
+		defer srvr.Close()
+
+		// perform the lookup using a runtime that collects observations
+		rtx := NewMeasurexliteRuntime(model.DiscardLogger, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		pipeline := DNSLookupQuery("doh", srvr.URL+"/dns-query", "A")
+		results := pipeline.Run(context.Background(), rtx, NewValue("www.example.com"))
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		if diff := cmp.Diff([]string{"93.184.216.34"}, results.Value.Addresses); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// make sure we traced the connection to the DoH server
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		if len(observations.TCPConnect) != 1 {
+			t.Fatal("expected a single TCP connect entry", len(observations.TCPConnect))
+		}
+		if observations.TCPConnect[0].Status.Failure != nil {
+			t.Fatal("unexpected failure", *observations.TCPConnect[0].Status.Failure)
+		}
+	})
+
+	t.Run("we reject invalid arguments", func(t *testing.T) {
+		pipelines := []Stage[string, *DNSLookupResult]{
+			DNSLookupQuery("tcp", "8.8.8.8:53", "NONEXISTENT"),
+			DNSLookupQuery("sctp", "8.8.8.8:53", "A"),
+			DNSLookupQuery("udp", "8.8.8.8", "A"),
+			DNSLookupQuery("doh", "\t", "A"),
+		}
+		for _, pipeline := range pipelines {
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, NewValue("www.example.com"))
+			if !IsErrException(results.Error) {
+				t.Fatal("not an ErrException", results.Error)
+			}
+		}
+	})
+}
+
+func TestDNSDecodeResponse(t *testing.T) {
+	// newResponse creates a response for the given query with the given answers
+	newResponse := func(query model.DNSQuery, rcode int, answers ...dns.RR) model.DNSResponse {
+		queryMsg := &dns.Msg{}
+		runtimex.Try0(queryMsg.Unpack(runtimex.Try1(query.Bytes())))
+		responseMsg := &dns.Msg{}
+		responseMsg.SetRcode(queryMsg, rcode)
+		responseMsg.Answer = answers
+		rawResponse := runtimex.Try1(responseMsg.Pack())
+		return runtimex.Try1((&netxlite.DNSDecoderMiekg{}).DecodeResponse(rawResponse, query))
+	}
+
+	t.Run("we correctly decode HTTPS answers", func(t *testing.T) {
+		query := (&netxlite.DNSEncoderMiekg{}).Encode("www.example.com", dns.TypeHTTPS, false)
+		record := &dns.HTTPS{SVCB: dns.SVCB{
+			Hdr: dns.RR_Header{
+				Name:   "www.example.com.",
+				Rrtype: dns.TypeHTTPS,
+				Class:  dns.ClassINET,
+				Ttl:    300,
+			},
+			Priority: 1,
+			Target:   ".",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{Alpn: []string{"h3", "h2"}},
+				&dns.SVCBIPv4Hint{Hint: []net.IP{net.IPv4(93, 184, 216, 34)}},
+			},
+		}}
+		response := newResponse(query, dns.RcodeSuccess, record)
+
+		answers, err := dnsDecodeResponse(query, response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []*DNSAnswer{{
+			Type:     "HTTPS",
+			Name:     "www.example.com.",
+			TTL:      300,
+			Target:   ".",
+			Priority: 1,
+			ALPN:     []string{"h3", "h2"},
+			IPHints:  []string{"93.184.216.34"},
+		}}
+		if diff := cmp.Diff(expect, answers); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff([]string{"93.184.216.34"}, dnsAnswersAddresses(answers...)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we map the lack of answers to an error", func(t *testing.T) {
+		query := (&netxlite.DNSEncoderMiekg{}).Encode("www.example.com", dns.TypeCNAME, false)
+		response := newResponse(query, dns.RcodeSuccess)
+		_, err := dnsDecodeResponse(query, response)
+		if err == nil || err.Error() != netxlite.FailureDNSNoAnswer {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we map the Rcode to an error", func(t *testing.T) {
+		query := (&netxlite.DNSEncoderMiekg{}).Encode("www.example.com", dns.TypeTXT, false)
+		response := newResponse(query, dns.RcodeNameError)
+		_, err := dnsDecodeResponse(query, response)
+		if err == nil || err.Error() != netxlite.FailureDNSNXDOMAINError {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
@@ -53,9 +53,5 @@ func (sx *dnsLookupStaticOperation) Run(ctx context.Context, rtx Runtime, domain
 	if !ValidIPAddrs(sx.Addresses...) {
 		return nil, &ErrException{&ErrInvalidAddressList{sx.Addresses}}
 	}
-	output := &DNSLookupResult{
-		Domain:    domain,
-		Addresses: sx.Addresses,
-	}
-	return output, nil
+	return newDNSLookupResult(domain, dnsLookupStaticStageName, nil, sx.Addresses...), nil
 }
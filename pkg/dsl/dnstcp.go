@@ -0,0 +1,130 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+)
+
+// DNSLookupTCPOption is an option for [DNSLookupTCP].
+type DNSLookupTCPOption func(operation *dnsLookupTCPOperation)
+
+// DNSLookupTCPOptionTags allows configuring tags to include into measurements
+// generated by the [DNSLookupTCP] pipeline stage.
+func DNSLookupTCPOptionTags(tags ...string) DNSLookupTCPOption {
+	return func(operation *dnsLookupTCPOperation) {
+		operation.Tags = append(operation.Tags, tags...)
+	}
+}
+
+// DNSLookupTCPOptionTimeout configures the timeout of the [DNSLookupTCP] pipeline
+// stage; the default is 4s.
+func DNSLookupTCPOptionTimeout(value time.Duration) DNSLookupTCPOption {
+	return func(operation *dnsLookupTCPOperation) {
+		operation.Timeout = value
+	}
+}
+
+// DNSLookupTCP returns a stage that performs a DNS lookup using the given TCP resolver
+// endpoint; use "ADDRESS:PORT" for IPv4 and "[ADDRESS]:PORT" for IPv6 endpoints.
+//
+// This function returns an [ErrDNSLookup] if the error is a DNS lookup error. Remember to
+// use the [IsErrDNSLookup] predicate when setting an experiment test keys.
+func DNSLookupTCP(endpoint string, options ...DNSLookupTCPOption) Stage[string, *DNSLookupResult] {
+	operation := &dnsLookupTCPOperation{
+		Endpoint: endpoint,
+		Tags:     []string{},
+	}
+	for _, option := range options {
+		option(operation)
+	}
+	return wrapOperation[string, *DNSLookupResult](operation)
+}
+
+type dnsLookupTCPOperation struct {
+	Endpoint string        `json:"endpoint"`
+	Tags     []string      `json:"tags,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+}
+
+const dnsLookupTCPStageName = "dns_lookup_tcp"
+
+// ASTNode implements operation.
+func (sx *dnsLookupTCPOperation) ASTNode() *SerializableASTNode {
+	// Note: we serialize the structure because this gives us forward compatibility (i.e., we
+	// may add a field to a future version without breaking the AST structure and old probes will
+	// be fine as long as the zero value of the new field is the default)
+	return &SerializableASTNode{
+		StageName: dnsLookupTCPStageName,
+		Arguments: sx,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type dnsLookupTCPLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*dnsLookupTCPLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var op dnsLookupTCPOperation
+	if err := json.Unmarshal(node.Arguments, &op); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := wrapOperation[string, *DNSLookupResult](&op)
+	return &StageRunnableASTNode[string, *DNSLookupResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*dnsLookupTCPLoader) StageName() string {
+	return dnsLookupTCPStageName
+}
+
+// Run implements operation.
+func (sx *dnsLookupTCPOperation) Run(ctx context.Context, rtx Runtime, domain string) (*DNSLookupResult, error) {
+	// make sure the target endpoint is valid
+	if !ValidEndpoints(sx.Endpoint) {
+		return nil, &ErrException{&ErrInvalidEndpoint{sx.Endpoint}}
+	}
+
+	// create trace
+	trace := rtx.NewTrace(sx.Tags...)
+
+	// start the operation logger
+	ol := measurexlite.NewOperationLogger(
+		rtx.Logger(),
+		"[#%d] DNSLookupTCP endpoint=%s domain=%s",
+		trace.Index(),
+		sx.Endpoint,
+		domain,
+	)
+
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(sx.Timeout, defaultDNSLookupTimeout))
+	defer cancel()
+
+	// instantiate resolver
+	resolver := trace.NewParallelDNSOverTCPResolver(sx.Endpoint)
+
+	// do the lookup
+	addrs, err := resolver.LookupHost(ctx, domain)
+
+	// stop the operation logger
+	ol.Stop(err)
+
+	// save observations
+	rtx.SaveObservations(trace.ExtractObservations()...)
+
+	// handle the error case
+	if err != nil {
+		rtx.Metrics().Error(dnsLookupTCPStageName)
+		return nil, &ErrDNSLookup{err}
+	}
+
+	// handle the successful case
+	rtx.Metrics().Success(dnsLookupTCPStageName)
+	return newDNSLookupResult(domain, dnsLookupTCPStageName, trace, addrs...), nil
+}
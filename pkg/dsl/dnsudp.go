@@ -19,6 +19,14 @@ func DNSLookupUDPOptionTags(tags ...string) DNSLookupUDPOption {
 	}
 }
 
+// DNSLookupUDPOptionTimeout configures the timeout of the [DNSLookupUDP] pipeline
+// stage; the default is 4s.
+func DNSLookupUDPOptionTimeout(value time.Duration) DNSLookupUDPOption {
+	return func(operation *dnsLookupUDPOperation) {
+		operation.Timeout = value
+	}
+}
+
 // DNSLookupUDP returns a stage that performs a DNS lookup using the given UDP resolver
 // endpoint; use "ADDRESS:PORT" for IPv4 and "[ADDRESS]:PORT" for IPv6 endpoints.
 //
@@ -36,8 +44,9 @@ func DNSLookupUDP(endpoint string, options ...DNSLookupUDPOption) Stage[string,
 }
 
 type dnsLookupUDPOperation struct {
-	Endpoint string   `json:"endpoint"`
-	Tags     []string `json:"tags,omitempty"`
+	Endpoint string        `json:"endpoint"`
+	Tags     []string      `json:"tags,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
 }
 
 const dnsLookupUDPStageName = "dns_lookup_udp"
@@ -94,7 +103,7 @@ func (sx *dnsLookupUDPOperation) Run(ctx context.Context, rtx Runtime, domain st
 	)
 
 	// setup
-	ctx, cancel := context.WithTimeout(ctx, 4*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(sx.Timeout, defaultDNSLookupTimeout))
 	defer cancel()
 
 	// instantiate resolver
@@ -117,5 +126,5 @@ func (sx *dnsLookupUDPOperation) Run(ctx context.Context, rtx Runtime, domain st
 
 	// handle the successful case
 	rtx.Metrics().Success(dnsLookupUDPStageName)
-	return &DNSLookupResult{Domain: domain, Addresses: addrs}, nil
+	return newDNSLookupResult(domain, dnsLookupUDPStageName, trace, addrs...), nil
 }
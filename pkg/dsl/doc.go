@@ -52,7 +52,11 @@
 // and conversion operations such as [MakeEndpointsForPort] and [NewEndpointPipeline]
 // that allow to compose DNS lookups and endpoint operations. In other words, all
 // you can build with the DSL is a tree that you can visit to measure the internet. There
-// are no loops and there are no conditional statements.
+// are no general purpose loops and conditional statements. The only loops are bounded by
+// the AST arguments (e.g., the number of attempts of [Retry] and the maximum number of
+// redirects of [HTTPFollowRedirects]) and the only conditional behavior is deciding
+// which stages not to run, either because a previous stage succeeded (e.g., [FirstSuccess]
+// and [HappyEyeballs]) or because the deadline set by [Deadline] expired.
 //
 // # Writing filters
 //
@@ -72,7 +76,8 @@
 // class of errors using the [IsErrException] predicate);
 //
 // 2. [ErrSkip] indicates that a previous stage determined that subsequent stages should
-// not run (you can use [IsErrSkip] for this class of errors);
+// not run or that a stage did not run because the [Deadline] expired (you can use
+// [IsErrSkip] for this class of errors);
 //
 // 3. [ErrDNSLookup] means a DNS lookup failed (you can use [IsErrDNSLookup]);
 //
@@ -82,7 +87,15 @@
 //
 // 6. [ErrQUICHandshake] relates to QUIC handhsake failures (use [IsErrQUICHandshake]);
 //
-// 7. [ErrHTTPTransaction] is an HTTP transaction error (use [IsErrHTTPTransaction]).
+// 7. [ErrHTTPTransaction] is an HTTP transaction error (use [IsErrHTTPTransaction]);
+//
+// 8. [ErrTCPExchange] means exchanging data over a TCP or TLS connection failed (use [IsErrTCPExchange]);
+//
+// 9. [ErrUDPExchange] means exchanging datagrams with a UDP endpoint failed (use [IsErrUDPExchange]);
+//
+// 10. [ErrHTTPConnection] means we could not use a connection for HTTP (use [IsErrHTTPConnection]);
+//
+// 11. [ErrWebSocketExchange] means a WebSocket upgrade or exchange failed (use [IsErrWebSocketExchange]).
 //
 // You SHOULD only flip test keys when the error you set corresponds to the operation for
 // which you are filtering errors. For example, if you filter the results of a TLS handshake,
@@ -0,0 +1,70 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// FilterEndpointsByALPN returns a filter that only keeps the endpoints whose ALPN hints
+// include the given ALPN value (e.g., "h3"). Use this filter along with [DNSLookupQuery]
+// for HTTPS records and [MakeEndpointsForPort] to find HTTP/3 endpoints.
+func FilterEndpointsByALPN(alpn string) Stage[[]*Endpoint, []*Endpoint] {
+	return &filterEndpointsByALPNStage{alpn}
+}
+
+type filterEndpointsByALPNStage struct {
+	ALPN string `json:"alpn"`
+}
+
+const filterEndpointsByALPNStageName = "filter_endpoints_by_alpn"
+
+// ASTNode implements Stage.
+func (sx *filterEndpointsByALPNStage) ASTNode() *SerializableASTNode {
+	// Note: we serialize the structure because this gives us forward compatibility (i.e., we
+	// may add a field to a future version without breaking the AST structure and old probes will
+	// be fine as long as the zero value of the new field is the default)
+	return &SerializableASTNode{
+		StageName: filterEndpointsByALPNStageName,
+		Arguments: sx,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type filterEndpointsByALPNLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*filterEndpointsByALPNLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var stage filterEndpointsByALPNStage
+	if err := json.Unmarshal(node.Arguments, &stage); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	return &StageRunnableASTNode[[]*Endpoint, []*Endpoint]{&stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*filterEndpointsByALPNLoader) StageName() string {
+	return filterEndpointsByALPNStageName
+}
+
+// Run implements Stage.
+func (sx *filterEndpointsByALPNStage) Run(ctx context.Context, rtx Runtime, input Maybe[[]*Endpoint]) Maybe[[]*Endpoint] {
+	if input.Error != nil {
+		return NewError[[]*Endpoint](input.Error)
+	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[[]*Endpoint](err)
+	}
+	var output []*Endpoint
+	for _, epnt := range input.Value {
+		for _, value := range epnt.ALPN {
+			if value == sx.ALPN {
+				output = append(output, epnt)
+				break
+			}
+		}
+	}
+	return NewValue(output)
+}
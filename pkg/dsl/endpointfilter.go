@@ -0,0 +1,203 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"sort"
+
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// AddressFilterOption is an option for [FilterEndpoints] and [FilterDNSLookupResult].
+type AddressFilterOption func(config *addressFilterConfig)
+
+// AddressFilterOptionFamily only keeps the addresses of the given family, which must
+// be either "ipv4" or "ipv6". By default, we keep the addresses of both families.
+func AddressFilterOptionFamily(value string) AddressFilterOption {
+	return func(config *addressFilterConfig) {
+		config.Family = value
+	}
+}
+
+// AddressFilterOptionBogons configures what to do with bogon addresses (i.e., private,
+// reserved, and loopback addresses as classified by [netxlite.IsBogon]). Use "drop" to
+// remove them and "flag" to mark them as bogons. By default, we do nothing.
+func AddressFilterOptionBogons(value string) AddressFilterOption {
+	return func(config *addressFilterConfig) {
+		config.Bogons = value
+	}
+}
+
+// AddressFilterOptionMax keeps at most the given number of addresses. By default, we
+// keep the first addresses (see also [AddressFilterOptionRandomSeed]). When the value is
+// zero or negative, we keep all the addresses, which is the default.
+func AddressFilterOptionMax(value int) AddressFilterOption {
+	return func(config *addressFilterConfig) {
+		config.Max = value
+	}
+}
+
+// AddressFilterOptionRandomSeed configures [AddressFilterOptionMax] to randomly select the
+// addresses to keep using the given seed. The selected addresses keep their relative order.
+func AddressFilterOptionRandomSeed(value int64) AddressFilterOption {
+	return func(config *addressFilterConfig) {
+		config.Random = true
+		config.Seed = value
+	}
+}
+
+// TODO(bassosimone): we should probably autogenerate the config, the functional optional
+// setters, and the conversion from config to list of options.
+
+type addressFilterConfig struct {
+	Bogons string `json:"bogons,omitempty"`
+	Family string `json:"family,omitempty"`
+	Max    int    `json:"max,omitempty"`
+	Random bool   `json:"random,omitempty"`
+	Seed   int64  `json:"seed,omitempty"`
+}
+
+// newAddressFilterConfig creates a new config using the given options.
+func newAddressFilterConfig(options ...AddressFilterOption) addressFilterConfig {
+	var config addressFilterConfig
+	for _, option := range options {
+		option(&config)
+	}
+	return config
+}
+
+// validate returns an [ErrException] when the config is invalid.
+func (c *addressFilterConfig) validate() error {
+	switch c.Family {
+	case "", "ipv4", "ipv6":
+	default:
+		return &ErrException{&ErrInvalidAddressFamily{c.Family}}
+	}
+	switch c.Bogons {
+	case "", "drop", "flag":
+	default:
+		return &ErrException{&ErrInvalidBogonsAction{c.Bogons}}
+	}
+	return nil
+}
+
+// filter returns the indexes of the given IP addresses we should keep, in ascending order.
+func (c *addressFilterConfig) filter(addrs ...string) (keep []int) {
+	for idx, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		if c.Family == "ipv4" && ip.To4() == nil {
+			continue
+		}
+		if c.Family == "ipv6" && ip.To4() != nil {
+			continue
+		}
+		if c.Bogons == "drop" && netxlite.IsBogon(addr) {
+			continue
+		}
+		keep = append(keep, idx)
+	}
+	if c.Max <= 0 || len(keep) <= c.Max {
+		return keep
+	}
+	if !c.Random {
+		return keep[:c.Max]
+	}
+	var selected []int
+	for _, idx := range rand.New(rand.NewSource(c.Seed)).Perm(len(keep))[:c.Max] {
+		selected = append(selected, keep[idx])
+	}
+	sort.Ints(selected)
+	return selected
+}
+
+// isFlaggedBogon returns whether we should flag the given IP address as a bogon.
+func (c *addressFilterConfig) isFlaggedBogon(addr string) bool {
+	return c.Bogons == "flag" && netxlite.IsBogon(addr)
+}
+
+// FilterEndpoints returns a stage that filters the endpoints given in input according to
+// the given options. We first filter by address family, then we handle bogons, and finally
+// we select at most the configured number of endpoints. Flagged bogon endpoints have the
+// Bogon field set to true. Use this stage after [MakeEndpointsForPort].
+func FilterEndpoints(options ...AddressFilterOption) Stage[[]*Endpoint, []*Endpoint] {
+	return &filterEndpointsStage{newAddressFilterConfig(options...)}
+}
+
+type filterEndpointsStage struct {
+	config addressFilterConfig
+}
+
+const filterEndpointsStageName = "filter_endpoints"
+
+// ASTNode implements Stage.
+func (sx *filterEndpointsStage) ASTNode() *SerializableASTNode {
+	// Note: we serialize the structure because this gives us forward compatibility (i.e., we
+	// may add a field to a future version without breaking the AST structure and old probes will
+	// be fine as long as the zero value of the new field is the default)
+	return &SerializableASTNode{
+		StageName: filterEndpointsStageName,
+		Arguments: &sx.config,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type filterEndpointsLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*filterEndpointsLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var config addressFilterConfig
+	if err := json.Unmarshal(node.Arguments, &config); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := &filterEndpointsStage{config}
+	return &StageRunnableASTNode[[]*Endpoint, []*Endpoint]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*filterEndpointsLoader) StageName() string {
+	return filterEndpointsStageName
+}
+
+// Run implements Stage.
+func (sx *filterEndpointsStage) Run(ctx context.Context, rtx Runtime, input Maybe[[]*Endpoint]) Maybe[[]*Endpoint] {
+	if input.Error != nil {
+		return NewError[[]*Endpoint](input.Error)
+	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[[]*Endpoint](err)
+	}
+	if err := sx.config.validate(); err != nil {
+		return NewError[[]*Endpoint](err)
+	}
+
+	// extract the IP address of each endpoint
+	var addrs []string
+	for _, epnt := range input.Value {
+		addr, _, err := net.SplitHostPort(epnt.Address)
+		if err != nil {
+			return NewError[[]*Endpoint](&ErrException{&ErrInvalidEndpoint{epnt.Address}})
+		}
+		addrs = append(addrs, addr)
+	}
+
+	// create the output without modifying the input endpoints
+	var output []*Endpoint
+	for _, idx := range sx.config.filter(addrs...) {
+		epnt := input.Value[idx]
+		if sx.config.isFlaggedBogon(addrs[idx]) {
+			flagged := *epnt
+			flagged.Bogon = true
+			epnt = &flagged
+		}
+		output = append(output, epnt)
+	}
+	return NewValue(output)
+}
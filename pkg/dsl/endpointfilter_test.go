@@ -0,0 +1,130 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestFilterEndpoints(t *testing.T) {
+	// newEndpoints creates endpoints for the given addresses
+	newEndpoints := func(addrs ...string) (out []*Endpoint) {
+		result := newDNSLookupResult("www.example.com", dnsLookupStaticStageName, nil, addrs...)
+		maybe := MakeEndpointsForPort(443).Run(context.Background(), NewMinimalRuntime(log.Log), NewValue(result))
+		return runtimex.Try1(maybe.Value, maybe.Error)
+	}
+
+	// runFilter serializes and loads the filter and then runs it with the given endpoints
+	runFilter := func(endpoints []*Endpoint, options ...AddressFilterOption) Maybe[[]*Endpoint] {
+		rawAST := runtimex.Try1(json.Marshal(FilterEndpoints(options...).ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+		rtx := NewMinimalRuntime(log.Log)
+		output := runnable.Run(context.Background(), rtx, NewValue(endpoints).AsGeneric())
+		xoutput, except := AsSpecificMaybe[[]*Endpoint](output)
+		runtimex.Assert(except == nil, "unexpected type")
+		return xoutput
+	}
+
+	// addresses returns the addresses of the given endpoints
+	addresses := func(endpoints []*Endpoint) (out []string) {
+		for _, epnt := range endpoints {
+			out = append(out, epnt.Address)
+		}
+		return
+	}
+
+	endpoints := newEndpoints("130.192.91.211", "10.0.0.1", "2001:4860:4860::8888", "127.0.0.1", "8.8.8.8")
+
+	type testcase struct {
+		name    string
+		options []AddressFilterOption
+		expect  []string
+	}
+
+	cases := []testcase{{
+		name:    "we can only keep IPv4 endpoints",
+		options: []AddressFilterOption{AddressFilterOptionFamily("ipv4")},
+		expect:  []string{"130.192.91.211:443", "10.0.0.1:443", "127.0.0.1:443", "8.8.8.8:443"},
+	}, {
+		name:    "we can only keep IPv6 endpoints",
+		options: []AddressFilterOption{AddressFilterOptionFamily("ipv6")},
+		expect:  []string{"[2001:4860:4860::8888]:443"},
+	}, {
+		name:    "we can drop bogons",
+		options: []AddressFilterOption{AddressFilterOptionBogons("drop")},
+		expect:  []string{"130.192.91.211:443", "[2001:4860:4860::8888]:443", "8.8.8.8:443"},
+	}, {
+		name:    "we can take the first endpoints",
+		options: []AddressFilterOption{AddressFilterOptionMax(2)},
+		expect:  []string{"130.192.91.211:443", "10.0.0.1:443"},
+	}, {
+		name: "we apply the maximum after the other filters",
+		options: []AddressFilterOption{
+			AddressFilterOptionFamily("ipv4"),
+			AddressFilterOptionBogons("drop"),
+			AddressFilterOptionMax(5),
+		},
+		expect: []string{"130.192.91.211:443", "8.8.8.8:443"},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := runFilter(endpoints, tc.options...)
+			if output.Error != nil {
+				t.Fatal(output.Error)
+			}
+			if diff := cmp.Diff(tc.expect, addresses(output.Value)); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("we can flag bogons", func(t *testing.T) {
+		output := runFilter(endpoints, AddressFilterOptionBogons("flag"))
+		if output.Error != nil {
+			t.Fatal(output.Error)
+		}
+		var flagged []string
+		for _, epnt := range output.Value {
+			if epnt.Bogon {
+				flagged = append(flagged, epnt.Address)
+			}
+		}
+		expect := []string{"10.0.0.1:443", "127.0.0.1:443"}
+		if diff := cmp.Diff(expect, flagged); diff != "" {
+			t.Fatal(diff)
+		}
+		for _, epnt := range endpoints {
+			if epnt.Bogon {
+				t.Fatal("we should not modify the input endpoints")
+			}
+		}
+	})
+
+	t.Run("random sampling is deterministic given the seed", func(t *testing.T) {
+		first := runFilter(endpoints, AddressFilterOptionMax(3), AddressFilterOptionRandomSeed(4))
+		second := runFilter(endpoints, AddressFilterOptionMax(3), AddressFilterOptionRandomSeed(4))
+		if first.Error != nil || second.Error != nil {
+			t.Fatal(first.Error, second.Error)
+		}
+		if len(first.Value) != 3 {
+			t.Fatal("expected three endpoints")
+		}
+		if diff := cmp.Diff(addresses(first.Value), addresses(second.Value)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we return an exception with an invalid family", func(t *testing.T) {
+		output := runFilter(endpoints, AddressFilterOptionFamily("antani"))
+		if !IsErrException(output.Error) {
+			t.Fatal("not an ErrException", output.Error)
+		}
+	})
+}
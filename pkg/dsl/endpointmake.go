@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"net"
 	"strconv"
+	"strings"
 )
 
 // MakeEndpointsForPort returns a stage that converts the results of a DNS lookup to a list
-// of transport layer endpoints ready to be measured using a dedicated pipeline.
+// of transport layer endpoints ready to be measured using a dedicated pipeline. The endpoints
+// carry the ALPN hints of the HTTPS and SVCB answers (see [DNSLookupQuery]) for their address.
 func MakeEndpointsForPort(port uint16) Stage[*DNSLookupResult, []*Endpoint] {
 	return &makeEndpointsForPortStage{port}
 }
@@ -55,18 +57,115 @@ func (sx *makeEndpointsForPortStage) Run(ctx context.Context, rtx Runtime, input
 	if input.Error != nil {
 		return NewError[[]*Endpoint](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[[]*Endpoint](err)
+	}
 
-	// make sure we remove duplicates
+	// make sure we remove duplicates while preserving the order of the addresses
 	uniq := make(map[string]bool)
+	var output []*Endpoint
 	for _, addr := range input.Value.Addresses {
+		if uniq[addr] {
+			continue
+		}
 		uniq[addr] = true
-	}
-
-	var output []*Endpoint
-	for addr := range uniq {
 		output = append(output, &Endpoint{
-			Address: net.JoinHostPort(addr, strconv.Itoa(int(sx.Port))),
-			Domain:  input.Value.Domain})
+			Address:    net.JoinHostPort(addr, strconv.Itoa(int(sx.Port))),
+			ALPN:       sx.alpnHints(input.Value.Domain, addr, input.Value.Answers...),
+			Bogon:      input.Value.isBogon(addr),
+			Domain:     input.Value.Domain,
+			Provenance: dnsAddressProvenance(addr, input.Value.Provenance...),
+		})
 	}
 	return NewValue(output)
 }
+
+// dnsAddressProvenance returns the provenance entries for the given address.
+func dnsAddressProvenance(addr string, provenance ...*DNSAddressProvenance) (out []*DNSAddressProvenance) {
+	for _, entry := range provenance {
+		if entry.Address == addr {
+			out = append(out, entry)
+		}
+	}
+	return
+}
+
+// alpnHints returns the unique ALPN values inside the HTTPS and SVCB answers whose target is one
+// of the names of the given address (see [dnsAddressNames]). We skip the answers specifying a
+// port other than the one of this stage, since their ALPN values do not apply to our endpoints.
+func (sx *makeEndpointsForPortStage) alpnHints(domain, addr string, answers ...*DNSAnswer) (out []string) {
+	names := dnsAddressNames(domain, addr, answers...)
+	uniq := make(map[string]bool)
+	for _, answer := range answers {
+		if answer.Type != "HTTPS" && answer.Type != "SVCB" {
+			continue
+		}
+		if answer.Port != 0 && answer.Port != sx.Port {
+			continue
+		}
+		if !names[dnsServiceTarget(answer)] {
+			continue
+		}
+		for _, value := range answer.ALPN {
+			if !uniq[value] {
+				uniq[value] = true
+				out = append(out, value)
+			}
+		}
+	}
+	return
+}
+
+// dnsAddressNames returns the normalized names of the given address, i.e., the names of the
+// A and AAAA answers containing it and the targets of the HTTPS and SVCB answers containing it
+// as an IP hint, along with the names pointing to such names through CNAME answers. We assume
+// that an address without such answers (e.g., from a static lookup) belongs to the domain.
+func dnsAddressNames(domain, addr string, answers ...*DNSAnswer) map[string]bool {
+	names := make(map[string]bool)
+	for _, answer := range answers {
+		switch {
+		case (answer.Type == "A" || answer.Type == "AAAA") && answer.Address == addr:
+			names[dnsNormalizeName(answer.Name)] = true
+		case dnsHasIPHint(answer, addr):
+			names[dnsServiceTarget(answer)] = true
+		}
+	}
+	if len(names) <= 0 {
+		names[dnsNormalizeName(domain)] = true
+	}
+	for added := true; added; {
+		added = false
+		for _, answer := range answers {
+			name := dnsNormalizeName(answer.Name)
+			if answer.Type == "CNAME" && names[dnsNormalizeName(answer.Target)] && !names[name] {
+				names[name] = true
+				added = true
+			}
+		}
+	}
+	return names
+}
+
+// dnsServiceTarget returns the normalized name of the node providing the service described
+// by an HTTPS or SVCB answer, where the "." target means the name of the answer itself.
+func dnsServiceTarget(answer *DNSAnswer) string {
+	if answer.Target == "" || answer.Target == "." {
+		return dnsNormalizeName(answer.Name)
+	}
+	return dnsNormalizeName(answer.Target)
+}
+
+// dnsHasIPHint returns whether the given address is among the answer IP hints.
+func dnsHasIPHint(answer *DNSAnswer, addr string) bool {
+	for _, hint := range answer.IPHints {
+		if hint == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsNormalizeName returns the lowercase name without the trailing dot.
+func dnsNormalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
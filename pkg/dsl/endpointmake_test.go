@@ -0,0 +1,102 @@
+package dsl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMakeEndpointsForPort(t *testing.T) {
+	t.Run("we only use the ALPN hints of the target of each endpoint", func(t *testing.T) {
+		input := &DNSLookupResult{
+			Addresses: []string{"130.192.91.211", "93.184.216.34", "104.16.0.1", "10.0.0.1"},
+			Answers: []*DNSAnswer{{
+				Type:    "A",
+				Name:    "www.example.com.",
+				Address: "130.192.91.211",
+			}, {
+				Type:   "CNAME",
+				Name:   "www.example.com.",
+				Target: "alias.example.com.",
+			}, {
+				Type:    "A",
+				Name:    "alias.example.com.",
+				Address: "93.184.216.34",
+			}, {
+				Type:    "A",
+				Name:    "cdn.example.net.",
+				Address: "104.16.0.1",
+			}, {
+				Type:   "HTTPS",
+				Name:   "www.example.com.",
+				Target: ".",
+				ALPN:   []string{"h2"},
+			}, {
+				Type:   "HTTPS",
+				Name:   "www.example.com.",
+				Target: "cdn.example.net.",
+				ALPN:   []string{"h3"},
+			}, {
+				Type:    "HTTPS",
+				Name:    "www.example.com.",
+				Target:  "other.example.net.",
+				ALPN:    []string{"http/1.1"},
+				IPHints: []string{"10.0.0.1"},
+			}, {
+				Type:   "HTTPS",
+				Name:   "www.example.com.",
+				Target: ".",
+				Port:   8443,
+				ALPN:   []string{"h3"},
+			}},
+			Domain: "www.example.com",
+		}
+
+		rtx := NewMinimalRuntime(log.Log)
+		results := MakeEndpointsForPort(443).Run(context.Background(), rtx, NewValue(input))
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		expect := map[string][]string{
+			"130.192.91.211:443": {"h2"},
+			"93.184.216.34:443":  {"h2"},
+			"104.16.0.1:443":     {"h3"},
+			"10.0.0.1:443":       {"http/1.1"},
+		}
+		got := make(map[string][]string)
+		for _, epnt := range results.Value {
+			got[epnt.Address] = epnt.ALPN
+		}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we assume that addresses without answers belong to the domain", func(t *testing.T) {
+		input := &DNSLookupResult{
+			Addresses: []string{"130.192.91.211"},
+			Answers: []*DNSAnswer{{
+				Type:   "HTTPS",
+				Name:   "www.example.com.",
+				Target: ".",
+				ALPN:   []string{"h3", "h2"},
+			}},
+			Domain: "www.example.com",
+		}
+
+		rtx := NewMinimalRuntime(log.Log)
+		results := MakeEndpointsForPort(443).Run(context.Background(), rtx, NewValue(input))
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		if len(results.Value) != 1 {
+			t.Fatal("expected a single endpoint")
+		}
+		if diff := cmp.Diff([]string{"h3", "h2"}, results.Value[0].ALPN); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -1,5 +1,7 @@
 package dsl
 
+import "fmt"
+
 // Endpoint is a network endpoint.
 type Endpoint struct {
 	// Address is the endpoint address consisting of an IP address
@@ -13,6 +15,36 @@ type Endpoint struct {
 	// are valid UDP-resolver-endpoint addresses.
 	Address string
 
+	// ALPN contains the OPTIONAL ALPN hints for the endpoint (e.g., the ALPN
+	// values inside the HTTPS answers returned by [DNSLookupQuery]).
+	ALPN []string
+
+	// Bogon indicates that [FilterEndpoints] or [FilterDNSLookupResult] flagged the
+	// endpoint IP address as a bogon. Stages measuring the endpoint add the "bogon=true"
+	// tag to their observations (see [Endpoint.tags]).
+	Bogon bool
+
 	// Domain is the domain associated with the endpoint.
 	Domain string
+
+	// Provenance contains the OPTIONAL provenance of the endpoint IP address (i.e.,
+	// which resolvers returned it). Stages measuring the endpoint add a tag for
+	// each entry to their observations (see [Endpoint.tags]).
+	Provenance []*DNSAddressProvenance
+}
+
+// tags returns a copy of the given tags followed by one "address_provenance=<stage>#<index>"
+// tag for each resolver stage that returned the endpoint IP address. We use the trace index
+// because it allows matching the tag with the corresponding DNS observations. When the endpoint
+// is a flagged bogon, we also add the "bogon=true" tag.
+func (e *Endpoint) tags(tags ...string) []string {
+	out := append([]string{}, tags...)
+	if e.Bogon {
+		out = append(out, "bogon=true")
+	}
+	for _, provenance := range e.Provenance {
+		out = append(out, fmt.Sprintf(
+			"address_provenance=%s#%d", provenance.StageName, provenance.TraceIndex))
+	}
+	return out
 }
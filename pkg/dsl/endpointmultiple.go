@@ -2,18 +2,31 @@ package dsl
 
 import (
 	"context"
+	"encoding/json"
 )
 
 // MeasureMultipleEndpoints returns a stage that runs several endpoint measurement
-// pipelines in parallel using a pool of background goroutines.
+// pipelines in parallel using a pool of background goroutines. This function is equivalent
+// to calling [MeasureMultipleEndpointsWithParallelism] with zero parallelism.
 func MeasureMultipleEndpoints(stages ...Stage[*DNSLookupResult, *Void]) Stage[*DNSLookupResult, *Void] {
-	return &measureMultipleEndpointsStage{stages}
+	return MeasureMultipleEndpointsWithParallelism(0, stages...)
+}
+
+// MeasureMultipleEndpointsWithParallelism is like [MeasureMultipleEndpoints] but allows to
+// configure the number of background goroutines. When parallelism is zero or negative, we
+// use two background goroutines.
+func MeasureMultipleEndpointsWithParallelism(
+	parallelism int, stages ...Stage[*DNSLookupResult, *Void]) Stage[*DNSLookupResult, *Void] {
+	return &measureMultipleEndpointsStage{parallelArguments{parallelism}, stages}
 }
 
 type measureMultipleEndpointsStage struct {
+	args   parallelArguments
 	stages []Stage[*DNSLookupResult, *Void]
 }
 
+const measureMultipleEndpointsDefaultParallelism = 2
+
 const measureMultipleEndpointsStageName = "measure_multiple_endpoints"
 
 // ASTNode implements Stage.
@@ -24,7 +37,7 @@ func (sx *measureMultipleEndpointsStage) ASTNode() *SerializableASTNode {
 	}
 	return &SerializableASTNode{
 		StageName: measureMultipleEndpointsStageName,
-		Arguments: nil,
+		Arguments: &sx.args,
 		Children:  nodes,
 	}
 }
@@ -33,7 +46,8 @@ type measureMultipleEndpointsLoader struct{}
 
 // Load implements ASTLoaderRule.
 func (*measureMultipleEndpointsLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
-	if err := loader.LoadEmptyArguments(node); err != nil {
+	var args parallelArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
 		return nil, err
 	}
 	runnables, err := loader.LoadChildren(node)
@@ -41,7 +55,7 @@ func (*measureMultipleEndpointsLoader) Load(loader *ASTLoader, node *LoadableAST
 		return nil, err
 	}
 	children := RunnableASTNodeListToStageList[*DNSLookupResult, *Void](runnables...)
-	stage := MeasureMultipleEndpoints(children...)
+	stage := MeasureMultipleEndpointsWithParallelism(args.Parallelism, children...)
 	return &StageRunnableASTNode[*DNSLookupResult, *Void]{stage}, nil
 }
 
@@ -55,6 +69,9 @@ func (sx *measureMultipleEndpointsStage) Run(ctx context.Context, rtx Runtime, i
 	if input.Error != nil {
 		return NewError[*Void](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*Void](err)
+	}
 
 	// initialize the workers
 	var workers []Worker[Maybe[*Void]]
@@ -63,8 +80,8 @@ func (sx *measureMultipleEndpointsStage) Run(ctx context.Context, rtx Runtime, i
 	}
 
 	// parallel run
-	const parallelism = 2
-	results := ParallelRun(ctx, parallelism, workers...)
+	parallelism := sx.args.parallelismOrDefault(measureMultipleEndpointsDefaultParallelism)
+	results := ParallelRunWithConcurrencyBudget(ctx, rtx.ConcurrencyBudget(), parallelism, workers...)
 
 	// route exceptions
 	if err := catch(results...); err != nil {
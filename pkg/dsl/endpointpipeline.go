@@ -2,27 +2,39 @@ package dsl
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/ooni/probe-engine/pkg/runtimex"
 )
 
 // NewEndpointPipeline returns a stage that measures each endpoint given in input in
-// parallel using a pool of background goroutines.
+// parallel using a pool of background goroutines. This function is equivalent to
+// calling [NewEndpointPipelineWithParallelism] with zero parallelism.
 func NewEndpointPipeline(stage Stage[*Endpoint, *Void]) Stage[[]*Endpoint, *Void] {
-	return &newEndpointPipelineStage{stage}
+	return NewEndpointPipelineWithParallelism(0, stage)
+}
+
+// NewEndpointPipelineWithParallelism is like [NewEndpointPipeline] but allows to configure
+// the number of background goroutines. When parallelism is zero or negative, we use two
+// background goroutines.
+func NewEndpointPipelineWithParallelism(parallelism int, stage Stage[*Endpoint, *Void]) Stage[[]*Endpoint, *Void] {
+	return &newEndpointPipelineStage{parallelArguments{parallelism}, stage}
 }
 
 type newEndpointPipelineStage struct {
-	sx Stage[*Endpoint, *Void]
+	args parallelArguments
+	sx   Stage[*Endpoint, *Void]
 }
 
+const newEndpointPipelineDefaultParallelism = 2
+
 const newEndpointPipelineStageName = "new_endpoint_pipeline"
 
 func (sx *newEndpointPipelineStage) ASTNode() *SerializableASTNode {
 	node := sx.sx.ASTNode()
 	return &SerializableASTNode{
 		StageName: newEndpointPipelineStageName,
-		Arguments: nil,
+		Arguments: &sx.args,
 		Children:  []*SerializableASTNode{node},
 	}
 }
@@ -31,7 +43,8 @@ type newEndpointPipelineLoader struct{}
 
 // Load implements ASTLoaderRule.
 func (*newEndpointPipelineLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
-	if err := loader.LoadEmptyArguments(node); err != nil {
+	var args parallelArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
 		return nil, err
 	}
 	runnables, err := loader.LoadChildren(node)
@@ -43,7 +56,7 @@ func (*newEndpointPipelineLoader) Load(loader *ASTLoader, node *LoadableASTNode)
 	}
 	children := RunnableASTNodeListToStageList[*Endpoint, *Void](runnables[0])
 	runtimex.Assert(len(children) == 1, "unexpected number of children")
-	stage := NewEndpointPipeline(children[0])
+	stage := NewEndpointPipelineWithParallelism(args.Parallelism, children[0])
 	return &StageRunnableASTNode[[]*Endpoint, *Void]{stage}, nil
 }
 
@@ -56,6 +69,9 @@ func (sx *newEndpointPipelineStage) Run(ctx context.Context, rtx Runtime, input
 	if input.Error != nil {
 		return NewError[*Void](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*Void](err)
+	}
 
 	// create list of workers
 	var workers []Worker[Maybe[*Void]]
@@ -64,8 +80,8 @@ func (sx *newEndpointPipelineStage) Run(ctx context.Context, rtx Runtime, input
 	}
 
 	// perform the measurement in parallel
-	const parallelism = 2
-	results := ParallelRun(ctx, parallelism, workers...)
+	parallelism := sx.args.parallelismOrDefault(newEndpointPipelineDefaultParallelism)
+	results := ParallelRunWithConcurrencyBudget(ctx, rtx.ConcurrencyBudget(), parallelism, workers...)
 
 	// route exceptions
 	if err := catch(results...); err != nil {
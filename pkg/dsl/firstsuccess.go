@@ -0,0 +1,75 @@
+package dsl
+
+import (
+	"context"
+)
+
+// FirstSuccess returns a stage that runs the given stages in order and returns the result of
+// the first stage that succeeds. For example, you can use this stage to use [DNSLookupGetaddrinfo]
+// and to fallback to [DNSLookupUDP] and then to [DNSLookupStatic] on failure. The stages that
+// fail still save their [Observations]. When all the stages fail, this stage returns the result
+// of the last stage. When a stage fails with an [ErrException], this stage immediately returns
+// the [ErrException] without running the remaining stages.
+func FirstSuccess[A, B any](stages ...Stage[A, B]) Stage[A, B] {
+	return &firstSuccessStage[A, B]{stages}
+}
+
+type firstSuccessStage[A, B any] struct {
+	stages []Stage[A, B]
+}
+
+const firstSuccessStageName = "first_success"
+
+// ASTNode implements Stage.
+func (sx *firstSuccessStage[A, B]) ASTNode() *SerializableASTNode {
+	var nodes []*SerializableASTNode
+	for _, stage := range sx.stages {
+		nodes = append(nodes, stage.ASTNode())
+	}
+	return &SerializableASTNode{
+		StageName: firstSuccessStageName,
+		Arguments: nil,
+		Children:  nodes,
+	}
+}
+
+type firstSuccessLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*firstSuccessLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	if err := loader.LoadEmptyArguments(node); err != nil {
+		return nil, err
+	}
+	if len(node.Children) < 1 {
+		return nil, ErrInvalidNumberOfChildren
+	}
+	runnables, err := loader.LoadChildren(node)
+	if err != nil {
+		return nil, err
+	}
+	// Note: like composeStage, firstSuccessStage does not create any Maybe when it has
+	// at least one child and so we can use `any` because the children create correctly
+	// typed Maybes.
+	children := RunnableASTNodeListToStageList[any, any](runnables...)
+	return FirstSuccess(children...), nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*firstSuccessLoader) StageName() string {
+	return firstSuccessStageName
+}
+
+// Run implements Stage.
+func (sx *firstSuccessStage[A, B]) Run(ctx context.Context, rtx Runtime, input Maybe[A]) Maybe[B] {
+	if len(sx.stages) <= 0 {
+		return NewError[B](NewErrException("dsl: FirstSuccess called with no stages"))
+	}
+	var output Maybe[B]
+	for _, stage := range sx.stages {
+		output = stage.Run(ctx, rtx, input)
+		if output.Error == nil || IsErrException(output.Error) {
+			break
+		}
+	}
+	return output
+}
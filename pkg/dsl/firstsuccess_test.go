@@ -0,0 +1,90 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestFirstSuccess(t *testing.T) {
+	// newClosedEndpoint returns an endpoint where the TCP connect always fails
+	newClosedEndpoint := func() string {
+		listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+		listener.Close()
+		return listener.Addr().String()
+	}
+
+	t.Run("we return the first success and keep the failures observations", func(t *testing.T) {
+		// serialize and load the pipeline
+		pipeline := FirstSuccess(
+			DNSLookupTCP(newClosedEndpoint()),
+			DNSLookupStatic("130.192.91.211"),
+			DNSLookupStatic("130.192.91.231"),
+		)
+		rawAST := runtimex.Try1(json.Marshal(pipeline.ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run the pipeline
+		rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		results := runnable.Run(context.Background(), rtx, NewValue("www.example.com").AsGeneric())
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		// make sure we get the result of the first successful stage
+		expect := []string{"130.192.91.211"}
+		if diff := cmp.Diff(expect, results.Value.(*DNSLookupResult).Addresses); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// make sure we have observations for the failed lookup
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		if len(observations.Queries) <= 0 {
+			t.Fatal("expected DNS lookup observations")
+		}
+		for _, entry := range observations.Queries {
+			if entry.Failure == nil {
+				t.Fatal("expected a failure")
+			}
+		}
+	})
+
+	t.Run("we return the last failure when all stages fail", func(t *testing.T) {
+		pipeline := FirstSuccess(
+			DNSLookupTCP(newClosedEndpoint()),
+			DNSLookupTCP(newClosedEndpoint()),
+		)
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, NewValue("www.example.com"))
+		if !IsErrDNSLookup(results.Error) {
+			t.Fatal("not an ErrDNSLookup", results.Error)
+		}
+	})
+
+	t.Run("we stop at the first exception", func(t *testing.T) {
+		pipeline := FirstSuccess(
+			DNSLookupStatic("antani"),
+			DNSLookupStatic("130.192.91.211"),
+		)
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, NewValue("www.example.com"))
+		if !IsErrException(results.Error) {
+			t.Fatal("not an ErrException", results.Error)
+		}
+	})
+
+	t.Run("we cannot load a node without children", func(t *testing.T) {
+		loadable := &LoadableASTNode{StageName: firstSuccessStageName, Arguments: []byte("{}")}
+		if _, err := NewASTLoader().Load(loadable); err != ErrInvalidNumberOfChildren {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// HappyEyeballs returns a stage that races the given stage across the endpoints given in input
+// like a web browser would do (see RFC 8305). We interleave the IPv6 and IPv4 endpoints, starting
+// with IPv6, and we start measuring the next endpoint after the given delay or as soon as the
+// previous attempt fails. When delay is zero or negative, we use 250 milliseconds.
+//
+// This stage returns the output of the first attempt that succeeds. Then, it cancels the attempts
+// that are still running and closes the connections of the attempts that succeed later. Because
+// each attempt saves its own [Observations], we keep the [Observations] of the losing attempts. When
+// all the attempts fail, this stage returns the error of the last attempt that failed. When an
+// attempt fails with an [ErrException], this stage stops racing and returns the [ErrException].
+//
+// Use this stage when you want to know whether a normal client could connect to a service
+// rather than whether each endpoint works (for which you should use [NewEndpointPipeline]).
+func HappyEyeballs[B any](delay time.Duration, stage Stage[*Endpoint, B]) Stage[[]*Endpoint, B] {
+	return &happyEyeballsStage[B]{happyEyeballsArguments{delay}, stage}
+}
+
+type happyEyeballsStage[B any] struct {
+	args  happyEyeballsArguments
+	stage Stage[*Endpoint, B]
+}
+
+type happyEyeballsArguments struct {
+	Delay time.Duration `json:"delay,omitempty"`
+}
+
+// happyEyeballsDefaultDelay is the default connection attempt delay (see RFC 8305 Sect. 8).
+const happyEyeballsDefaultDelay = 250 * time.Millisecond
+
+// delayOrDefault returns the configured delay or the default delay.
+func (args *happyEyeballsArguments) delayOrDefault() time.Duration {
+	if args.Delay <= 0 {
+		return happyEyeballsDefaultDelay
+	}
+	return args.Delay
+}
+
+const happyEyeballsStageName = "happy_eyeballs"
+
+// ASTNode implements Stage.
+func (sx *happyEyeballsStage[B]) ASTNode() *SerializableASTNode {
+	return &SerializableASTNode{
+		StageName: happyEyeballsStageName,
+		Arguments: &sx.args,
+		Children:  []*SerializableASTNode{sx.stage.ASTNode()},
+	}
+}
+
+type happyEyeballsLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*happyEyeballsLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var args happyEyeballsArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 1); err != nil {
+		return nil, err
+	}
+	runnable, err := loader.Load(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	// Note: happyEyeballsStage does not create any Maybe[B] because it always returns
+	// the output of the inner stage, which creates correctly-typed Maybes.
+	stage := HappyEyeballs[any](args.Delay, &RunnableASTNodeStage[*Endpoint, any]{runnable})
+	return &StageRunnableASTNode[[]*Endpoint, any]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*happyEyeballsLoader) StageName() string {
+	return happyEyeballsStageName
+}
+
+// Run implements Stage.
+func (sx *happyEyeballsStage[B]) Run(ctx context.Context, rtx Runtime, input Maybe[[]*Endpoint]) Maybe[B] {
+	// Note: we cannot create any Maybe[B] here because we may be a happyEyeballsStage[any]
+	// and hence we let the inner stage propagate errors using correctly-typed Maybes
+	if input.Error != nil {
+		return sx.stage.Run(ctx, rtx, NewError[*Endpoint](input.Error))
+	}
+	endpoints := happyEyeballsSortEndpoints(input.Value)
+	if len(endpoints) <= 0 {
+		return sx.stage.Run(ctx, rtx, NewError[*Endpoint](&ErrDNSLookup{netxlite.MaybeNewErrWrapper(
+			netxlite.ClassifyResolverError, netxlite.ResolveOperation, netxlite.ErrOODNSNoAnswer)}))
+	}
+
+	// race without holding a slot of the concurrency budget to avoid deadlocks
+	var output Maybe[B]
+	concurrencyBudgetLend(ctx, rtx.ConcurrencyBudget(), func() {
+		output = sx.race(ctx, rtx, endpoints)
+	})
+	return output
+}
+
+// race races the inner stage across the given, already sorted, endpoints.
+func (sx *happyEyeballsStage[B]) race(ctx context.Context, rtx Runtime, endpoints []*Endpoint) Maybe[B] {
+	// make sure we cancel the losing attempts when done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Note: the channel is buffered such that attempts never block
+	results := make(chan Maybe[B], len(endpoints))
+	budget := rtx.ConcurrencyBudget()
+	delay := sx.args.delayOrDefault()
+
+	var (
+		next    int
+		running int
+		timer   *time.Timer
+		ticker  <-chan time.Time
+	)
+
+	// start starts the next attempt and rearms the timer for the following one
+	start := func() {
+		endpoint := endpoints[next]
+		next++
+		running++
+		go func() {
+			results <- concurrencyBudgetRun(ctx, budget, func(ctx context.Context) Maybe[B] {
+				return sx.stage.Run(ctx, rtx, NewValue(endpoint))
+			})
+		}()
+		if timer != nil {
+			timer.Stop()
+			timer, ticker = nil, nil
+		}
+		if next < len(endpoints) {
+			timer = time.NewTimer(delay)
+			ticker = timer.C
+		}
+	}
+
+	var (
+		found  bool
+		winner Maybe[B]
+		failed Maybe[B]
+	)
+
+	// wait for all the attempts to terminate such that they have saved their observations
+	start()
+	for running > 0 {
+		select {
+		case <-ticker:
+			timer, ticker = nil, nil
+			start()
+
+		case output := <-results:
+			running--
+			switch {
+			case found:
+				if output.Error == nil {
+					happyEyeballsCloseLoser(output.Value)
+				}
+
+			case output.Error == nil || IsErrException(output.Error):
+				found, winner = true, output
+				if timer != nil {
+					timer.Stop()
+					timer, ticker = nil, nil
+				}
+				cancel()
+
+			default:
+				failed = output
+				if next < len(endpoints) {
+					start()
+				}
+			}
+		}
+	}
+
+	if found {
+		return winner
+	}
+	return failed
+}
+
+// happyEyeballsSortEndpoints returns a copy of the endpoints where we interleave IPv6 and IPv4
+// endpoints, starting with IPv6, while preserving the relative order of each address family.
+func happyEyeballsSortEndpoints(endpoints []*Endpoint) (out []*Endpoint) {
+	var ipv4, ipv6 []*Endpoint
+	for _, endpoint := range endpoints {
+		if happyEyeballsIsIPv6(endpoint) {
+			ipv6 = append(ipv6, endpoint)
+			continue
+		}
+		ipv4 = append(ipv4, endpoint)
+	}
+	for len(ipv6) > 0 || len(ipv4) > 0 {
+		if len(ipv6) > 0 {
+			out = append(out, ipv6[0])
+			ipv6 = ipv6[1:]
+		}
+		if len(ipv4) > 0 {
+			out = append(out, ipv4[0])
+			ipv4 = ipv4[1:]
+		}
+	}
+	return
+}
+
+// happyEyeballsIsIPv6 returns whether the endpoint address is an IPv6 address.
+func happyEyeballsIsIPv6(endpoint *Endpoint) bool {
+	address, _, err := net.SplitHostPort(endpoint.Address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() == nil
+}
+
+// happyEyeballsCloseLoser closes the connection contained by the output of an attempt that
+// succeeded after we selected the winner. The [Runtime] would anyway close the connection when
+// done, which is what happens for other types (e.g., [*HTTPConnection]), yet we want to close
+// the connection as soon as possible like a browser would do.
+func happyEyeballsCloseLoser(value any) {
+	switch conn := value.(type) {
+	case *TCPConnection:
+		conn.Conn.Close()
+	case *TLSConnection:
+		conn.Conn.Close()
+	case *QUICConnection:
+		conn.Conn.CloseWithError(0, "")
+	}
+}
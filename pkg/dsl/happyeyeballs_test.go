@@ -0,0 +1,101 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestHappyEyeballs(t *testing.T) {
+	// newClosedEndpoint returns an endpoint where the TCP connect always fails
+	newClosedEndpoint := func() *Endpoint {
+		listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+		listener.Close()
+		return &Endpoint{Address: listener.Addr().String(), Domain: "www.example.com"}
+	}
+
+	t.Run("we return the first success and keep the losers observations", func(t *testing.T) {
+		listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+		defer listener.Close()
+		endpoints := []*Endpoint{
+			newClosedEndpoint(),
+			newClosedEndpoint(),
+			{Address: listener.Addr().String(), Domain: "www.example.com"},
+		}
+
+		// serialize and load the pipeline using a large delay, which means that we
+		// can only make progress because we start a new attempt after a failure
+		pipeline := HappyEyeballs(time.Hour, TCPConnect())
+		rawAST := runtimex.Try1(json.Marshal(pipeline.ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run the pipeline
+		rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		defer rtx.Close()
+		results := runnable.Run(context.Background(), rtx, NewValue(endpoints).AsGeneric())
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		conn := results.Value.(*TCPConnection)
+		if conn.Address != listener.Addr().String() {
+			t.Fatal("unexpected address", conn.Address)
+		}
+
+		// make sure we have the observations of all the attempts
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		if len(observations.TCPConnect) != 3 {
+			t.Fatal("expected three TCP connect observations")
+		}
+	})
+
+	t.Run("we return the last failure when all attempts fail", func(t *testing.T) {
+		pipeline := HappyEyeballs(0, TCPConnect())
+		rtx := NewMinimalRuntime(log.Log)
+		endpoints := []*Endpoint{newClosedEndpoint(), newClosedEndpoint()}
+		results := pipeline.Run(context.Background(), rtx, NewValue(endpoints))
+		if !IsErrTCPConnect(results.Error) {
+			t.Fatal("not an ErrTCPConnect", results.Error)
+		}
+	})
+
+	t.Run("we return an ErrDNSLookup when there are no endpoints", func(t *testing.T) {
+		pipeline := HappyEyeballs(0, TCPConnect())
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, NewValue([]*Endpoint{}))
+		if !IsErrDNSLookup(results.Error) {
+			t.Fatal("not an ErrDNSLookup", results.Error)
+		}
+	})
+
+	t.Run("we interleave IPv6 and IPv4 endpoints starting with IPv6", func(t *testing.T) {
+		endpoints := []*Endpoint{
+			{Address: "130.192.91.211:443"},
+			{Address: "130.192.91.231:443"},
+			{Address: "[2001:4860:4860::8888]:443"},
+			{Address: "[2001:4860:4860::8844]:443"},
+			{Address: "[2001:4860:4860::6464]:443"},
+		}
+		var addresses []string
+		for _, endpoint := range happyEyeballsSortEndpoints(endpoints) {
+			addresses = append(addresses, endpoint.Address)
+		}
+		expect := []string{
+			"[2001:4860:4860::8888]:443",
+			"130.192.91.211:443",
+			"[2001:4860:4860::8844]:443",
+			"130.192.91.231:443",
+			"[2001:4860:4860::6464]:443",
+		}
+		if diff := cmp.Diff(expect, addresses); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
@@ -1,11 +1,12 @@
 package dsl
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
-	"time"
 
 	"github.com/ooni/probe-engine/pkg/measurexlite"
 	"github.com/ooni/probe-engine/pkg/model"
@@ -63,22 +64,22 @@ func (*httpTransactionLoader) StageName() string {
 
 // Run implements operation.
 func (op *httpTransactionOperation) Run(ctx context.Context, rtx Runtime, conn *HTTPConnection) (*HTTPResponse, error) {
-	// setup
-	const timeout = 10 * time.Second
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
 	// create configuration
 	config := &httpTransactionConfig{
 		AcceptHeader:                model.HTTPHeaderAccept,
 		AcceptLanguageHeader:        model.HTTPHeaderAcceptLanguage,
+		Headers:                     []*HTTPHeader{},
 		HostHeader:                  conn.Domain,
 		IncludeResponseBodySnapshot: false,
 		RefererHeader:               "",
+		RequestBodyBase64:           "",
+		RequestBodyText:             "",
 		RequestMethod:               "GET",
 		ResponseBodySnapshotSize:    1 << 19,
+		Timeout:                     defaultHTTPTransactionTimeout,
 		URLHost:                     conn.Domain,
 		URLPath:                     "/",
+		URLRawQuery:                 "",
 		URLScheme:                   conn.Scheme,
 		UserAgentHeader:             model.HTTPHeaderUserAgent,
 	}
@@ -86,12 +87,25 @@ func (op *httpTransactionOperation) Run(ctx context.Context, rtx Runtime, conn *
 		option(config)
 	}
 
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(config.Timeout, defaultHTTPTransactionTimeout))
+	defer cancel()
+
 	// create HTTP request
 	req, err := op.newHTTPRequest(ctx, config)
 	if err != nil {
 		return nil, &ErrException{err}
 	}
 
+	// make sure we write the list of headers in order, when possible
+	if conn.headerOrder != nil {
+		var names []string
+		for _, header := range config.Headers {
+			names = append(names, header.Name)
+		}
+		conn.headerOrder.set(names)
+	}
+
 	// start the operation logger
 	ol := measurexlite.NewOperationLogger(
 		rtx.Logger(),
@@ -131,6 +145,7 @@ func (op *httpTransactionOperation) Run(ctx context.Context, rtx Runtime, conn *
 	runtimex.Assert(resp != nil, "expected response to be non-nil here")
 	output := &HTTPResponse{
 		Address:              conn.Address,
+		ConnectionReused:     false,
 		Domain:               conn.Domain,
 		Network:              conn.Network,
 		Request:              req,
@@ -142,6 +157,11 @@ func (op *httpTransactionOperation) Run(ctx context.Context, rtx Runtime, conn *
 
 func (op *httpTransactionOperation) newHTTPRequest(
 	ctx context.Context, config *httpTransactionConfig) (*http.Request, error) {
+	body, err := op.newHTTPRequestBody(config)
+	if err != nil {
+		return nil, err
+	}
+
 	URL := &url.URL{
 		Scheme:      config.URLScheme,
 		Opaque:      "",
@@ -150,12 +170,12 @@ func (op *httpTransactionOperation) newHTTPRequest(
 		Path:        config.URLPath,
 		RawPath:     "",
 		ForceQuery:  false,
-		RawQuery:    "",
+		RawQuery:    config.URLRawQuery,
 		Fragment:    "",
 		RawFragment: "",
 	}
 
-	req, err := http.NewRequestWithContext(ctx, config.RequestMethod, URL.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, config.RequestMethod, URL.String(), body)
 	if err != nil {
 		return nil, err
 	}
@@ -182,5 +202,31 @@ func (op *httpTransactionOperation) newHTTPRequest(
 		req.Header.Set("User-Agent", v)
 	}
 
+	// the list of headers replaces the headers with the same name
+	replaced := make(map[string]bool)
+	for _, header := range config.Headers {
+		name := http.CanonicalHeaderKey(header.Name)
+		if !replaced[name] {
+			replaced[name] = true
+			req.Header.Del(name)
+		}
+		req.Header.Add(name, header.Value)
+		if name == "Host" {
+			req.Host = header.Value
+		}
+	}
+
 	return req, nil
 }
+
+// newHTTPRequestBody returns the request body to use or nil when there's no body.
+func (op *httpTransactionOperation) newHTTPRequestBody(config *httpTransactionConfig) (io.Reader, error) {
+	body, err := decodeBase64OrText("request_body", config.RequestBodyBase64, config.RequestBodyText)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) <= 0 {
+		return nil, nil
+	}
+	return bytes.NewReader(body), nil
+}
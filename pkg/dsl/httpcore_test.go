@@ -1,11 +1,16 @@
 package dsl
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/apex/log"
@@ -85,4 +90,153 @@ func TestHTTPTransaction(t *testing.T) {
 			t.Fatal("not an ErrHTTPTransaction", results.Error)
 		}
 	})
+
+	t.Run("we send the configured headers, query and body", func(t *testing.T) {
+		// create a server that echoes what it received
+		srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body := runtimex.Try1(io.ReadAll(r.Body))
+			fmt.Fprintf(w, "%s %s?%s %v %s", r.Method, r.URL.Path, r.URL.RawQuery, r.Header["X-Antani"], body)
+		}))
+		defer srvr.Close()
+
+		// create a measurement pipeline
+		pipeline := Compose3(
+			TCPConnect(),
+			HTTPConnectionTCP(),
+			HTTPTransaction(
+				HTTPTransactionOptionMethod("POST"),
+				HTTPTransactionOptionURLPath("/api"),
+				HTTPTransactionOptionURLRawQuery("a=b&c=d"),
+				HTTPTransactionOptionHeader("X-Antani", "mascetti"),
+				HTTPTransactionOptionHeader("x-antani", "perozzi"),
+				HTTPTransactionOptionRequestBodyBase64("aGVsbG8sIHdvcmxk"),
+				HTTPTransactionOptionIncludeResponseBodySnapshot(true),
+			),
+		)
+
+		// create the endpoint
+		URL := runtimex.Try1(url.Parse(srvr.URL))
+		endpoint := NewValue(&Endpoint{
+			Address: URL.Host,
+			Domain:  "www.example.com",
+		})
+
+		// perform the measurement
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		// make sure the server received what we expected
+		expect := "POST /api?a=b&c=d [mascetti perozzi] hello, world"
+		if got := string(results.Value.ResponseBodySnapshot); got != expect {
+			t.Fatal("expected", expect, "got", got)
+		}
+	})
+
+	t.Run("we send the list of headers in order", func(t *testing.T) {
+		// create a server that echoes the names of the headers and the body it received
+		listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			var names []string
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == "\r\n" {
+					break
+				}
+				name, _, _ := strings.Cut(line, ":")
+				names = append(names, name)
+			}
+			body := make([]byte, len("hello, world"))
+			if _, err := io.ReadFull(reader, body); err != nil {
+				return
+			}
+			echo := fmt.Sprintf("%s %s", strings.Join(names[1:], ","), body)
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(echo), echo)
+		}()
+
+		// create a measurement pipeline
+		pipeline := Compose3(
+			TCPConnect(),
+			HTTPConnectionTCP(),
+			HTTPTransaction(
+				HTTPTransactionOptionMethod("POST"),
+				HTTPTransactionOptionHeader("X-Zeta", "1"),
+				HTTPTransactionOptionHeader("user-agent", "antani/1.0"),
+				HTTPTransactionOptionHeader("X-Alpha", "2"),
+				HTTPTransactionOptionHeader("X-Zeta", "3"),
+				HTTPTransactionOptionRequestBodyText("hello, world"),
+				HTTPTransactionOptionIncludeResponseBodySnapshot(true),
+			),
+		)
+
+		// create the endpoint
+		endpoint := NewValue(&Endpoint{
+			Address: listener.Addr().String(),
+			Domain:  "www.example.com",
+		})
+
+		// perform the measurement
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		// make sure the server received the headers in the expected order
+		expect := "Host,Content-Length,Accept,Accept-Language,X-Zeta,User-Agent,X-Alpha,X-Zeta hello, world"
+		if got := string(results.Value.ResponseBodySnapshot); got != expect {
+			t.Fatal("expected", expect, "got", got)
+		}
+	})
+
+	t.Run("we reject invalid request bodies", func(t *testing.T) {
+		options := [][]HTTPTransactionOption{{
+			HTTPTransactionOptionRequestBodyBase64("@@@"),
+		}, {
+			HTTPTransactionOptionRequestBodyBase64("aGVsbG8sIHdvcmxk"),
+			HTTPTransactionOptionRequestBodyText("hello, world"),
+		}}
+		for _, entry := range options {
+			conn := &HTTPConnection{
+				Address:   "127.0.0.1:80",
+				Domain:    "www.example.com",
+				Network:   "tcp",
+				Scheme:    "http",
+				Trace:     NewMinimalRuntime(log.Log).NewTrace(),
+				Transport: nil,
+			}
+			rtx := NewMinimalRuntime(log.Log)
+			results := HTTPTransaction(entry...).Run(context.Background(), rtx, NewValue(conn))
+			if !IsErrException(results.Error) {
+				t.Fatal("not an ErrException", results.Error)
+			}
+		}
+	})
+
+	t.Run("we reject setting both the base64 and the text request body", func(t *testing.T) {
+		config := &httpTransactionConfig{
+			RequestBodyBase64: "aGVsbG8sIHdvcmxk",
+			RequestBodyText:   "hello, world",
+		}
+		_, err := (&httpTransactionOperation{}).newHTTPRequestBody(config)
+		var conflict *ErrConflictingOptions
+		if !errors.As(err, &conflict) {
+			t.Fatal("not an ErrConflictingOptions", err)
+		}
+		if conflict.First != "request_body_base64" || conflict.Second != "request_body_text" {
+			t.Fatal("unexpected conflicting options", conflict)
+		}
+	})
 }
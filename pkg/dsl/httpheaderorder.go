@@ -0,0 +1,106 @@
+package dsl
+
+import (
+	"bytes"
+	"net"
+	"net/textproto"
+	"sync"
+
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// httpHeaderOrder reorders the headers of the HTTP/1.1 requests written on a connection. We
+// need to do this on the wire because Go sorts the headers by name when writing a request.
+type httpHeaderOrder struct {
+	buf   []byte
+	mu    sync.Mutex
+	names []string
+}
+
+// set configures the order of the headers of the next request written on the connection. We
+// write the headers in the given list in the order in which they appear, after the headers
+// that are not in the list. A nil or empty list means we should not reorder the headers.
+func (o *httpHeaderOrder) set(names []string) {
+	defer o.mu.Unlock()
+	o.mu.Lock()
+	o.buf, o.names = nil, nil
+	for _, name := range names {
+		o.names = append(o.names, textproto.CanonicalMIMEHeaderKey(name))
+	}
+}
+
+// write writes data using the given function. When we need to reorder the headers, we buffer
+// the data until we have read the whole request header and then we write the reordered request
+// header along with the data following it (e.g., the request body).
+func (o *httpHeaderOrder) write(writefn func(data []byte) (int, error), data []byte) (int, error) {
+	defer o.mu.Unlock()
+	o.mu.Lock()
+	if len(o.names) <= 0 {
+		return writefn(data)
+	}
+	o.buf = append(o.buf, data...)
+	idx := bytes.Index(o.buf, []byte("\r\n\r\n"))
+	if idx < 0 {
+		return len(data), nil
+	}
+	output := httpReorderHeaders(o.buf[:idx], o.names)
+	output = append(output, o.buf[idx:]...)
+	o.buf, o.names = nil, nil
+	if _, err := writefn(output); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// httpReorderHeaders reorders the header lines following the request line of the given request
+// header, which does not include the final empty line, as documented by [httpHeaderOrder.set].
+func httpReorderHeaders(header []byte, names []string) []byte {
+	listed := make(map[string][][]byte)
+	for _, name := range names {
+		listed[name] = nil
+	}
+	lines := bytes.Split(header, []byte("\r\n"))
+	output := [][]byte{lines[0]}
+	for _, line := range lines[1:] {
+		name, _, _ := bytes.Cut(line, []byte(":"))
+		key := textproto.CanonicalMIMEHeaderKey(string(bytes.TrimSpace(name)))
+		if _, found := listed[key]; !found {
+			output = append(output, line)
+			continue
+		}
+		listed[key] = append(listed[key], line)
+	}
+	for _, name := range names {
+		if values := listed[name]; len(values) > 0 {
+			output = append(output, values[0])
+			listed[name] = values[1:]
+		}
+	}
+	for _, name := range names { // should not happen but let's not lose any header
+		output = append(output, listed[name]...)
+		listed[name] = nil
+	}
+	return bytes.Join(output, []byte("\r\n"))
+}
+
+// httpHeaderOrderConn is a [net.Conn] using an [*httpHeaderOrder].
+type httpHeaderOrderConn struct {
+	net.Conn
+	order *httpHeaderOrder
+}
+
+// Write implements net.Conn.
+func (c *httpHeaderOrderConn) Write(data []byte) (int, error) {
+	return c.order.write(c.Conn.Write, data)
+}
+
+// httpHeaderOrderTLSConn is a [netxlite.TLSConn] using an [*httpHeaderOrder].
+type httpHeaderOrderTLSConn struct {
+	netxlite.TLSConn
+	order *httpHeaderOrder
+}
+
+// Write implements net.Conn.
+func (c *httpHeaderOrderTLSConn) Write(data []byte) (int, error) {
+	return c.order.write(c.TLSConn.Write, data)
+}
@@ -3,6 +3,7 @@ package dsl
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/ooni/probe-engine/pkg/model"
 )
@@ -18,6 +19,10 @@ type HTTPConnection struct {
 	// Network is the underlying con network ("tcp" or "udp").
 	Network string
 
+	// Protocol is the HTTP protocol we're using (one of [HTTPProtocolHTTP11],
+	// [HTTPProtocolH2], and [HTTPProtocolH3]).
+	Protocol string
+
 	// Scheme is the URL scheme to use.
 	Scheme string
 
@@ -29,6 +34,39 @@ type HTTPConnection struct {
 
 	// Transport is the HTTP transport wrapping the underlying conn.
 	Transport model.HTTPTransport
+
+	// headerOrder is the OPTIONAL [*httpHeaderOrder] of an HTTP/1.1 conn.
+	headerOrder *httpHeaderOrder
+}
+
+// HTTPProtocolHTTP11 is the [HTTPConnection] protocol for HTTP/1.1.
+const HTTPProtocolHTTP11 = "http/1.1"
+
+// HTTPProtocolH2 is the [HTTPConnection] protocol for HTTP/2.
+const HTTPProtocolH2 = "h2"
+
+// HTTPProtocolH3 is the [HTTPConnection] protocol for HTTP/3.
+const HTTPProtocolH3 = "h3"
+
+// ErrHTTPConnection wraps errors occurred when converting a connection to an [HTTPConnection].
+type ErrHTTPConnection struct {
+	Err error
+}
+
+// Unwrap supports [errors.Unwrap].
+func (exc *ErrHTTPConnection) Unwrap() error {
+	return exc.Err
+}
+
+// Error implements error.
+func (exc *ErrHTTPConnection) Error() string {
+	return exc.Err.Error()
+}
+
+// IsErrHTTPConnection returns true when an error is an [ErrHTTPConnection].
+func IsErrHTTPConnection(err error) bool {
+	var exc *ErrHTTPConnection
+	return errors.As(err, &exc)
 }
 
 // HTTPTransactionOption is an option for configuring an HTTP transaction.
@@ -48,6 +86,17 @@ func HTTPTransactionOptionAcceptLanguage(value string) HTTPTransactionOption {
 	}
 }
 
+// HTTPTransactionOptionHeader appends a header to the list of headers to send. The headers
+// in such a list replace the headers with the same name set by other options (e.g.,
+// [HTTPTransactionOptionUserAgent]). When a name appears more than once in the list, we
+// send its values in the order in which they appear. With HTTP/1.1, we also send the headers
+// in such a list in the order in which they appear, after all the other headers.
+func HTTPTransactionOptionHeader(name, value string) HTTPTransactionOption {
+	return func(c *httpTransactionConfig) {
+		c.Headers = append(c.Headers, &HTTPHeader{Name: name, Value: value})
+	}
+}
+
 // HTTPTransactionOptionHost sets the Host header.
 func HTTPTransactionOptionHost(value string) HTTPTransactionOption {
 	return func(c *httpTransactionConfig) {
@@ -70,6 +119,24 @@ func HTTPTransactionOptionMethod(value string) HTTPTransactionOption {
 	}
 }
 
+// HTTPTransactionOptionRequestBodyBase64 sets the request body using the base64
+// encoding, which allows sending binary bodies. Setting this option and
+// [HTTPTransactionOptionRequestBodyText] at the same time is an error.
+func HTTPTransactionOptionRequestBodyBase64(value string) HTTPTransactionOption {
+	return func(c *httpTransactionConfig) {
+		c.RequestBodyBase64 = value
+	}
+}
+
+// HTTPTransactionOptionRequestBodyText sets the request body using a text string.
+// Setting this option and [HTTPTransactionOptionRequestBodyBase64] at the same
+// time is an error.
+func HTTPTransactionOptionRequestBodyText(value string) HTTPTransactionOption {
+	return func(c *httpTransactionConfig) {
+		c.RequestBodyText = value
+	}
+}
+
 // HTTPTransactionOptionResponseBodySnapshotSize sets the maximum response body snapshot size.
 func HTTPTransactionOptionResponseBodySnapshotSize(value int) HTTPTransactionOption {
 	return func(c *httpTransactionConfig) {
@@ -84,6 +151,13 @@ func HTTPTransactionOptionReferer(value string) HTTPTransactionOption {
 	}
 }
 
+// HTTPTransactionOptionTimeout sets the timeout; the default is 10s.
+func HTTPTransactionOptionTimeout(value time.Duration) HTTPTransactionOption {
+	return func(c *httpTransactionConfig) {
+		c.Timeout = value
+	}
+}
+
 // HTTPTransactionOptionURLHost sets the URL host.
 func HTTPTransactionOptionURLHost(value string) HTTPTransactionOption {
 	return func(c *httpTransactionConfig) {
@@ -98,6 +172,14 @@ func HTTPTransactionOptionURLPath(value string) HTTPTransactionOption {
 	}
 }
 
+// HTTPTransactionOptionURLRawQuery sets the URL raw query (i.e., the part after "?"
+// without the "?"), which we send as is without any further encoding.
+func HTTPTransactionOptionURLRawQuery(value string) HTTPTransactionOption {
+	return func(c *httpTransactionConfig) {
+		c.URLRawQuery = value
+	}
+}
+
 // HTTPTransactionOptionURLScheme sets the URL scheme.
 func HTTPTransactionOptionURLScheme(value string) HTTPTransactionOption {
 	return func(c *httpTransactionConfig) {
@@ -112,6 +194,15 @@ func HTTPTransactionOptionUserAgent(value string) HTTPTransactionOption {
 	}
 }
 
+// HTTPHeader is an HTTP header configured using [HTTPTransactionOptionHeader].
+type HTTPHeader struct {
+	// Name is the header name.
+	Name string `json:"name"`
+
+	// Value is the header value.
+	Value string `json:"value"`
+}
+
 // TODO(bassosimone): we should probably autogenerate the config, the functional optional
 // setters, and the conversion from config to list of options.
 
@@ -122,6 +213,9 @@ type httpTransactionConfig struct {
 	// AcceptLanguageHeader is the accept-language header to use.
 	AcceptLanguageHeader string `json:"accept_language_header,omitempty"`
 
+	// Headers is the list of additional headers to use.
+	Headers []*HTTPHeader `json:"headers,omitempty"`
+
 	// HostHeader is the host header to use.
 	HostHeader string `json:"host_header,omitempty"`
 
@@ -132,18 +226,30 @@ type httpTransactionConfig struct {
 	// RefererHeader is the referer header to use.
 	RefererHeader string `json:"referer_header,omitempty"`
 
+	// RequestBodyBase64 is the base64 encoded request body to use.
+	RequestBodyBase64 string `json:"request_body_base64,omitempty"`
+
+	// RequestBodyText is the text request body to use.
+	RequestBodyText string `json:"request_body_text,omitempty"`
+
 	// RequestMethod is the request method to use
 	RequestMethod string `json:"request_method,omitempty"`
 
 	// ResponseBodySnapshotSize is the size of the response body snapshot to read.
 	ResponseBodySnapshotSize int `json:"response_body_snapshot_size,omitempty"`
 
+	// Timeout is the timeout of the whole transaction.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
 	// URLHost is the host for the URL
 	URLHost string `json:"url_host,omitempty"`
 
 	// URLPath is the path for the URL
 	URLPath string `json:"url_path,omitempty"`
 
+	// URLRawQuery is the raw query for the URL
+	URLRawQuery string `json:"url_raw_query,omitempty"`
+
 	// URLScheme is the scheme for the URL
 	URLScheme string `json:"url_scheme,omitempty"`
 
@@ -158,6 +264,9 @@ func (c *httpTransactionConfig) options() (options []HTTPTransactionOption) {
 	if value := c.AcceptLanguageHeader; value != "" {
 		options = append(options, HTTPTransactionOptionAcceptLanguage(value))
 	}
+	for _, header := range c.Headers {
+		options = append(options, HTTPTransactionOptionHeader(header.Name, header.Value))
+	}
 	if value := c.HostHeader; value != "" {
 		options = append(options, HTTPTransactionOptionHost(value))
 	}
@@ -167,18 +276,30 @@ func (c *httpTransactionConfig) options() (options []HTTPTransactionOption) {
 	if value := c.RefererHeader; value != "" {
 		options = append(options, HTTPTransactionOptionReferer(value))
 	}
+	if value := c.RequestBodyBase64; value != "" {
+		options = append(options, HTTPTransactionOptionRequestBodyBase64(value))
+	}
+	if value := c.RequestBodyText; value != "" {
+		options = append(options, HTTPTransactionOptionRequestBodyText(value))
+	}
 	if value := c.RequestMethod; value != "" {
 		options = append(options, HTTPTransactionOptionMethod(value))
 	}
 	if value := c.ResponseBodySnapshotSize; value > 0 {
 		options = append(options, HTTPTransactionOptionResponseBodySnapshotSize(value))
 	}
+	if value := c.Timeout; value > 0 {
+		options = append(options, HTTPTransactionOptionTimeout(value))
+	}
 	if value := c.URLHost; value != "" {
 		options = append(options, HTTPTransactionOptionURLHost(value))
 	}
 	if value := c.URLPath; value != "" {
 		options = append(options, HTTPTransactionOptionURLPath(value))
 	}
+	if value := c.URLRawQuery; value != "" {
+		options = append(options, HTTPTransactionOptionURLRawQuery(value))
+	}
 	if value := c.URLScheme; value != "" {
 		options = append(options, HTTPTransactionOptionURLScheme(value))
 	}
@@ -193,12 +314,20 @@ type HTTPResponse struct {
 	// Address is the original endpoint address.
 	Address string
 
+	// ConnectionReused indicates whether we reused the connection used by a
+	// previous transaction (see [HTTPTransactionSequence]).
+	ConnectionReused bool
+
 	// Domain is the original domain.
 	Domain string
 
 	// Network is the original endpoint network.
 	Network string
 
+	// Redirects contains the OPTIONAL redirect responses preceding this response
+	// when using [HTTPFollowRedirects].
+	Redirects []*HTTPResponse
+
 	// Request is the request we sent to the remote host.
 	Request *http.Request
 
@@ -209,6 +338,21 @@ type HTTPResponse struct {
 	ResponseBodySnapshot []byte
 }
 
+// HTTPTransactionSequenceResult is the result of [HTTPTransactionSequence].
+type HTTPTransactionSequenceResult struct {
+	// Address is the original endpoint address.
+	Address string
+
+	// Domain is the original domain.
+	Domain string
+
+	// Network is the original endpoint network.
+	Network string
+
+	// Responses contains the responses in the same order of the requests.
+	Responses []*HTTPResponse
+}
+
 // ErrHTTPTransaction wraps errors occurred during an HTTP transaction operation.
 type ErrHTTPTransaction struct {
 	Err error
@@ -229,3 +373,22 @@ func IsErrHTTPTransaction(err error) bool {
 	var exc *ErrHTTPTransaction
 	return errors.As(err, &exc)
 }
+
+// ErrHTTPTransactionSequence wraps the error of the failed transaction of an [HTTPTransactionSequence].
+type ErrHTTPTransactionSequence struct {
+	// Err is the error of the failed transaction.
+	Err error
+
+	// Result contains the responses of the transactions preceding the failed one.
+	Result *HTTPTransactionSequenceResult
+}
+
+// Unwrap supports [errors.Unwrap].
+func (exc *ErrHTTPTransactionSequence) Unwrap() error {
+	return exc.Err
+}
+
+// Error implements error.
+func (exc *ErrHTTPTransactionSequence) Error() string {
+	return exc.Err.Error()
+}
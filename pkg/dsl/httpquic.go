@@ -48,10 +48,14 @@ func (sx *httpConnectionQUICStage) Run(ctx context.Context, rtx Runtime, input M
 	if input.Error != nil {
 		return NewError[*HTTPConnection](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*HTTPConnection](err)
+	}
 	output := &HTTPConnection{
 		Address:               input.Value.Address,
 		Domain:                input.Value.Domain,
 		Network:               "udp",
+		Protocol:              HTTPProtocolH3,
 		Scheme:                "https",
 		TLSNegotiatedProtocol: input.Value.TLSNegotiatedProtocol,
 		Trace:                 input.Value.Trace,
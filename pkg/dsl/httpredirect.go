@@ -0,0 +1,219 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// HTTPFollowRedirects returns a stage that follows at most maxRedirects HTTP redirects
+// starting from the given [*HTTPResponse]. For each redirect, this stage reads the
+// Location header, resolves the new host using dnsStage, and establishes a connection
+// with the first endpoint for which the connection sub-pipeline succeeds. We use httpStage
+// for "http" URLs and httpsStage for "https" URLs. Because each connection sub-pipeline
+// creates its own trace, each hop is recorded as a separate trace.
+//
+// The options configure the HTTP transactions performed for each hop, except for the URL
+// scheme, host, path, and query and the Host header, which depend on the Location header. We
+// use the GET method without a body after 301, 302, and 303 redirects, and otherwise the
+// configured method and body.
+//
+// This stage returns the first [*HTTPResponse] that is not a redirect. When there are more
+// than maxRedirects redirects, this stage returns the last redirect [*HTTPResponse]. In
+// both cases, the Redirects field of the returned value contains the previous responses.
+// When a hop fails, this stage returns the error returned by the failing sub-pipeline.
+func HTTPFollowRedirects(
+	maxRedirects int,
+	dnsStage Stage[string, *DNSLookupResult],
+	httpStage Stage[*Endpoint, *HTTPConnection],
+	httpsStage Stage[*Endpoint, *HTTPConnection],
+	options ...HTTPTransactionOption,
+) Stage[*HTTPResponse, *HTTPResponse] {
+	return &httpFollowRedirectsStage{
+		maxRedirects: maxRedirects,
+		dnsStage:     dnsStage,
+		httpStage:    httpStage,
+		httpsStage:   httpsStage,
+		options:      options,
+	}
+}
+
+type httpFollowRedirectsStage struct {
+	maxRedirects int
+	dnsStage     Stage[string, *DNSLookupResult]
+	httpStage    Stage[*Endpoint, *HTTPConnection]
+	httpsStage   Stage[*Endpoint, *HTTPConnection]
+	options      []HTTPTransactionOption
+}
+
+type httpFollowRedirectsArguments struct {
+	MaxRedirects int                   `json:"max_redirects"`
+	Transaction  httpTransactionConfig `json:"transaction"`
+}
+
+const httpFollowRedirectsStageName = "http_follow_redirects"
+
+// ASTNode implements Stage.
+func (sx *httpFollowRedirectsStage) ASTNode() *SerializableASTNode {
+	args := &httpFollowRedirectsArguments{MaxRedirects: sx.maxRedirects}
+	for _, option := range sx.options {
+		option(&args.Transaction)
+	}
+	return &SerializableASTNode{
+		StageName: httpFollowRedirectsStageName,
+		Arguments: args,
+		Children: []*SerializableASTNode{
+			sx.dnsStage.ASTNode(),
+			sx.httpStage.ASTNode(),
+			sx.httpsStage.ASTNode(),
+		},
+	}
+}
+
+type httpFollowRedirectsLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*httpFollowRedirectsLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var args httpFollowRedirectsArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 3); err != nil {
+		return nil, err
+	}
+	runnables, err := loader.LoadChildren(node)
+	if err != nil {
+		return nil, err
+	}
+	stage := HTTPFollowRedirects(
+		args.MaxRedirects,
+		&RunnableASTNodeStage[string, *DNSLookupResult]{runnables[0]},
+		&RunnableASTNodeStage[*Endpoint, *HTTPConnection]{runnables[1]},
+		&RunnableASTNodeStage[*Endpoint, *HTTPConnection]{runnables[2]},
+		args.Transaction.options()...,
+	)
+	return &StageRunnableASTNode[*HTTPResponse, *HTTPResponse]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*httpFollowRedirectsLoader) StageName() string {
+	return httpFollowRedirectsStageName
+}
+
+// Run implements Stage.
+func (sx *httpFollowRedirectsStage) Run(ctx context.Context, rtx Runtime, input Maybe[*HTTPResponse]) Maybe[*HTTPResponse] {
+	if input.Error != nil {
+		return NewError[*HTTPResponse](input.Error)
+	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*HTTPResponse](err)
+	}
+
+	var redirects []*HTTPResponse
+	current := input.Value
+	for hop := 0; hop < sx.maxRedirects; hop++ {
+		// stop when the current response is not a redirect
+		location, err := current.Response.Location()
+		if !httpIsRedirect(current.Response.StatusCode) || err != nil {
+			break
+		}
+
+		// perform the next hop
+		next := sx.hop(ctx, rtx, current, location)
+		if next.Error != nil {
+			return next
+		}
+		redirects = append(redirects, current)
+		current = next.Value
+	}
+
+	// create the output without modifying the input response
+	output := *current
+	output.Redirects = redirects
+	return NewValue(&output)
+}
+
+// httpIsRedirect returns whether the status code is a redirect we should follow.
+func httpIsRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// hop follows the redirect contained in the current response to the given URL, which
+// [*http.Response.Location] has already resolved against the request URL.
+func (sx *httpFollowRedirectsStage) hop(
+	ctx context.Context, rtx Runtime, current *HTTPResponse, URL *url.URL) Maybe[*HTTPResponse] {
+	// select the connection sub-pipeline and the default port
+	var (
+		connStage Stage[*Endpoint, *HTTPConnection]
+		port      string
+	)
+	switch URL.Scheme {
+	case "http":
+		connStage, port = sx.httpStage, "80"
+	case "https":
+		connStage, port = sx.httpsStage, "443"
+	default:
+		return NewError[*HTTPResponse](&ErrHTTPTransaction{&ErrInvalidURL{URL.String()}})
+	}
+	if value := URL.Port(); value != "" {
+		port = value
+	}
+	portnum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return NewError[*HTTPResponse](&ErrHTTPTransaction{&ErrInvalidURL{URL.String()}})
+	}
+
+	// resolve the new host
+	domain := URL.Hostname()
+	dnsStage := sx.dnsStage
+	if net.ParseIP(domain) != nil {
+		dnsStage = DNSLookupStatic(domain)
+	}
+	addrs := dnsStage.Run(ctx, rtx, NewValue(domain))
+	endpoints := MakeEndpointsForPort(uint16(portnum)).Run(ctx, rtx, addrs)
+	if endpoints.Error != nil {
+		return NewError[*HTTPResponse](endpoints.Error)
+	}
+
+	// establish a connection with the first endpoint that works
+	conn := NewError[*HTTPConnection](&ErrDNSLookup{netxlite.MaybeNewErrWrapper(
+		netxlite.ClassifyResolverError, netxlite.ResolveOperation, netxlite.ErrOODNSNoAnswer)})
+	for _, endpoint := range endpoints.Value {
+		conn = connStage.Run(ctx, rtx, NewValue(endpoint))
+		if conn.Error == nil || IsErrException(conn.Error) {
+			break
+		}
+	}
+
+	// configure the HTTP transaction using the new URL
+	options := append([]HTTPTransactionOption{}, sx.options...)
+	options = append(options,
+		HTTPTransactionOptionURLScheme(URL.Scheme),
+		HTTPTransactionOptionURLHost(URL.Host),
+		HTTPTransactionOptionURLPath(URL.Path),
+		HTTPTransactionOptionURLRawQuery(URL.RawQuery),
+		HTTPTransactionOptionHost(URL.Host),
+	)
+	switch current.Response.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		options = append(options,
+			HTTPTransactionOptionMethod("GET"),
+			HTTPTransactionOptionRequestBodyBase64(""),
+			HTTPTransactionOptionRequestBodyText(""),
+		)
+	}
+
+	// perform the HTTP transaction
+	return HTTPTransaction(options...).Run(ctx, rtx, conn)
+}
@@ -0,0 +1,102 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestHTTPFollowRedirects(t *testing.T) {
+	// newPipeline creates a pipeline that follows redirects using the given DNS stage
+	newPipeline := func(maxRedirects int, dnsStage Stage[string, *DNSLookupResult]) Stage[*Endpoint, *HTTPResponse] {
+		return Compose4(
+			TCPConnect(),
+			HTTPConnectionTCP(),
+			HTTPTransaction(HTTPTransactionOptionURLPath("/first")),
+			HTTPFollowRedirects(
+				maxRedirects,
+				dnsStage,
+				Compose(TCPConnect(), HTTPConnectionTCP()),
+				Compose3(TCPConnect(), TLSHandshake(), HTTPConnectionTLS()),
+			),
+		)
+	}
+
+	// create a server that redirects twice using a domain name and then returns 200
+	var srvrURL *url.URL
+	srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/first":
+			w.Header().Set("Location", "http://www.example.com:"+srvrURL.Port()+"/second")
+			w.WriteHeader(http.StatusFound)
+		case "/second":
+			w.Header().Set("Location", "/third?a=b&c=d")
+			w.WriteHeader(http.StatusMovedPermanently)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srvr.Close()
+	srvrURL = runtimex.Try1(url.Parse(srvr.URL))
+	endpoint := NewValue(&Endpoint{Address: srvrURL.Host, Domain: "www.example.com"})
+	serverIP, _ := runtimex.Try2(net.SplitHostPort(srvrURL.Host))
+
+	t.Run("we follow redirects", func(t *testing.T) {
+		rtx := NewMinimalRuntime(log.Log)
+		results := newPipeline(10, DNSLookupStatic(serverIP)).Run(context.Background(), rtx, endpoint)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		if results.Value.Response.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status code", results.Value.Response.StatusCode)
+		}
+		if results.Value.Request.URL.Path != "/third" {
+			t.Fatal("unexpected path", results.Value.Request.URL.Path)
+		}
+		if results.Value.Request.URL.RawQuery != "a=b&c=d" {
+			t.Fatal("unexpected query", results.Value.Request.URL.RawQuery)
+		}
+		if len(results.Value.Redirects) != 2 {
+			t.Fatal("unexpected number of redirects", len(results.Value.Redirects))
+		}
+	})
+
+	t.Run("we stop after maxRedirects redirects", func(t *testing.T) {
+		rtx := NewMinimalRuntime(log.Log)
+		results := newPipeline(1, DNSLookupStatic(serverIP)).Run(context.Background(), rtx, endpoint)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		if results.Value.Response.StatusCode != http.StatusMovedPermanently {
+			t.Fatal("unexpected status code", results.Value.Response.StatusCode)
+		}
+	})
+
+	t.Run("we return the error of the DNS sub-pipeline", func(t *testing.T) {
+		rtx := NewMinimalRuntime(log.Log)
+		results := newPipeline(10, DNSLookupStatic("antani")).Run(context.Background(), rtx, endpoint)
+		if !IsErrException(results.Error) {
+			t.Fatal("not an ErrException", results.Error)
+		}
+	})
+
+	t.Run("we can serialize and load the stage", func(t *testing.T) {
+		stage := newPipeline(10, DNSLookupStatic(serverIP))
+		rawAST := runtimex.Try1(json.Marshal(stage.ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+		rtx := NewMinimalRuntime(log.Log)
+		results := runnable.Run(context.Background(), rtx, endpoint.AsGeneric())
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+	})
+}
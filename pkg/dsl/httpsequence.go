@@ -0,0 +1,119 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ooni/oohttp/httptrace"
+)
+
+// HTTPTransactionSequence returns a stage that uses the same HTTP connection to perform an
+// HTTP transaction for each of the given lists of options, in order. Each list of options
+// configures a transaction exactly like the options passed to [HTTPTransaction] and the
+// [Trace] of the connection records each transaction as a distinct observation. Use this stage
+// to measure censorship that only triggers on subsequent requests (e.g., when a middlebox
+// resets the connection because of a keyword contained by the second request).
+//
+// The Responses field of the returned value contains a response for each transaction and
+// the ConnectionReused field of each response tells whether we reused the connection. We
+// can only reuse an HTTP/1.1 connection when we read the whole body of the previous response,
+// so make sure the response body snapshot size is large enough.
+//
+// This stage stops at the first failing transaction and returns an [ErrHTTPTransactionSequence]
+// containing the responses of the previous transactions and wrapping an [ErrHTTPTransaction]. When
+// we could not reuse the connection, the error wraps [netxlite.ErrNoConnReuse] as well as the
+// I/O error that caused the connection to become unusable, if any, which determines the failure
+// (e.g., "connection_reset" when the server resets the connection after the second request
+// and "eof_error" when it closes the connection). Remember to use the [IsErrHTTPTransaction]
+// predicate when setting an experiment test keys.
+func HTTPTransactionSequence(requests ...[]HTTPTransactionOption) Stage[*HTTPConnection, *HTTPTransactionSequenceResult] {
+	return wrapOperation[*HTTPConnection, *HTTPTransactionSequenceResult](&httpTransactionSequenceOperation{requests})
+}
+
+type httpTransactionSequenceOperation struct {
+	requests [][]HTTPTransactionOption
+}
+
+type httpTransactionSequenceArguments struct {
+	Requests []httpTransactionConfig `json:"requests"`
+}
+
+const httpTransactionSequenceStageName = "http_transaction_sequence"
+
+// ASTNode implements operation.
+func (op *httpTransactionSequenceOperation) ASTNode() *SerializableASTNode {
+	args := &httpTransactionSequenceArguments{Requests: []httpTransactionConfig{}}
+	for _, options := range op.requests {
+		var config httpTransactionConfig
+		for _, option := range options {
+			option(&config)
+		}
+		args.Requests = append(args.Requests, config)
+	}
+	return &SerializableASTNode{
+		StageName: httpTransactionSequenceStageName,
+		Arguments: args,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type httpTransactionSequenceLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*httpTransactionSequenceLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var args httpTransactionSequenceArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	var requests [][]HTTPTransactionOption
+	for _, config := range args.Requests {
+		requests = append(requests, config.options())
+	}
+	stage := HTTPTransactionSequence(requests...)
+	return &StageRunnableASTNode[*HTTPConnection, *HTTPTransactionSequenceResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*httpTransactionSequenceLoader) StageName() string {
+	return httpTransactionSequenceStageName
+}
+
+// Run implements operation.
+func (op *httpTransactionSequenceOperation) Run(ctx context.Context, rtx Runtime, conn *HTTPConnection) (*HTTPTransactionSequenceResult, error) {
+	output := &HTTPTransactionSequenceResult{
+		Address:   conn.Address,
+		Domain:    conn.Domain,
+		Network:   conn.Network,
+		Responses: []*HTTPResponse{},
+	}
+	for idx, options := range op.requests {
+		// observe whether the transport reuses the connection
+		var (
+			gotConn bool
+			reused  bool
+		)
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				gotConn, reused = true, info.Reused
+			},
+		}
+
+		// perform the transaction like the HTTPTransaction stage would do
+		resp, err := (&httpTransactionOperation{options}).Run(httptrace.WithClientTrace(ctx, trace), rtx, conn)
+		if err != nil {
+			return nil, &ErrHTTPTransactionSequence{Err: err, Result: output}
+		}
+
+		// the HTTP/3 transport does not support tracing but multiplexes all the
+		// transactions over the same QUIC connection, so it always reuses it
+		if !gotConn {
+			reused = idx > 0
+		}
+		resp.ConnectionReused = reused
+		output.Responses = append(output.Responses, resp)
+	}
+	return output, nil
+}
@@ -0,0 +1,177 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestHTTPTransactionSequence(t *testing.T) {
+	// handler resets the connection when the path is /blocked and
+	// otherwise echoes the remote address to detect reuse
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blocked":
+			hijacker := w.(http.Hijacker)
+			conn, _ := runtimex.Try2(hijacker.Hijack())
+			tcpConn := conn.(*net.TCPConn)
+			tcpConn.SetLinger(0)
+			tcpConn.Close()
+		case "/close":
+			w.Header().Set("Connection", "close")
+			w.Write([]byte(r.RemoteAddr))
+		default:
+			w.Write([]byte(r.RemoteAddr))
+		}
+	})
+
+	// newPipeline creates a pipeline using a cleartext HTTP connection
+	newPipeline := func(requests ...[]HTTPTransactionOption) Stage[*Endpoint, *HTTPTransactionSequenceResult] {
+		return Compose3(
+			TCPConnect(),
+			HTTPConnectionTCP(),
+			HTTPTransactionSequence(requests...),
+		)
+	}
+
+	// newPath returns the options to fetch the given path
+	newPath := func(path string) []HTTPTransactionOption {
+		return []HTTPTransactionOption{
+			HTTPTransactionOptionURLPath(path),
+			HTTPTransactionOptionIncludeResponseBodySnapshot(true),
+		}
+	}
+
+	t.Run("we reuse the connection for all the transactions", func(t *testing.T) {
+		srvr := httptest.NewServer(handler)
+		defer srvr.Close()
+
+		pipeline := newPipeline(newPath("/"), newPath("/"), newPath("/"))
+		endpoint := NewValue(&Endpoint{
+			Address: srvr.Listener.Addr().String(),
+			Domain:  "www.example.com",
+		})
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		if len(results.Value.Responses) != 3 {
+			t.Fatal("expected three responses")
+		}
+		for idx, resp := range results.Value.Responses {
+			if expect := idx > 0; resp.ConnectionReused != expect {
+				t.Fatal("unexpected ConnectionReused for", idx, resp.ConnectionReused)
+			}
+			first := results.Value.Responses[0].ResponseBodySnapshot
+			if string(resp.ResponseBodySnapshot) != string(first) {
+				t.Fatal("expected the same client address", string(resp.ResponseBodySnapshot))
+			}
+		}
+	})
+
+	t.Run("we reuse an HTTP/2 connection", func(t *testing.T) {
+		srvr := httptest.NewUnstartedServer(handler)
+		srvr.EnableHTTP2 = true
+		srvr.StartTLS()
+		defer srvr.Close()
+
+		pipeline := Compose4(
+			TCPConnect(),
+			TLSHandshake(TLSHandshakeOptionSkipVerify(true)),
+			HTTPConnectionTLS(HTTPConnectionTLSOptionProtocol(HTTPProtocolH2)),
+			HTTPTransactionSequence(newPath("/"), newPath("/")),
+		)
+		endpoint := NewValue(&Endpoint{
+			Address: srvr.Listener.Addr().String(),
+			Domain:  "www.example.com",
+		})
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		if len(results.Value.Responses) != 2 || !results.Value.Responses[1].ConnectionReused {
+			t.Fatal("expected to reuse the connection")
+		}
+	})
+
+	t.Run("we detect a reset when reusing the connection", func(t *testing.T) {
+		srvr := httptest.NewServer(handler)
+		defer srvr.Close()
+
+		pipeline := newPipeline(newPath("/"), newPath("/blocked"))
+		endpoint := NewValue(&Endpoint{
+			Address: srvr.Listener.Addr().String(),
+			Domain:  "www.example.com",
+		})
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+
+		if !IsErrHTTPTransaction(results.Error) {
+			t.Fatal("not an ErrHTTPTransaction", results.Error)
+		}
+		var wrapper *netxlite.ErrWrapper
+		if !errors.As(results.Error, &wrapper) || wrapper.Failure != netxlite.FailureConnectionReset {
+			t.Fatal("unexpected failure", results.Error)
+		}
+
+		// make sure the error contains the response preceding the reset
+		var exc *ErrHTTPTransactionSequence
+		if !errors.As(results.Error, &exc) {
+			t.Fatal("not an ErrHTTPTransactionSequence", results.Error)
+		}
+		if len(exc.Result.Responses) != 1 || exc.Result.Responses[0].ConnectionReused {
+			t.Fatal("unexpected partial result", exc.Result.Responses)
+		}
+	})
+
+	t.Run("we detect when we cannot reuse the connection", func(t *testing.T) {
+		srvr := httptest.NewServer(handler)
+		defer srvr.Close()
+
+		pipeline := newPipeline(newPath("/close"), newPath("/"))
+		endpoint := NewValue(&Endpoint{
+			Address: srvr.Listener.Addr().String(),
+			Domain:  "www.example.com",
+		})
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+
+		if !IsErrHTTPTransaction(results.Error) {
+			t.Fatal("not an ErrHTTPTransaction", results.Error)
+		}
+		if !errors.Is(results.Error, netxlite.ErrNoConnReuse) {
+			t.Fatal("expected an ErrNoConnReuse", results.Error)
+		}
+	})
+
+	t.Run("we serialize and load the requests", func(t *testing.T) {
+		stage := HTTPTransactionSequence(
+			newPath("/"),
+			[]HTTPTransactionOption{HTTPTransactionOptionMethod("POST")},
+		)
+		rawAST := runtimex.Try1(json.Marshal(stage.ASTNode()))
+		if !strings.Contains(string(rawAST), `"request_method":"POST"`) {
+			t.Fatal("unexpected AST", string(rawAST))
+		}
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+		if diff := cmp.Diff(rawAST, runtimex.Try1(json.Marshal(runnable.ASTNode()))); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
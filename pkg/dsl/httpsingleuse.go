@@ -0,0 +1,142 @@
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// httpSingleUseDialer is like the dialer returned by [netxlite.NewSingleUseDialer] except that
+// subsequent dials return an error wrapping both [netxlite.ErrNoConnReuse] and the first I/O
+// error that occurred on the connection, if any. When a request fails on a reused connection,
+// the HTTP transport may retry it by dialing again, which would otherwise hide the original
+// error (e.g., a connection reset triggered by the second request).
+type httpSingleUseDialer struct {
+	conn     net.Conn
+	mu       sync.Mutex
+	recorder *httpErrRecorder
+}
+
+// newHTTPSingleUseDialer creates a new [*httpSingleUseDialer] for the given conn.
+func newHTTPSingleUseDialer(conn net.Conn) *httpSingleUseDialer {
+	recorder := &httpErrRecorder{}
+	return &httpSingleUseDialer{
+		conn:     &httpErrRecorderConn{conn, recorder},
+		mu:       sync.Mutex{},
+		recorder: recorder,
+	}
+}
+
+// newHTTPSingleUseTLSDialer is like [newHTTPSingleUseDialer] but for TLS connections.
+func newHTTPSingleUseTLSDialer(conn netxlite.TLSConn) *httpSingleUseDialer {
+	recorder := &httpErrRecorder{}
+	return &httpSingleUseDialer{
+		conn:     &httpErrRecorderTLSConn{conn, recorder},
+		mu:       sync.Mutex{},
+		recorder: recorder,
+	}
+}
+
+var (
+	_ model.Dialer    = &httpSingleUseDialer{}
+	_ model.TLSDialer = &httpSingleUseDialer{}
+)
+
+// DialContext implements model.Dialer.
+func (d *httpSingleUseDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	defer d.mu.Unlock()
+	d.mu.Lock()
+	if d.conn == nil {
+		if err := d.recorder.Err(); err != nil {
+			return nil, fmt.Errorf("%w: %w", netxlite.ErrNoConnReuse, err)
+		}
+		return nil, netxlite.ErrNoConnReuse
+	}
+	var conn net.Conn
+	conn, d.conn = d.conn, nil
+	return conn, nil
+}
+
+// DialTLSContext implements model.TLSDialer.
+func (d *httpSingleUseDialer) DialTLSContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.DialContext(ctx, network, address)
+}
+
+// CloseIdleConnections implements model.Dialer.
+func (d *httpSingleUseDialer) CloseIdleConnections() {
+	// nothing to do
+}
+
+// httpErrRecorder records the first I/O error occurred on a connection.
+type httpErrRecorder struct {
+	err error
+	mu  sync.Mutex
+}
+
+// Err returns the first I/O error or nil.
+func (r *httpErrRecorder) Err() error {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	return r.err
+}
+
+// record records err if it is the first I/O error.
+func (r *httpErrRecorder) record(err error) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// httpErrRecorderConn is a [net.Conn] using an [*httpErrRecorder].
+type httpErrRecorderConn struct {
+	net.Conn
+	recorder *httpErrRecorder
+}
+
+// Read implements net.Conn.
+func (c *httpErrRecorderConn) Read(data []byte) (int, error) {
+	count, err := c.Conn.Read(data)
+	if err != nil {
+		c.recorder.record(err)
+	}
+	return count, err
+}
+
+// Write implements net.Conn.
+func (c *httpErrRecorderConn) Write(data []byte) (int, error) {
+	count, err := c.Conn.Write(data)
+	if err != nil {
+		c.recorder.record(err)
+	}
+	return count, err
+}
+
+// httpErrRecorderTLSConn is a [netxlite.TLSConn] using an [*httpErrRecorder].
+type httpErrRecorderTLSConn struct {
+	netxlite.TLSConn
+	recorder *httpErrRecorder
+}
+
+// Read implements net.Conn.
+func (c *httpErrRecorderTLSConn) Read(data []byte) (int, error) {
+	count, err := c.TLSConn.Read(data)
+	if err != nil {
+		c.recorder.record(err)
+	}
+	return count, err
+}
+
+// Write implements net.Conn.
+func (c *httpErrRecorderTLSConn) Write(data []byte) (int, error) {
+	count, err := c.TLSConn.Write(data)
+	if err != nil {
+		c.recorder.record(err)
+	}
+	return count, err
+}
@@ -48,17 +48,23 @@ func (sx *httpConnectionTCPStage) Run(ctx context.Context, rtx Runtime, input Ma
 	if input.Error != nil {
 		return NewError[*HTTPConnection](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*HTTPConnection](err)
+	}
+	order := &httpHeaderOrder{}
 	output := &HTTPConnection{
 		Address:               input.Value.Address,
 		Domain:                input.Value.Domain,
 		Network:               "tcp",
+		Protocol:              HTTPProtocolHTTP11,
 		Scheme:                "http",
 		TLSNegotiatedProtocol: "",
 		Trace:                 input.Value.Trace,
 		Transport: netxlite.NewHTTPTransport(
-			rtx.Logger(), netxlite.NewSingleUseDialer(input.Value.Conn),
+			rtx.Logger(), newHTTPSingleUseDialer(&httpHeaderOrderConn{input.Value.Conn, order}),
 			netxlite.NewNullTLSDialer(),
 		),
+		headerOrder: order,
 	}
 	return NewValue(output)
 }
@@ -2,24 +2,40 @@ package dsl
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 
+	"github.com/ooni/probe-engine/pkg/measurexlite"
 	"github.com/ooni/probe-engine/pkg/netxlite"
 )
 
 // HTTPConnectionTLS returns a stage that converts a TLS connection to an HTTP connection.
-func HTTPConnectionTLS() Stage[*TLSConnection, *HTTPConnection] {
-	return &httpConnectionTLSStage{}
+//
+// By default, we use the protocol negotiated using ALPN during the TLS handshake, that is, HTTP/2
+// when the server selected "h2" and HTTP/1.1 otherwise. Use [HTTPConnectionTLSOptionProtocol] to
+// force a specific protocol. In such a case, this stage closes the connection and returns an
+// [ErrHTTPConnection] wrapping [ErrHTTPProtocolNotNegotiated] when the TLS handshake did not
+// negotiate the forced protocol. Since ALPN negotiation happens during the TLS handshake, you
+// should also use [TLSHandshakeOptionALPN] to only offer the protocol you want to force.
+func HTTPConnectionTLS(options ...HTTPConnectionTLSOption) Stage[*TLSConnection, *HTTPConnection] {
+	return &httpConnectionTLSStage{options}
 }
 
-type httpConnectionTLSStage struct{}
+type httpConnectionTLSStage struct {
+	options []HTTPConnectionTLSOption
+}
 
 const httpConnectionTLSStageName = "http_connection_tls"
 
 // ASTNode implements Stage.
 func (sx *httpConnectionTLSStage) ASTNode() *SerializableASTNode {
+	var config httpConnectionTLSConfig
+	for _, option := range sx.options {
+		option(&config)
+	}
 	return &SerializableASTNode{
 		StageName: httpConnectionTLSStageName,
-		Arguments: nil,
+		Arguments: &config,
 		Children:  []*SerializableASTNode{},
 	}
 }
@@ -28,13 +44,14 @@ type httpConnectionTLSLoader struct{}
 
 // Load implements ASTLoaderRule.
 func (*httpConnectionTLSLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
-	if err := loader.LoadEmptyArguments(node); err != nil {
+	var config httpConnectionTLSConfig
+	if err := json.Unmarshal(node.Arguments, &config); err != nil {
 		return nil, err
 	}
 	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
 		return nil, err
 	}
-	stage := HTTPConnectionTLS()
+	stage := HTTPConnectionTLS(config.options()...)
 	return &StageRunnableASTNode[*TLSConnection, *HTTPConnection]{stage}, nil
 }
 
@@ -48,15 +65,109 @@ func (sx *httpConnectionTLSStage) Run(ctx context.Context, rtx Runtime, input Ma
 	if input.Error != nil {
 		return NewError[*HTTPConnection](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*HTTPConnection](err)
+	}
+
+	// create configuration
+	config := &httpConnectionTLSConfig{}
+	for _, option := range sx.options {
+		option(config)
+	}
+	if err := config.validate(); err != nil {
+		return NewError[*HTTPConnection](&ErrException{err})
+	}
+
+	// determine the protocol negotiated during the TLS handshake
+	protocol := HTTPProtocolHTTP11
+	if input.Value.TLSNegotiatedProtocol == HTTPProtocolH2 {
+		protocol = HTTPProtocolH2
+	}
+
+	// enforce the protocol we should use, if any
+	if config.Protocol != "" && config.Protocol != protocol {
+		ol := measurexlite.NewOperationLogger(
+			rtx.Logger(),
+			"[#%d] HTTPConnectionTLS %s with %s using %s",
+			input.Value.Trace.Index(),
+			input.Value.Address,
+			input.Value.Domain,
+			config.Protocol,
+		)
+		err := newErrHTTPProtocolNotNegotiated()
+		ol.Stop(err)
+		input.Value.Conn.Close()
+		return NewError[*HTTPConnection](&ErrHTTPConnection{err})
+	}
+
+	// we can only reorder the headers of HTTP/1.1 requests
+	var (
+		conn  netxlite.TLSConn = input.Value.Conn
+		order *httpHeaderOrder
+	)
+	if protocol == HTTPProtocolHTTP11 {
+		order = &httpHeaderOrder{}
+		conn = &httpHeaderOrderTLSConn{conn, order}
+	}
+
 	output := &HTTPConnection{
 		Address:               input.Value.Address,
 		Domain:                input.Value.Domain,
 		Network:               "tcp",
+		Protocol:              protocol,
 		Scheme:                "https",
 		TLSNegotiatedProtocol: input.Value.TLSNegotiatedProtocol,
 		Trace:                 input.Value.Trace,
 		Transport: netxlite.NewHTTPTransport(rtx.Logger(), netxlite.NewNullDialer(),
-			netxlite.NewSingleUseTLSDialer(input.Value.Conn)),
+			newHTTPSingleUseTLSDialer(conn)),
+		headerOrder: order,
 	}
 	return NewValue(output)
 }
+
+// HTTPConnectionTLSOption is an option for configuring [HTTPConnectionTLS].
+type HTTPConnectionTLSOption func(config *httpConnectionTLSConfig)
+
+type httpConnectionTLSConfig struct {
+	Protocol string `json:"protocol,omitempty"`
+}
+
+func (c *httpConnectionTLSConfig) options() (options []HTTPConnectionTLSOption) {
+	if c.Protocol != "" {
+		options = append(options, HTTPConnectionTLSOptionProtocol(c.Protocol))
+	}
+	return
+}
+
+func (c *httpConnectionTLSConfig) validate() error {
+	switch c.Protocol {
+	case "", HTTPProtocolHTTP11, HTTPProtocolH2:
+		return nil
+	default:
+		return &ErrInvalidHTTPProtocol{c.Protocol}
+	}
+}
+
+// HTTPConnectionTLSOptionProtocol forces using the given protocol, which must be
+// either [HTTPProtocolHTTP11] or [HTTPProtocolH2].
+func HTTPConnectionTLSOptionProtocol(value string) HTTPConnectionTLSOption {
+	return func(config *httpConnectionTLSConfig) {
+		config.Protocol = value
+	}
+}
+
+// FailureHTTPProtocolNotNegotiated is the failure string we use when the TLS handshake did
+// not negotiate the protocol forced using [HTTPConnectionTLSOptionProtocol].
+const FailureHTTPProtocolNotNegotiated = "http_protocol_not_negotiated"
+
+// ErrHTTPProtocolNotNegotiated indicates that the TLS handshake did not negotiate the forced protocol.
+var ErrHTTPProtocolNotNegotiated = errors.New("dsl: the TLS handshake did not negotiate the forced HTTP protocol")
+
+// newErrHTTPProtocolNotNegotiated returns an [ErrHTTPProtocolNotNegotiated] wrapped by a
+// [*netxlite.ErrWrapper] using [FailureHTTPProtocolNotNegotiated] as the failure.
+func newErrHTTPProtocolNotNegotiated() error {
+	classifier := func(error) string {
+		return FailureHTTPProtocolNotNegotiated
+	}
+	return netxlite.NewErrWrapper(classifier, netxlite.TLSHandshakeOperation, ErrHTTPProtocolNotNegotiated)
+}
@@ -0,0 +1,162 @@
+package dsl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+func TestHTTPConnectionTLS(t *testing.T) {
+	// create a server supporting both HTTP/1.1 and HTTP/2
+	srvr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srvr.EnableHTTP2 = true
+	srvr.StartTLS()
+	defer srvr.Close()
+
+	var testcases = []struct {
+		name          string
+		alpn          []string
+		options       []HTTPConnectionTLSOption
+		expectProto   string
+		expectFailure string
+	}{{
+		name:          "without forcing the protocol and the server selecting h2",
+		alpn:          []string{"h2", "http/1.1"},
+		options:       []HTTPConnectionTLSOption{},
+		expectProto:   "HTTP/2.0",
+		expectFailure: "",
+	}, {
+		name:          "without forcing the protocol and the server selecting http/1.1",
+		alpn:          []string{"http/1.1"},
+		options:       []HTTPConnectionTLSOption{},
+		expectProto:   "HTTP/1.1",
+		expectFailure: "",
+	}, {
+		name:          "when forcing h2 and the server selecting h2",
+		alpn:          []string{"h2"},
+		options:       []HTTPConnectionTLSOption{HTTPConnectionTLSOptionProtocol(HTTPProtocolH2)},
+		expectProto:   "HTTP/2.0",
+		expectFailure: "",
+	}, {
+		name:          "when forcing http/1.1 and the server selecting http/1.1",
+		alpn:          []string{"http/1.1"},
+		options:       []HTTPConnectionTLSOption{HTTPConnectionTLSOptionProtocol(HTTPProtocolHTTP11)},
+		expectProto:   "HTTP/1.1",
+		expectFailure: "",
+	}, {
+		name:          "when forcing h2 and the server selecting http/1.1",
+		alpn:          []string{"http/1.1"},
+		options:       []HTTPConnectionTLSOption{HTTPConnectionTLSOptionProtocol(HTTPProtocolH2)},
+		expectProto:   "",
+		expectFailure: FailureHTTPProtocolNotNegotiated,
+	}, {
+		name:          "when forcing http/1.1 and the server selecting h2",
+		alpn:          []string{"h2", "http/1.1"},
+		options:       []HTTPConnectionTLSOption{HTTPConnectionTLSOptionProtocol(HTTPProtocolHTTP11)},
+		expectProto:   "",
+		expectFailure: FailureHTTPProtocolNotNegotiated,
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			// create a measurement pipeline
+			pipeline := Compose4(
+				TCPConnect(),
+				TLSHandshake(
+					TLSHandshakeOptionALPN(tc.alpn...),
+					TLSHandshakeOptionSkipVerify(true),
+				),
+				HTTPConnectionTLS(tc.options...),
+				HTTPTransaction(),
+			)
+
+			// create the endpoint
+			endpoint := NewValue(&Endpoint{
+				Address: srvr.Listener.Addr().String(),
+				Domain:  "www.example.com",
+			})
+
+			// perform the measurement
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, endpoint)
+
+			// check the results
+			if tc.expectFailure != "" {
+				if !IsErrHTTPConnection(results.Error) {
+					t.Fatal("not an ErrHTTPConnection", results.Error)
+				}
+				if !errors.Is(results.Error, ErrHTTPProtocolNotNegotiated) {
+					t.Fatal("not an ErrHTTPProtocolNotNegotiated", results.Error)
+				}
+				var wrapper *netxlite.ErrWrapper
+				if !errors.As(results.Error, &wrapper) || wrapper.Failure != tc.expectFailure {
+					t.Fatal("unexpected failure", results.Error)
+				}
+				return
+			}
+			if results.Error != nil {
+				t.Fatal(results.Error)
+			}
+			if proto := results.Value.Response.Header.Get("X-Proto"); proto != tc.expectProto {
+				t.Fatal("unexpected proto", proto)
+			}
+		})
+	}
+
+	t.Run("we record the protocol we're using", func(t *testing.T) {
+		var testcases = []struct {
+			negotiated string
+			expect     string
+		}{{
+			negotiated: "",
+			expect:     HTTPProtocolHTTP11,
+		}, {
+			negotiated: "http/1.1",
+			expect:     HTTPProtocolHTTP11,
+		}, {
+			negotiated: "h2",
+			expect:     HTTPProtocolH2,
+		}}
+		for _, tc := range testcases {
+			conn := &TLSConnection{
+				Address:               "127.0.0.1:443",
+				Conn:                  nil,
+				Domain:                "www.example.com",
+				TLSNegotiatedProtocol: tc.negotiated,
+				Trace:                 NewMinimalRuntime(log.Log).NewTrace(),
+			}
+			rtx := NewMinimalRuntime(log.Log)
+			results := HTTPConnectionTLS().Run(context.Background(), rtx, NewValue(conn))
+			if results.Error != nil {
+				t.Fatal(results.Error)
+			}
+			if results.Value.Protocol != tc.expect {
+				t.Fatal("unexpected protocol", results.Value.Protocol)
+			}
+		}
+	})
+
+	t.Run("we reject invalid protocols", func(t *testing.T) {
+		conn := &TLSConnection{
+			Address:               "127.0.0.1:443",
+			Conn:                  nil,
+			Domain:                "www.example.com",
+			TLSNegotiatedProtocol: "h2",
+			Trace:                 NewMinimalRuntime(log.Log).NewTrace(),
+		}
+		rtx := NewMinimalRuntime(log.Log)
+		stage := HTTPConnectionTLS(HTTPConnectionTLSOptionProtocol("h3"))
+		results := stage.Run(context.Background(), rtx, NewValue(conn))
+		if !IsErrException(results.Error) {
+			t.Fatal("not an ErrException", results.Error)
+		}
+	})
+}
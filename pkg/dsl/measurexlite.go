@@ -1,7 +1,9 @@
 package dsl
 
 import (
+	"context"
 	"io"
+	"net"
 	"net/http"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/ooni/probe-engine/pkg/netxlite"
 	"github.com/ooni/probe-engine/pkg/throttling"
 	"github.com/quic-go/quic-go"
+	utls "gitlab.com/yawning/utls.git"
 )
 
 // MeasurexliteRuntime is a [Runtime] using [measurexlite] to collect [Observations].
@@ -33,11 +36,12 @@ func NewMeasurexliteRuntime(
 	metrics Metrics,
 	progress ProgressMeter,
 	zeroTime time.Time,
+	options ...RuntimeOption,
 ) *MeasurexliteRuntime {
 	return &MeasurexliteRuntime{
 		metrics:  metrics,
 		progress: progress,
-		runtime:  NewMinimalRuntime(logger),
+		runtime:  NewMinimalRuntime(logger, options...),
 		zeroTime: zeroTime,
 	}
 }
@@ -49,6 +53,11 @@ func (r *MeasurexliteRuntime) Close() error {
 	return r.runtime.Close()
 }
 
+// ConcurrencyBudget implements Runtime.
+func (r *MeasurexliteRuntime) ConcurrencyBudget() *ConcurrencyBudget {
+	return r.runtime.ConcurrencyBudget()
+}
+
 // ProgressMeter implements Runtime.
 func (r *MeasurexliteRuntime) ProgressMeter() ProgressMeter {
 	return r.progress
@@ -109,6 +118,48 @@ type measurexliteTrace struct {
 
 var _ Trace = &measurexliteTrace{}
 
+// DNSRoundTrip implements Trace.
+func (t *measurexliteTrace) DNSRoundTrip(
+	ctx context.Context,
+	txp model.DNSTransport,
+	query model.DNSQuery,
+) (model.DNSResponse, []*DNSAnswer, error) {
+	// perform the round trip and decode the response
+	started := t.trace.TimeSince(t.trace.ZeroTime)
+	resp, err := txp.RoundTrip(ctx, query)
+	var answers []*DNSAnswer
+	if err == nil {
+		answers, err = dnsDecodeResponse(query, resp)
+	}
+	finished := t.trace.TimeSince(t.trace.ZeroTime)
+
+	// only include the addresses of A and AAAA answers into the archival
+	// answers because archival answers do not have fields for hints
+	var addrs []string
+	for _, answer := range answers {
+		if answer.Address != "" {
+			addrs = append(addrs, answer.Address)
+		}
+	}
+
+	// create and save a DNS observation
+	t.runtime.SaveObservations(&Observations{Queries: []*model.ArchivalDNSLookupResult{
+		measurexlite.NewArchivalDNSLookupResultFromRoundTrip(
+			t.trace.Index,
+			started,
+			txp,
+			query,
+			resp,
+			addrs,
+			err,
+			finished,
+			t.trace.Tags()...,
+		),
+	}})
+
+	return resp, answers, err
+}
+
 // HTTPTransaction implements Trace.
 func (t *measurexliteTrace) HTTPTransaction(
 	conn *HTTPConnection,
@@ -221,6 +272,31 @@ func (t *measurexliteTrace) NewDialerWithoutResolver() model.Dialer {
 	return t.trace.NewDialerWithoutResolver(t.runtime.Logger())
 }
 
+// NewParallelDNSOverHTTPSResolver implements Trace.
+func (t *measurexliteTrace) NewParallelDNSOverHTTPSResolver(URL string) model.Resolver {
+	return t.trace.NewParallelDNSOverHTTPSResolver(t.runtime.Logger(), URL)
+}
+
+// NewParallelDNSOverTCPResolver implements Trace.
+func (t *measurexliteTrace) NewParallelDNSOverTCPResolver(endpoint string) model.Resolver {
+	return t.wrapResolver(newParallelDNSOverTCPResolver(
+		t.runtime.Logger(),
+		t.trace.NewDialerWithoutResolver(t.runtime.Logger()),
+		endpoint,
+	))
+}
+
+// NewParallelDNSOverTLSResolver implements Trace.
+func (t *measurexliteTrace) NewParallelDNSOverTLSResolver(endpoint, sni string) model.Resolver {
+	return t.wrapResolver(newParallelDNSOverTLSResolver(
+		t.runtime.Logger(),
+		t.trace.NewDialerWithoutResolver(t.runtime.Logger()),
+		t.trace.NewTLSHandshakerStdlib(t.runtime.Logger()),
+		endpoint,
+		sni,
+	))
+}
+
 // NewParallelUDPResolver implements Trace.
 func (t *measurexliteTrace) NewParallelUDPResolver(endpoint string) model.Resolver {
 	return t.trace.NewParallelUDPResolver(
@@ -231,8 +307,8 @@ func (t *measurexliteTrace) NewParallelUDPResolver(endpoint string) model.Resolv
 }
 
 // NewQUICDialerWithoutResolver implements Trace.
-func (t *measurexliteTrace) NewQUICDialerWithoutResolver() model.QUICDialer {
-	return t.trace.NewQUICDialerWithoutResolver(netxlite.NewQUICListener(), t.runtime.Logger())
+func (t *measurexliteTrace) NewQUICDialerWithoutResolver(listener model.QUICListener) model.QUICDialer {
+	return newQUICDialerWithoutResolver(listener, t.runtime.Logger(), t.trace)
 }
 
 // NewStdlibResolver implements Trace.
@@ -245,6 +321,16 @@ func (t *measurexliteTrace) NewTLSHandshakerStdlib() model.TLSHandshaker {
 	return t.trace.NewTLSHandshakerStdlib(t.runtime.Logger())
 }
 
+// NewTLSHandshakerCryptoTLS implements Trace.
+func (t *measurexliteTrace) NewTLSHandshakerCryptoTLS() model.TLSHandshaker {
+	return newTLSHandshakerCryptoTLS(t.runtime.Logger(), t.trace)
+}
+
+// NewTLSHandshakerUTLS implements Trace.
+func (t *measurexliteTrace) NewTLSHandshakerUTLS(id *utls.ClientHelloID) model.TLSHandshaker {
+	return t.trace.NewTLSHandshakerUTLS(t.runtime.Logger(), id)
+}
+
 // ExtractObservations implements Trace.
 func (t *measurexliteTrace) ExtractObservations() []*Observations {
 	observations := &Observations{
@@ -262,3 +348,112 @@ func (t *measurexliteTrace) ExtractObservations() []*Observations {
 func (t *measurexliteTrace) Tags() []string {
 	return t.trace.Tags()
 }
+
+// WebSocketHandshake implements Trace.
+func (t *measurexliteTrace) WebSocketHandshake(conn *WebSocketConnection, req *http.Request) (*http.Response, error) {
+	started := t.trace.TimeSince(t.trace.ZeroTime)
+	resp, err := webSocketHandshake(conn, req)
+	finished := t.trace.TimeSince(t.trace.ZeroTime)
+
+	// the upgrade response has no body, hence the zero body snapshot size
+	t.runtime.saveHTTPRequestResults(measurexlite.NewArchivalHTTPRequestResult(
+		t.trace.Index,
+		started,
+		conn.Network,
+		conn.Address,
+		conn.TLSNegotiatedProtocol,
+		conn.Network,
+		req,
+		resp,
+		0,
+		nil,
+		err,
+		finished,
+		conn.Trace.Tags()...,
+	))
+	return resp, err
+}
+
+// WebSocketReadFrame implements Trace.
+func (t *measurexliteTrace) WebSocketReadFrame(conn *WebSocketConnection) (*WebSocketFrame, error) {
+	started := t.trace.TimeSince(t.trace.ZeroTime)
+	frame, err := webSocketReadFrame(conn)
+	finished := t.trace.TimeSince(t.trace.ZeroTime)
+	var count int
+	if frame != nil {
+		count = len(frame.Payload)
+	}
+	t.runtime.saveNetworkEvents(measurexlite.NewArchivalNetworkEvent(
+		t.trace.Index,
+		started,
+		webSocketFrameOperation("read", frame),
+		conn.Network,
+		conn.Address,
+		count,
+		err,
+		finished,
+		conn.Trace.Tags()...,
+	))
+	return frame, err
+}
+
+// WebSocketWriteFrame implements Trace.
+func (t *measurexliteTrace) WebSocketWriteFrame(conn *WebSocketConnection, frame *WebSocketFrame) error {
+	started := t.trace.TimeSince(t.trace.ZeroTime)
+	err := webSocketWriteFrame(conn, frame)
+	finished := t.trace.TimeSince(t.trace.ZeroTime)
+	t.runtime.saveNetworkEvents(measurexlite.NewArchivalNetworkEvent(
+		t.trace.Index,
+		started,
+		webSocketFrameOperation("write", frame),
+		conn.Network,
+		conn.Address,
+		len(frame.Payload),
+		err,
+		finished,
+		conn.Trace.Tags()...,
+	))
+	return err
+}
+
+// wrapResolver wraps a resolver such that the underlying trace sees its DNS round trips. We need
+// this wrapper for resolvers that [measurexlite.Trace] cannot construct directly.
+func (t *measurexliteTrace) wrapResolver(reso model.Resolver) model.Resolver {
+	return &measurexliteResolver{reso, t}
+}
+
+// measurexliteResolver is the [model.Resolver] returned by [measurexliteTrace.wrapResolver].
+type measurexliteResolver struct {
+	model.Resolver
+	t *measurexliteTrace
+}
+
+// LookupHost implements model.Resolver.
+func (r *measurexliteResolver) LookupHost(ctx context.Context, hostname string) ([]string, error) {
+	defer r.emitAnnotation("resolve_done")
+	r.emitAnnotation("resolve_start")
+	return r.Resolver.LookupHost(netxlite.ContextWithTrace(ctx, r.t.trace), hostname)
+}
+
+// LookupHTTPS implements model.Resolver.
+func (r *measurexliteResolver) LookupHTTPS(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+	defer r.emitAnnotation("resolve_done")
+	r.emitAnnotation("resolve_start")
+	return r.Resolver.LookupHTTPS(netxlite.ContextWithTrace(ctx, r.t.trace), domain)
+}
+
+// LookupNS implements model.Resolver.
+func (r *measurexliteResolver) LookupNS(ctx context.Context, domain string) ([]*net.NS, error) {
+	defer r.emitAnnotation("resolve_done")
+	r.emitAnnotation("resolve_start")
+	return r.Resolver.LookupNS(netxlite.ContextWithTrace(ctx, r.t.trace), domain)
+}
+
+func (r *measurexliteResolver) emitAnnotation(operation string) {
+	r.t.runtime.saveNetworkEvents(measurexlite.NewAnnotationArchivalNetworkEvent(
+		r.t.trace.Index,
+		r.t.trace.TimeSince(r.t.trace.ZeroTime),
+		operation,
+		r.t.trace.Tags()...,
+	))
+}
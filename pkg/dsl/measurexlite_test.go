@@ -3,6 +3,7 @@ package dsl
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -119,3 +120,47 @@ func TestMeasurexliteHTTPIncludeResponseBodySnapshot(t *testing.T) {
 		})
 	})
 }
+
+// TestMeasurexliteDNSOverTCPQueries checks whether we archive the queries
+// performed by DNS-over-TCP resolvers into the observations.
+func TestMeasurexliteDNSOverTCPQueries(t *testing.T) {
+	// create a TCP server that reads the query and closes the connection
+	listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buffer := make([]byte, 512)
+			_, _ = conn.Read(buffer)
+			conn.Close()
+		}
+	}()
+
+	// create and run the measurement pipeline
+	pipeline := DNSLookupTCP(listener.Addr().String())
+	meter := &NullProgressMeter{}
+	rtx := NewMeasurexliteRuntime(model.DiscardLogger, &NullMetrics{}, meter, time.Now())
+	output := pipeline.Run(context.Background(), rtx, NewValue("www.example.com"))
+	observations := ReduceObservations(rtx.ExtractObservations()...)
+
+	// make sure the lookup failed
+	if !IsErrDNSLookup(output.Error) {
+		t.Fatal("not an ErrDNSLookup", output.Error)
+	}
+
+	// make sure we have archived the A and AAAA queries
+	if len(observations.Queries) != 2 {
+		t.Fatal("expected two queries, got", len(observations.Queries))
+	}
+	for _, query := range observations.Queries {
+		if query.Engine != "tcp" {
+			t.Fatal("unexpected engine", query.Engine)
+		}
+		if query.Failure == nil {
+			t.Fatal("expected a failure")
+		}
+	}
+}
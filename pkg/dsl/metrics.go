@@ -14,6 +14,14 @@ type Metrics interface {
 	Success(name string)
 }
 
+// SkipMetrics is an OPTIONAL interface that [Metrics] may implement to count the
+// stages that did not run because their context was already done (e.g., because of
+// [Deadline]). We use a separate interface to avoid breaking existing [Metrics].
+type SkipMetrics interface {
+	// Skip increments the skipped counter for the given stage metric.
+	Skip(name string)
+}
+
 // NullMetrics implements [Metrics] but ignores events. The zero value of
 // this structure is ready to use.
 type NullMetrics struct{}
@@ -23,6 +31,11 @@ func (*NullMetrics) Error(name string) {
 	// nothing
 }
 
+// Skip implements SkipMetrics.
+func (*NullMetrics) Skip(name string) {
+	// nothing
+}
+
 // Snapshot implements Metrics.
 func (*NullMetrics) Snapshot() map[string]int64 {
 	return make(map[string]int64)
@@ -42,6 +55,7 @@ type AccountingMetrics struct {
 	fail map[string]int64
 	m    sync.Mutex
 	ok   map[string]int64
+	skip map[string]int64
 }
 
 // NewAccountingMetrics creates a new [*AccountingMetrics] instance.
@@ -50,6 +64,7 @@ func NewAccountingMetrics() *AccountingMetrics {
 		fail: map[string]int64{},
 		m:    sync.Mutex{},
 		ok:   map[string]int64{},
+		skip: map[string]int64{},
 	}
 }
 
@@ -60,6 +75,13 @@ func (am *AccountingMetrics) Error(name string) {
 	am.m.Unlock()
 }
 
+// Skip implements SkipMetrics.
+func (am *AccountingMetrics) Skip(name string) {
+	am.m.Lock()
+	am.skip[name]++
+	am.m.Unlock()
+}
+
 // Snapshot implements Metrics.
 func (am *AccountingMetrics) Snapshot() map[string]int64 {
 	out := make(map[string]int64)
@@ -70,6 +92,9 @@ func (am *AccountingMetrics) Snapshot() map[string]int64 {
 	for key, value := range am.ok {
 		out[key+"_success_count"] = value
 	}
+	for key, value := range am.skip {
+		out[key+"_skipped_count"] = value
+	}
 	am.m.Unlock()
 	return out
 }
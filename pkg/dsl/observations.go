@@ -21,6 +21,10 @@ type Observations struct {
 
 	// QUICHandshakes contains the QUIC handshakes results.
 	QUICHandshakes []*model.ArchivalTLSOrQUICHandshakeResult `json:"quic_handshakes"`
+
+	// SkippedStages contains the names of the stages that did not run because their
+	// context was already done (e.g., because the deadline set by [Deadline] expired).
+	SkippedStages []string `json:"skipped_stages"`
 }
 
 // NewObservations creates an empty set of [Observations].
@@ -32,6 +36,7 @@ func NewObservations() *Observations {
 		TCPConnect:     []*model.ArchivalTCPConnectResult{},
 		TLSHandshakes:  []*model.ArchivalTLSOrQUICHandshakeResult{},
 		QUICHandshakes: []*model.ArchivalTLSOrQUICHandshakeResult{},
+		SkippedStages:  []string{},
 	}
 }
 
@@ -45,6 +50,7 @@ func ReduceObservations(inputs ...*Observations) (output *Observations) {
 		output.Requests = append(output.Requests, input.Requests...)
 		output.TCPConnect = append(output.TCPConnect, input.TCPConnect...)
 		output.TLSHandshakes = append(output.TLSHandshakes, input.TLSHandshakes...)
+		output.SkippedStages = append(output.SkippedStages, input.SkippedStages...)
 	}
 	// TODO: we should also sort by T0 probably? or by transaction?
 	return
@@ -59,5 +65,6 @@ func (obs *Observations) AsMap() map[string]any {
 		"tcp_connect":     obs.TCPConnect,
 		"tls_handshakes":  obs.TLSHandshakes,
 		"quic_handshakes": obs.QUICHandshakes,
+		"skipped_stages":  obs.SkippedStages,
 	}
 }
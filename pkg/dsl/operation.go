@@ -9,7 +9,10 @@ type operation[A, B any] interface {
 	Run(ctx context.Context, rtx Runtime, input A) (B, error)
 }
 
-// wrapOperation adapts an [operation] to behave like a [Stage].
+// wrapOperation adapts an [operation] to behave like a [Stage]. The returned [Stage] does
+// not run the [operation] when the deadline set by [Deadline] already expired. In such a
+// case, unless the input is an error, the [Stage] records that it did not run and returns an
+// [ErrSkip] (see [maybeSkipStage]).
 func wrapOperation[A, B any](op operation[A, B]) Stage[A, B] {
 	return &wrapOperationStage[A, B]{op}
 }
@@ -28,6 +31,9 @@ func (sx *wrapOperationStage[A, B]) Run(ctx context.Context, rtx Runtime, input
 	if input.Error != nil {
 		return NewError[B](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[B](err)
+	}
 	output, err := sx.op.Run(ctx, rtx, input.Value)
 	if err != nil {
 		return NewError[B](err)
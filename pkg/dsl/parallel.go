@@ -2,26 +2,37 @@ package dsl
 
 import (
 	"context"
+	"encoding/json"
 	"sync"
 )
 
 // ParallelRun runs the given functions using the given number of workers and returns
-// a slice containing the result produced by each function. When the number of workers
-// is zero or negative, this function will use a single worker.
+// a slice containing the result produced by each function, in the same order in which
+// the functions were provided. When the number of workers is zero or negative, this
+// function will use a single worker.
 func ParallelRun[T any](ctx context.Context, parallelism int, workers ...Worker[T]) []T {
-	// create channel for distributing workers
-	inputs := make(chan Worker[T])
+	return ParallelRunWithConcurrencyBudget(ctx, nil, parallelism, workers...)
+}
+
+// ParallelRunWithConcurrencyBudget is like [ParallelRun] except that each worker acquires
+// a slot of the given [*ConcurrencyBudget] before running. Use a nil budget to disable
+// limiting the concurrency. Parallel stages use this function with the budget returned by
+// [Runtime.ConcurrencyBudget] to limit the overall concurrency.
+func ParallelRunWithConcurrencyBudget[T any](
+	ctx context.Context, budget *ConcurrencyBudget, parallelism int, workers ...Worker[T]) []T {
+	// create channel for distributing the indexes of the workers
+	inputs := make(chan int)
 
 	// distribute inputs
 	go func() {
 		defer close(inputs)
-		for _, worker := range workers {
-			inputs <- worker
+		for idx := range workers {
+			inputs <- idx
 		}
 	}()
 
-	// create channel for collecting outputs
-	outputs := make(chan T)
+	// create the slice for collecting outputs
+	results := make([]T, len(workers))
 
 	// spawn all the workers
 	if parallelism < 1 {
@@ -32,36 +43,54 @@ func ParallelRun[T any](ctx context.Context, parallelism int, workers ...Worker[
 		waiter.Add(1)
 		go func() {
 			defer waiter.Done()
-			for worker := range inputs {
-				outputs <- worker.Produce(ctx)
+			for widx := range inputs {
+				// Note: each goroutine writes distinct slice elements
+				results[widx] = concurrencyBudgetRun(ctx, budget, workers[widx].Produce)
 			}
 		}()
 	}
 
-	// wait for workers to terminate
-	go func() {
-		waiter.Wait()
-		close(outputs)
-	}()
+	// wait for workers to terminate without holding a slot to avoid deadlocks
+	concurrencyBudgetLend(ctx, budget, waiter.Wait)
+	return results
+}
+
+// parallelArguments contains the arguments of stages using [ParallelRun].
+type parallelArguments struct {
+	// Parallelism is the OPTIONAL number of background goroutines to use; when
+	// this value is zero or negative, the stage uses its default parallelism.
+	Parallelism int `json:"parallelism,omitempty"`
+}
 
-	// collect the results
-	var results []T
-	for entry := range outputs {
-		results = append(results, entry)
+// parallelismOrDefault returns the configured parallelism or the given default.
+func (args *parallelArguments) parallelismOrDefault(defaultParallelism int) int {
+	if args.Parallelism <= 0 {
+		return defaultParallelism
 	}
-	return results
+	return args.Parallelism
 }
 
 // RunStagesInParallel returns a stage that runs the given stages in parallel using
-// a pool of background goroutines.
+// a pool of background goroutines. This function is equivalent to calling
+// [RunStagesInParallelWithParallelism] with zero parallelism.
 func RunStagesInParallel(stages ...Stage[*Void, *Void]) Stage[*Void, *Void] {
-	return &runStagesInParallelStage{stages}
+	return RunStagesInParallelWithParallelism(0, stages...)
+}
+
+// RunStagesInParallelWithParallelism is like [RunStagesInParallel] but allows to configure
+// the number of background goroutines. When parallelism is zero or negative, we use
+// two background goroutines.
+func RunStagesInParallelWithParallelism(parallelism int, stages ...Stage[*Void, *Void]) Stage[*Void, *Void] {
+	return &runStagesInParallelStage{parallelArguments{parallelism}, stages}
 }
 
 type runStagesInParallelStage struct {
+	args   parallelArguments
 	stages []Stage[*Void, *Void]
 }
 
+const runStagesInParallelDefaultParallelism = 2
+
 const runStagesInParallelStageName = "run_stages_in_parallel"
 
 // ASTNode implements Stage.
@@ -72,7 +101,7 @@ func (sx *runStagesInParallelStage) ASTNode() *SerializableASTNode {
 	}
 	return &SerializableASTNode{
 		StageName: runStagesInParallelStageName,
-		Arguments: nil,
+		Arguments: &sx.args,
 		Children:  nodes,
 	}
 }
@@ -81,7 +110,8 @@ type runStagesInParallelLoader struct{}
 
 // Load implements ASTLoaderRule.
 func (*runStagesInParallelLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
-	if err := loader.LoadEmptyArguments(node); err != nil {
+	var args parallelArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
 		return nil, err
 	}
 	runnables, err := loader.LoadChildren(node)
@@ -89,7 +119,7 @@ func (*runStagesInParallelLoader) Load(loader *ASTLoader, node *LoadableASTNode)
 		return nil, err
 	}
 	children := RunnableASTNodeListToStageList[*Void, *Void](runnables...)
-	stage := RunStagesInParallel(children...)
+	stage := RunStagesInParallelWithParallelism(args.Parallelism, children...)
 	return &StageRunnableASTNode[*Void, *Void]{stage}, nil
 }
 
@@ -103,6 +133,9 @@ func (sx *runStagesInParallelStage) Run(ctx context.Context, rtx Runtime, input
 	if input.Error != nil {
 		return NewError[*Void](input.Error)
 	}
+	if err := maybeSkipStage(ctx, rtx, sx); err != nil {
+		return NewError[*Void](err)
+	}
 
 	// initialize the workers
 	var workers []Worker[Maybe[*Void]]
@@ -111,8 +144,8 @@ func (sx *runStagesInParallelStage) Run(ctx context.Context, rtx Runtime, input
 	}
 
 	// parallel run
-	const parallelism = 2
-	results := ParallelRun(ctx, parallelism, workers...)
+	parallelism := sx.args.parallelismOrDefault(runStagesInParallelDefaultParallelism)
+	results := ParallelRunWithConcurrencyBudget(ctx, rtx.ConcurrencyBudget(), parallelism, workers...)
 
 	// route exceptions
 	if err := catch(results...); err != nil {
@@ -0,0 +1,97 @@
+package dsl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/quic-go/quic-go"
+)
+
+// newQUICDialerWithoutResolver is like [netxlite.NewQUICDialerWithoutResolver] except that we
+// preserve the [*netxlite.ErrWrapper] returned by the config VerifyPeerCertificate callback, which
+// quic-go would otherwise convert to a CRYPTO_ERROR that netxlite classifies as a generic invalid
+// certificate failure. We need this dialer to report the [FailureSSLPinMismatch] failure.
+//
+// The trace argument is OPTIONAL and, when nil, we use the trace inside the context.
+func newQUICDialerWithoutResolver(
+	listener model.QUICListener, logger model.DebugLogger, trace model.Trace) model.QUICDialer {
+	return &quicDialerVerifyErrors{netxlite.NewQUICDialerWithoutResolver(listener, logger), trace}
+}
+
+type quicDialerVerifyErrors struct {
+	dialer model.QUICDialer
+	trace  model.Trace
+}
+
+// DialContext implements model.QUICDialer.
+func (d *quicDialerVerifyErrors) DialContext(ctx context.Context,
+	address string, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+	trace := d.trace
+	if trace == nil {
+		trace = netxlite.ContextTraceOrDefault(ctx)
+	}
+	verifyTrace := &quicVerifyErrorsTrace{Trace: trace}
+
+	if verify := tlsConfig.VerifyPeerCertificate; verify != nil {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+			err := verify(rawCerts, chains)
+			verifyTrace.saveVerifyError(err)
+			return err
+		}
+	}
+
+	qconn, err := d.dialer.DialContext(netxlite.ContextWithTrace(ctx, verifyTrace), address, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, verifyTrace.replaceError(err)
+	}
+	return qconn, nil
+}
+
+// CloseIdleConnections implements model.QUICDialer.
+func (d *quicDialerVerifyErrors) CloseIdleConnections() {
+	d.dialer.CloseIdleConnections()
+}
+
+// quicVerifyErrorsTrace is a [model.Trace] replacing the error of a failed QUIC
+// handshake with the error returned by the VerifyPeerCertificate callback, if any.
+type quicVerifyErrorsTrace struct {
+	model.Trace
+	err *netxlite.ErrWrapper
+	mu  sync.Mutex
+}
+
+// saveVerifyError saves the given error if it is a [*netxlite.ErrWrapper].
+func (t *quicVerifyErrorsTrace) saveVerifyError(err error) {
+	var wrapper *netxlite.ErrWrapper
+	if errors.As(err, &wrapper) {
+		t.mu.Lock()
+		t.err = wrapper
+		t.mu.Unlock()
+	}
+}
+
+// replaceError returns the saved error, if any, and otherwise the given error.
+func (t *quicVerifyErrorsTrace) replaceError(err error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	return err
+}
+
+// OnQUICHandshakeDone implements model.Trace.
+func (t *quicVerifyErrorsTrace) OnQUICHandshakeDone(started time.Time, remoteAddr string,
+	qconn quic.EarlyConnection, config *tls.Config, err error, finished time.Time) {
+	if err != nil {
+		err = t.replaceError(err)
+	}
+	t.Trace.OnQUICHandshakeDone(started, remoteAddr, qconn, config, err, finished)
+}
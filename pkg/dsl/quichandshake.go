@@ -3,10 +3,9 @@ package dsl
 import (
 	"context"
 	"encoding/json"
-	"time"
 
 	"github.com/ooni/probe-engine/pkg/measurexlite"
-	"github.com/quic-go/quic-go"
+	"github.com/ooni/probe-engine/pkg/netxlite"
 )
 
 // QUICHandshake returns a stage that performs a QUIC handshake.
@@ -76,8 +75,34 @@ func (sx *quicHandshakeOperation) Run(ctx context.Context, rtx Runtime, endpoint
 		return nil, &ErrException{err}
 	}
 
+	// obtain QUIC config or return an exception
+	quicConfig, err := config.QUICConfig()
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+
+	// obtain the SPKI pins or return an exception
+	pins, err := parseSPKIPins(config.SPKIPins)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+	if len(pins) > 0 {
+		chains := config.spkiPinsChains(tlsConfig.RootCAs)
+		tlsConfig.VerifyPeerCertificate = newSPKIPinsVerifier(pins, netxlite.QUICHandshakeOperation, chains)
+	}
+
+	// make sure the uTLS ClientHello ID is valid and otherwise return an exception, given
+	// that quic-go does not allow us to use uTLS to parrot the ClientHello
+	clientHelloID, err := newClientHelloID(config.ClientHelloID)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+	if clientHelloID != nil {
+		return nil, &ErrException{ErrQUICClientHelloIDNotSupported}
+	}
+
 	// create trace
-	trace := rtx.NewTrace(config.Tags...)
+	trace := rtx.NewTrace(endpoint.tags(config.Tags...)...)
 
 	// start the operation logger
 	ol := measurexlite.NewOperationLogger(
@@ -90,13 +115,16 @@ func (sx *quicHandshakeOperation) Run(ctx context.Context, rtx Runtime, endpoint
 	)
 
 	// setup
-	quicDialer := trace.NewQUICDialerWithoutResolver()
-	const timeout = 10 * time.Second
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	quicListener := netxlite.NewQUICListener()
+	if config.InitialPacketSize > 0 {
+		quicListener = newQUICPaddingListener(quicListener, config.InitialPacketSize)
+	}
+	quicDialer := trace.NewQUICDialerWithoutResolver(quicListener)
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(config.Timeout, defaultQUICHandshakeTimeout))
 	defer cancel()
 
 	// handshake
-	quicConn, err := quicDialer.DialContext(ctx, endpoint.Address, tlsConfig, &quic.Config{})
+	quicConn, err := quicDialer.DialContext(ctx, endpoint.Address, tlsConfig, quicConfig)
 
 	// stop the operation logger
 	ol.Stop(err)
@@ -2,12 +2,21 @@ package dsl
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-engine/pkg/netxlite"
 	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/quic-go/quic-go"
 )
 
 func TestQUICHandshake(t *testing.T) {
@@ -40,4 +49,221 @@ func TestQUICHandshake(t *testing.T) {
 			t.Fatal("not an ErrQUICHandshake", results.Error)
 		}
 	})
+
+	t.Run("we return an exception when using a ClientHello ID", func(t *testing.T) {
+		// create measurement pipeline
+		pipeline := QUICHandshake(QUICHandshakeOptionClientHelloID("chrome"))
+
+		// create the endpoint
+		endpoint := NewValue(&Endpoint{
+			Address: "127.0.0.1:443",
+			Domain:  "www.example.com",
+		})
+
+		// perform the measurement
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+
+		// make sure the error is correct
+		if !errors.Is(results.Error, ErrQUICClientHelloIDNotSupported) {
+			t.Fatal("unexpected error", results.Error)
+		}
+	})
+
+	t.Run("we return an exception when using an invalid ClientHello ID", func(t *testing.T) {
+		pipeline := QUICHandshake(QUICHandshakeOptionClientHelloID("antani"))
+		endpoint := NewValue(&Endpoint{
+			Address: "127.0.0.1:443",
+			Domain:  "www.example.com",
+		})
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+		if !IsErrException(results.Error) {
+			t.Fatal("not an ErrException", results.Error)
+		}
+	})
+
+	t.Run("we can tune the QUIC handshake", func(t *testing.T) {
+		// create a TLS config using a self-signed certificate for example.com
+		httpServer := httptest.NewUnstartedServer(http.NotFoundHandler())
+		httpServer.StartTLS()
+		defer httpServer.Close()
+		serverTLSConfig := httpServer.TLS.Clone()
+		serverTLSConfig.NextProtos = []string{"h3"}
+		certPEM := string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: httpServer.Certificate().Raw,
+		}))
+		digest := sha256.Sum256(httpServer.Certificate().RawSubjectPublicKeyInfo)
+		goodPin := base64.StdEncoding.EncodeToString(digest[:])
+		badPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+		// create a QUIC server recording the size of the first datagram
+		pconn := runtimex.Try1(net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}))
+		recorder := &quicHandshakeRecorderConn{PacketConn: pconn}
+		listener := runtimex.Try1(quic.Listen(recorder, serverTLSConfig, &quic.Config{}))
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept(context.Background())
+				if err != nil {
+					return
+				}
+				defer conn.CloseWithError(0, "")
+			}
+		}()
+
+		// create the endpoint
+		endpoint := NewValue(&Endpoint{
+			Address: pconn.LocalAddr().String(),
+			Domain:  "example.com",
+		})
+
+		// define the expectations
+		var testcases = []struct {
+			name       string
+			options    []QUICHandshakeOption
+			failure    string
+			packetSize int
+		}{{
+			name: "with a fake SNI and the correct verify name",
+			options: []QUICHandshakeOption{
+				QUICHandshakeOptionInitialPacketSize(1400),
+				QUICHandshakeOptionSNI("www.example.org"),
+				QUICHandshakeOptionVerifyName("example.com"),
+				QUICHandshakeOptionVersions("v1"),
+			},
+			failure:    "",
+			packetSize: 1400,
+		}, {
+			name: "with a fake SNI and the wrong verify name",
+			options: []QUICHandshakeOption{
+				QUICHandshakeOptionSNI("example.com"),
+				QUICHandshakeOptionVerifyName("www.example.org"),
+			},
+			failure:    netxlite.FailureSSLInvalidCertificate,
+			packetSize: 1252,
+		}, {
+			name: "with the correct verify name and a matching SPKI pin",
+			options: []QUICHandshakeOption{
+				QUICHandshakeOptionSNI("www.example.org"),
+				QUICHandshakeOptionSPKIPins(goodPin),
+				QUICHandshakeOptionVerifyName("example.com"),
+			},
+			failure:    "",
+			packetSize: 1252,
+		}, {
+			name: "with the correct verify name and no matching SPKI pin",
+			options: []QUICHandshakeOption{
+				QUICHandshakeOptionSNI("www.example.org"),
+				QUICHandshakeOptionSPKIPins(badPin),
+				QUICHandshakeOptionVerifyName("example.com"),
+			},
+			failure:    FailureSSLPinMismatch,
+			packetSize: 1252,
+		}}
+
+		for _, tc := range testcases {
+			t.Run(tc.name, func(t *testing.T) {
+				// create measurement pipeline
+				options := append([]QUICHandshakeOption{
+					QUICHandshakeOptionX509Certs(certPEM),
+				}, tc.options...)
+				pipeline := QUICHandshake(options...)
+
+				// perform the measurement
+				rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+				defer rtx.Close()
+				results := pipeline.Run(context.Background(), rtx, endpoint)
+
+				// make sure the result is correct
+				switch {
+				case tc.failure == "" && results.Error != nil:
+					t.Fatal(results.Error)
+				case tc.failure != "" && !IsErrQUICHandshake(results.Error):
+					t.Fatal("not an ErrQUICHandshake", results.Error)
+				case tc.failure != "" && results.Error.Error() != tc.failure:
+					t.Fatal("unexpected failure", results.Error.Error())
+				}
+
+				// make sure we archived the same failure
+				observations := ReduceObservations(rtx.ExtractObservations()...)
+				if len(observations.QUICHandshakes) != 1 {
+					t.Fatal("expected a single QUIC handshake")
+				}
+				failure := observations.QUICHandshakes[0].Failure
+				switch {
+				case tc.failure == "" && failure != nil:
+					t.Fatal("unexpected failure", *failure)
+				case tc.failure != "" && (failure == nil || *failure != tc.failure):
+					t.Fatal("unexpected failure", failure)
+				}
+
+				// make sure the first datagram had the expected size
+				if size := recorder.firstSize(); size != tc.packetSize {
+					t.Fatal("unexpected first datagram size", size)
+				}
+			})
+		}
+	})
+
+	t.Run("we return an exception with invalid QUIC options", func(t *testing.T) {
+		for _, option := range []QUICHandshakeOption{
+			QUICHandshakeOptionInitialPacketSize(-1),
+			QUICHandshakeOptionInitialPacketSize(1 << 20),
+			QUICHandshakeOptionVersions("v3"),
+		} {
+			// create measurement pipeline
+			pipeline := QUICHandshake(option)
+
+			// create the endpoint
+			endpoint := NewValue(&Endpoint{
+				Address: "127.0.0.1:443",
+				Domain:  "www.example.com",
+			})
+
+			// perform the measurement
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, endpoint)
+
+			// make sure the error is an exception
+			if !IsErrException(results.Error) {
+				t.Fatal("not an ErrException", results.Error)
+			}
+		}
+	})
+}
+
+// quicHandshakeRecorderConn is a net.PacketConn recording the size of the first datagram
+// sent by the last client, which starts with an Initial packet.
+type quicHandshakeRecorderConn struct {
+	net.PacketConn
+	mu    sync.Mutex
+	last  string
+	sizes map[string]int
+}
+
+// ReadFrom implements net.PacketConn.
+func (c *quicHandshakeRecorderConn) ReadFrom(data []byte) (int, net.Addr, error) {
+	count, addr, err := c.PacketConn.ReadFrom(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sizes == nil {
+		c.sizes = make(map[string]int)
+	}
+	if _, found := c.sizes[addr.String()]; !found && quicIsInitialPacket(data[:count]) {
+		c.sizes[addr.String()] = count
+		c.last = addr.String()
+	}
+	return count, addr, nil
+}
+
+// firstSize returns the size of the first datagram sent by the last client.
+func (c *quicHandshakeRecorderConn) firstSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sizes[c.last]
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"time"
 
 	"github.com/quic-go/quic-go"
 )
@@ -36,32 +37,84 @@ type QUICHandshakeOption func(config *quicHandshakeConfig)
 // setters, and the conversion from config to list of options.
 
 type quicHandshakeConfig struct {
-	ALPN       []string `json:"alpn,omitempty"`
-	SkipVerify bool     `json:"skip_verify,omitempty"`
-	SNI        string   `json:"sni,omitempty"`
-	Tags       []string `json:"tags,omitempty"`
-	X509Certs  []string `json:"x509_certs,omitempty"`
+	ALPN                 []string      `json:"alpn,omitempty"`
+	CipherSuites         []string      `json:"cipher_suites,omitempty"`
+	ClientHelloID        string        `json:"client_hello_id,omitempty"`
+	Curves               []string      `json:"curves,omitempty"`
+	HandshakeIdleTimeout time.Duration `json:"handshake_idle_timeout,omitempty"`
+	InitialPacketSize    int           `json:"initial_packet_size,omitempty"`
+	MaxIdleTimeout       time.Duration `json:"max_idle_timeout,omitempty"`
+	MaxVersion           string        `json:"max_version,omitempty"`
+	MinVersion           string        `json:"min_version,omitempty"`
+	SkipVerify           bool          `json:"skip_verify,omitempty"`
+	SNI                  string        `json:"sni,omitempty"`
+	SPKIPins             []string      `json:"spki_pins,omitempty"`
+	Tags                 []string      `json:"tags,omitempty"`
+	Timeout              time.Duration `json:"timeout,omitempty"`
+	VerifyName           string        `json:"verify_name,omitempty"`
+	Versions             []string      `json:"versions,omitempty"`
+	X509Certs            []string      `json:"x509_certs,omitempty"`
 }
 
 func (c *quicHandshakeConfig) options() (options []QUICHandshakeOption) {
 	if len(c.ALPN) > 0 {
 		options = append(options, QUICHandshakeOptionALPN(c.ALPN...))
 	}
+	if len(c.CipherSuites) > 0 {
+		options = append(options, QUICHandshakeOptionCipherSuites(c.CipherSuites...))
+	}
+	if c.ClientHelloID != "" {
+		options = append(options, QUICHandshakeOptionClientHelloID(c.ClientHelloID))
+	}
+	if len(c.Curves) > 0 {
+		options = append(options, QUICHandshakeOptionCurves(c.Curves...))
+	}
+	if c.HandshakeIdleTimeout > 0 {
+		options = append(options, QUICHandshakeOptionHandshakeIdleTimeout(c.HandshakeIdleTimeout))
+	}
+	if c.InitialPacketSize != 0 {
+		options = append(options, QUICHandshakeOptionInitialPacketSize(c.InitialPacketSize))
+	}
+	if c.MaxIdleTimeout > 0 {
+		options = append(options, QUICHandshakeOptionMaxIdleTimeout(c.MaxIdleTimeout))
+	}
+	if c.MaxVersion != "" {
+		options = append(options, QUICHandshakeOptionMaxVersion(c.MaxVersion))
+	}
+	if c.MinVersion != "" {
+		options = append(options, QUICHandshakeOptionMinVersion(c.MinVersion))
+	}
 	if c.SkipVerify {
 		options = append(options, QUICHandshakeOptionSkipVerify(c.SkipVerify))
 	}
 	if c.SNI != "" {
 		options = append(options, QUICHandshakeOptionSNI(c.SNI))
 	}
+	if len(c.SPKIPins) > 0 {
+		options = append(options, QUICHandshakeOptionSPKIPins(c.SPKIPins...))
+	}
 	if len(c.Tags) > 0 {
 		options = append(options, QUICHandshakeOptionTags(c.Tags...))
 	}
+	if c.Timeout > 0 {
+		options = append(options, QUICHandshakeOptionTimeout(c.Timeout))
+	}
+	if c.VerifyName != "" {
+		options = append(options, QUICHandshakeOptionVerifyName(c.VerifyName))
+	}
+	if len(c.Versions) > 0 {
+		options = append(options, QUICHandshakeOptionVersions(c.Versions...))
+	}
 	if len(c.X509Certs) > 0 {
 		options = append(options, QUICHandshakeOptionX509Certs(c.X509Certs...))
 	}
 	return
 }
 
+// ErrQUICClientHelloIDNotSupported is returned when the QUIC handshake is configured to use
+// a uTLS ClientHello ID, which the QUIC library we use does not support yet.
+var ErrQUICClientHelloIDNotSupported = errors.New("dsl: client_hello_id is not supported by QUIC yet")
+
 // ErrInvalidCert is returned when we encounter an invalid PEM-encoded certificate.
 var ErrInvalidCert = errors.New("dsl: invalid PEM-encoded certificate")
 
@@ -86,9 +139,83 @@ func (config *quicHandshakeConfig) TLSConfig() (*tls.Config, error) {
 		out.RootCAs = certPool
 	}
 
+	if err := applyTLSConstraints(out, config.MinVersion, config.MaxVersion, config.CipherSuites, config.Curves); err != nil {
+		return nil, err
+	}
+
+	// When we need to verify the certificate against a name other than the SNI, we disable the
+	// default verification and verify the certificate chain during the handshake ourselves.
+	if config.VerifyName != "" && !config.SkipVerify {
+		verifyChains := config.spkiPinsChains(out.RootCAs)
+		out.InsecureSkipVerify = true
+		out.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			_, err := verifyChains(rawCerts, verifiedChains)
+			return err
+		}
+	}
+
+	return out, nil
+}
+
+// spkiPinsChains returns the function returning the chains on which we enforce the SPKI pins
+// using the given root CAs. When we verify the certificate against a name other than the SNI,
+// this function verifies the certificate and returns the chains built by the verification.
+func (config *quicHandshakeConfig) spkiPinsChains(rootCAs *x509.CertPool) spkiPinsChainsFunc {
+	switch {
+	case config.SkipVerify:
+		return spkiPinsLeaf
+	case config.VerifyName != "":
+		verifyConfig := &tls.Config{RootCAs: rootCAs, ServerName: config.VerifyName}
+		return func(rawCerts [][]byte, _ [][]*x509.Certificate) ([][]*x509.Certificate, error) {
+			var certs []*x509.Certificate
+			for _, rawCert := range rawCerts {
+				cert, err := x509.ParseCertificate(rawCert)
+				if err != nil {
+					return nil, err
+				}
+				certs = append(certs, cert)
+			}
+			return tlsVerifyPeerCertificates(certs, verifyConfig)
+		}
+	default:
+		return spkiPinsVerifiedChains
+	}
+}
+
+// quicMaxInitialPacketSize is the maximum initial packet size we allow, which is the
+// maximum payload of a UDP datagram using IPv4.
+const quicMaxInitialPacketSize = 65507
+
+// QUICConfig returns the QUIC config or an error if the config is invalid.
+func (config *quicHandshakeConfig) QUICConfig() (*quic.Config, error) {
+	if config.InitialPacketSize < 0 || config.InitialPacketSize > quicMaxInitialPacketSize {
+		return nil, &ErrInvalidInitialPacketSize{config.InitialPacketSize}
+	}
+	out := &quic.Config{
+		HandshakeIdleTimeout: config.HandshakeIdleTimeout,
+		MaxIdleTimeout:       config.MaxIdleTimeout,
+	}
+	for _, name := range config.Versions {
+		version, err := parseQUICVersion(name)
+		if err != nil {
+			return nil, err
+		}
+		out.Versions = append(out.Versions, version)
+	}
 	return out, nil
 }
 
+// parseQUICVersion maps a QUIC version name (i.e., "v1", "v2", or "draft-29") to the
+// corresponding value. The names are the ones used by quic-go.
+func parseQUICVersion(name string) (quic.VersionNumber, error) {
+	for _, version := range []quic.VersionNumber{quic.Version1, quic.Version2, quic.VersionDraft29} {
+		if version.String() == name {
+			return version, nil
+		}
+	}
+	return 0, &ErrInvalidQUICVersion{name}
+}
+
 // QUICHandshakeOptionALPN configures the ALPN.
 func QUICHandshakeOptionALPN(value ...string) QUICHandshakeOption {
 	return func(config *quicHandshakeConfig) {
@@ -96,6 +223,73 @@ func QUICHandshakeOptionALPN(value ...string) QUICHandshakeOption {
 	}
 }
 
+// QUICHandshakeOptionCipherSuites is like [TLSHandshakeOptionCipherSuites]. Because QUIC
+// always uses TLS 1.3, for which Go does not allow to configure the cipher suites, this option
+// has no effect but we accept it to serve the same configuration to TLS and QUIC.
+func QUICHandshakeOptionCipherSuites(value ...string) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.CipherSuites = value
+	}
+}
+
+// QUICHandshakeOptionCurves is like [TLSHandshakeOptionCurves].
+func QUICHandshakeOptionCurves(value ...string) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.Curves = value
+	}
+}
+
+// QUICHandshakeOptionHandshakeIdleTimeout configures the idle timeout before completing
+// the handshake. The default is the quic-go default (i.e., 5 seconds).
+func QUICHandshakeOptionHandshakeIdleTimeout(value time.Duration) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.HandshakeIdleTimeout = value
+	}
+}
+
+// QUICHandshakeOptionInitialPacketSize configures the minimum size of the UDP datagrams
+// carrying Initial packets, which we pad with zero bytes. Because quic-go already pads these
+// datagrams to about 1250 bytes, smaller values have no effect. Note that the network events
+// in the [Observations] contain the size of the datagrams before padding.
+func QUICHandshakeOptionInitialPacketSize(value int) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.InitialPacketSize = value
+	}
+}
+
+// QUICHandshakeOptionMaxIdleTimeout configures the maximum idle timeout after the handshake
+// has completed. The default is the quic-go default (i.e., 30 seconds).
+func QUICHandshakeOptionMaxIdleTimeout(value time.Duration) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.MaxIdleTimeout = value
+	}
+}
+
+// QUICHandshakeOptionMaxVersion is like [TLSHandshakeOptionMaxVersion]. Because QUIC
+// requires TLS 1.3, setting a lower maximum version causes the handshake to fail.
+func QUICHandshakeOptionMaxVersion(value string) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.MaxVersion = value
+	}
+}
+
+// QUICHandshakeOptionMinVersion is like [TLSHandshakeOptionMinVersion].
+func QUICHandshakeOptionMinVersion(value string) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.MinVersion = value
+	}
+}
+
+// QUICHandshakeOptionClientHelloID configures the uTLS ClientHello parrot to use (see
+// [TLSHandshakeOptionClientHelloID]). We accept this option such that the backend can serve
+// the same configuration to TLS and QUIC, but the QUIC library we use does not support uTLS
+// yet, so the QUIC handshake returns an [ErrException] when this option is set.
+func QUICHandshakeOptionClientHelloID(value string) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.ClientHelloID = value
+	}
+}
+
 // QUICHandshakeOptionSkipVerify allows to disable certificate verification.
 func QUICHandshakeOptionSkipVerify(value bool) QUICHandshakeOption {
 	return func(config *quicHandshakeConfig) {
@@ -117,6 +311,13 @@ func QUICHandshakeOptionSNI(value string) QUICHandshakeOption {
 	}
 }
 
+// QUICHandshakeOptionSPKIPins is like [TLSHandshakeOptionSPKIPins].
+func QUICHandshakeOptionSPKIPins(value ...string) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.SPKIPins = value
+	}
+}
+
 // QUICHandshakeOptionTags allows to configure the tags to include into the measurement.
 func QUICHandshakeOptionTags(tags ...string) QUICHandshakeOption {
 	return func(config *quicHandshakeConfig) {
@@ -124,6 +325,31 @@ func QUICHandshakeOptionTags(tags ...string) QUICHandshakeOption {
 	}
 }
 
+// QUICHandshakeOptionTimeout allows to configure the timeout; the default is 10s.
+func QUICHandshakeOptionTimeout(value time.Duration) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.Timeout = value
+	}
+}
+
+// QUICHandshakeOptionVerifyName configures the name against which we verify the certificate,
+// which is the SNI by default. Use this option along with [QUICHandshakeOptionSNI] to send a fake
+// SNI while still verifying the certificate against the real name of the server.
+func QUICHandshakeOptionVerifyName(value string) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.VerifyName = value
+	}
+}
+
+// QUICHandshakeOptionVersions configures the QUIC versions we allow (i.e., "v1", "v2", and
+// "draft-29"). The first version is the one we use for the first Initial packet. The default
+// is the quic-go default.
+func QUICHandshakeOptionVersions(value ...string) QUICHandshakeOption {
+	return func(config *quicHandshakeConfig) {
+		config.Versions = value
+	}
+}
+
 // ErrQUICHandshake wraps errors occurred during a QUIC handshake operation.
 type ErrQUICHandshake struct {
 	Err error
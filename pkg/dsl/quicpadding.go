@@ -0,0 +1,63 @@
+package dsl
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/quic-go/quic-go"
+)
+
+// newQUICPaddingListener wraps the given [model.QUICListener] such that the UDP datagrams
+// carrying QUIC Initial packets are padded with zero bytes to be at least size bytes. This
+// is the only way to control the initial packet size, since quic-go does not allow to
+// configure it. The QUIC specification allows to append bytes after the last packet in a
+// datagram and the receiver discards them because they are not a valid QUIC packet.
+func newQUICPaddingListener(listener model.QUICListener, size int) model.QUICListener {
+	return &quicPaddingListener{listener, size}
+}
+
+type quicPaddingListener struct {
+	model.QUICListener
+	size int
+}
+
+// Listen implements model.QUICListener.
+func (ql *quicPaddingListener) Listen(addr *net.UDPAddr) (model.UDPLikeConn, error) {
+	pconn, err := ql.QUICListener.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &quicPaddingConn{pconn, ql.size}, nil
+}
+
+type quicPaddingConn struct {
+	model.UDPLikeConn
+	size int
+}
+
+// WriteTo implements model.UDPLikeConn.
+func (c *quicPaddingConn) WriteTo(data []byte, addr net.Addr) (int, error) {
+	if len(data) >= c.size || !quicIsInitialPacket(data) {
+		return c.UDPLikeConn.WriteTo(data, addr)
+	}
+	padded := make([]byte, c.size)
+	copy(padded, data)
+	if _, err := c.UDPLikeConn.WriteTo(padded, addr); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// quicIsInitialPacket returns whether the given datagram starts with a QUIC Initial packet. The
+// type of Initial packets is 0b00 for QUIC v1 and draft-29 and 0b01 for QUIC v2 (RFC 9369).
+func quicIsInitialPacket(data []byte) bool {
+	if len(data) < 5 || data[0]&0x80 == 0 {
+		return false // too short or short header packet
+	}
+	packetType := (data[0] & 0x30) >> 4
+	if quic.VersionNumber(binary.BigEndian.Uint32(data[1:5])) == quic.Version2 {
+		return packetType == 0b01
+	}
+	return packetType == 0b00
+}
@@ -0,0 +1,79 @@
+package dsl
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/quic-go/quic-go"
+)
+
+// quicPaddingRecorderConn is a model.UDPLikeConn recording the size of each write.
+type quicPaddingRecorderConn struct {
+	model.UDPLikeConn
+	sizes []int
+}
+
+// WriteTo implements model.UDPLikeConn.
+func (c *quicPaddingRecorderConn) WriteTo(data []byte, addr net.Addr) (int, error) {
+	c.sizes = append(c.sizes, len(data))
+	return len(data), nil
+}
+
+// quicPaddingNewPacket creates a fake long header packet with the given type and version.
+func quicPaddingNewPacket(packetType byte, version quic.VersionNumber, size int) []byte {
+	packet := make([]byte, size)
+	packet[0] = 0xc0 | packetType<<4
+	binary.BigEndian.PutUint32(packet[1:], uint32(version))
+	return packet
+}
+
+func TestQUICPaddingConn(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		data   []byte
+		expect int
+	}{{
+		name:   "with a QUIC v1 Initial packet",
+		data:   quicPaddingNewPacket(0b00, quic.Version1, 1252),
+		expect: 1400,
+	}, {
+		name:   "with a QUIC v2 Initial packet",
+		data:   quicPaddingNewPacket(0b01, quic.Version2, 1252),
+		expect: 1400,
+	}, {
+		name:   "with a QUIC v1 Handshake packet",
+		data:   quicPaddingNewPacket(0b10, quic.Version1, 300),
+		expect: 300,
+	}, {
+		name:   "with a QUIC v2 0-RTT packet",
+		data:   quicPaddingNewPacket(0b10, quic.Version2, 300),
+		expect: 300,
+	}, {
+		name:   "with a short header packet",
+		data:   []byte{0x40, 1, 2, 3, 4, 5, 6},
+		expect: 7,
+	}, {
+		name:   "with an Initial packet larger than the configured size",
+		data:   quicPaddingNewPacket(0b00, quic.Version1, 1500),
+		expect: 1500,
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &quicPaddingRecorderConn{}
+			conn := &quicPaddingConn{recorder, 1400}
+			count, err := conn.WriteTo(tc.data, &net.UDPAddr{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(tc.data) {
+				t.Fatal("unexpected count", count)
+			}
+			if len(recorder.sizes) != 1 || recorder.sizes[0] != tc.expect {
+				t.Fatal("unexpected sizes", recorder.sizes)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Retry returns a stage that runs the given stage at most attempts times until it succeeds. We
+// only retry when the stage fails with a measurement error (e.g., [ErrDNSLookup] or [ErrTCPConnect])
+// and we never retry when the stage fails with an [ErrException] or an [ErrSkip]. Before the n-th
+// retry, we wait for backoff multiplied by 2^(n-1), capped to one minute, unless the context is
+// done. When the input is an error, we run the stage once, so it can propagate the error.
+//
+// Each attempt runs using a [Runtime] that adds the "attempt=<n>" tag to every [Trace] created by
+// the stage, where n starts from one. Because stages such as [TCPConnect] create a new [Trace] each
+// time they run, each attempt gets its own [Trace]. Therefore, you should retry stages that create
+// their own [Trace] rather than stages that use the [Trace] of their input (e.g., [TLSHandshake]).
+//
+// When attempts is zero or negative, we run the stage once.
+func Retry[A, B any](stage Stage[A, B], attempts int, backoff time.Duration) Stage[A, B] {
+	return &retryStage[A, B]{retryArguments{attempts, backoff}, stage}
+}
+
+// retryMaxBackoff is the maximum time [Retry] waits before retrying.
+const retryMaxBackoff = time.Minute
+
+type retryStage[A, B any] struct {
+	args  retryArguments
+	stage Stage[A, B]
+}
+
+type retryArguments struct {
+	Attempts int           `json:"attempts"`
+	Backoff  time.Duration `json:"backoff"`
+}
+
+const retryStageName = "retry"
+
+// ASTNode implements Stage.
+func (sx *retryStage[A, B]) ASTNode() *SerializableASTNode {
+	return &SerializableASTNode{
+		StageName: retryStageName,
+		Arguments: &sx.args,
+		Children:  []*SerializableASTNode{sx.stage.ASTNode()},
+	}
+}
+
+type retryLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*retryLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var args retryArguments
+	if err := json.Unmarshal(node.Arguments, &args); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 1); err != nil {
+		return nil, err
+	}
+	runnable, err := loader.Load(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	// Note: like composeStage, retryStage does not create any Maybe and so we can
+	// use `any` because the inner stage creates correctly-typed Maybes.
+	return Retry[any, any](runnable, args.Attempts, args.Backoff), nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*retryLoader) StageName() string {
+	return retryStageName
+}
+
+// Run implements Stage.
+func (sx *retryStage[A, B]) Run(ctx context.Context, rtx Runtime, input Maybe[A]) Maybe[B] {
+	// Note: we cannot create any Maybe here because we may be a retryStage[any, any]
+	// and hence creating a Maybe here would generate an incorrectly typed Maybe
+	if input.Error != nil {
+		return sx.stage.Run(ctx, rtx, input)
+	}
+	backoff := sx.args.Backoff
+	if backoff > retryMaxBackoff {
+		backoff = retryMaxBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		arx := &retryRuntime{Runtime: rtx, tag: fmt.Sprintf("attempt=%d", attempt)}
+		output := sx.stage.Run(ctx, arx, input)
+		if !sx.shouldRetry(output.Error) || attempt >= sx.args.Attempts {
+			return output
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return output
+		case <-timer.C:
+		}
+		backoff = retryNextBackoff(backoff)
+	}
+}
+
+// retryNextBackoff doubles the given backoff without exceeding [retryMaxBackoff].
+func retryNextBackoff(backoff time.Duration) time.Duration {
+	if backoff >= retryMaxBackoff/2 {
+		return retryMaxBackoff
+	}
+	return backoff * 2
+}
+
+// shouldRetry returns whether the given error is a measurement error we should retry.
+func (sx *retryStage[A, B]) shouldRetry(err error) bool {
+	return err != nil && !IsErrException(err) && !IsErrSkip(err)
+}
+
+// retryRuntime is the [Runtime] used by [Retry] to tag traces with the attempt number.
+type retryRuntime struct {
+	Runtime
+	tag string
+}
+
+// NewTrace implements Runtime.
+func (r *retryRuntime) NewTrace(tags ...string) Trace {
+	return r.Runtime.NewTrace(append(append([]string{}, tags...), r.tag)...)
+}
@@ -0,0 +1,116 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// retryCountingStage is a stage that counts how many times it runs.
+type retryCountingStage struct {
+	count int
+}
+
+// ASTNode implements Stage.
+func (sx *retryCountingStage) ASTNode() *SerializableASTNode {
+	return TCPConnect().ASTNode()
+}
+
+// Run implements Stage.
+func (sx *retryCountingStage) Run(ctx context.Context, rtx Runtime, input Maybe[*Endpoint]) Maybe[*TCPConnection] {
+	sx.count++
+	if input.Error != nil {
+		return NewError[*TCPConnection](input.Error)
+	}
+	return NewError[*TCPConnection](&ErrTCPConnect{errors.New("mocked error")})
+}
+
+func TestRetry(t *testing.T) {
+	// newEndpoint returns an endpoint where the TCP connect always fails
+	newEndpoint := func() Maybe[*Endpoint] {
+		listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+		listener.Close()
+		return NewValue(&Endpoint{Address: listener.Addr().String(), Domain: "www.example.com"})
+	}
+
+	t.Run("we retry measurement errors and tag each attempt", func(t *testing.T) {
+		// serialize and load the pipeline
+		pipeline := Retry(TCPConnect(), 3, time.Millisecond)
+		rawAST := runtimex.Try1(json.Marshal(pipeline.ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run the pipeline
+		rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		results := runnable.Run(context.Background(), rtx, newEndpoint().AsGeneric())
+		if !IsErrTCPConnect(results.Error) {
+			t.Fatal("not an ErrTCPConnect", results.Error)
+		}
+
+		// make sure we have a TCP connect observation for each attempt
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		var tags [][]string
+		for _, entry := range observations.TCPConnect {
+			tags = append(tags, entry.Tags)
+		}
+		expect := [][]string{{"attempt=1"}, {"attempt=2"}, {"attempt=3"}}
+		if diff := cmp.Diff(expect, tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we run the stage once when the input is an error", func(t *testing.T) {
+		// create a stage that counts how many times it runs
+		stage := &retryCountingStage{}
+		pipeline := Retry[*Endpoint, *TCPConnection](stage, 3, time.Hour)
+
+		// run the pipeline using an input error
+		rtx := NewMinimalRuntime(log.Log)
+		input := NewError[*Endpoint](&ErrDNSLookup{errors.New("mocked error")})
+		results := pipeline.Run(context.Background(), rtx, input)
+		if !IsErrDNSLookup(results.Error) {
+			t.Fatal("not an ErrDNSLookup", results.Error)
+		}
+		if stage.count != 1 {
+			t.Fatal("unexpected number of runs", stage.count)
+		}
+	})
+
+	t.Run("we cap the backoff", func(t *testing.T) {
+		backoffs := []time.Duration{time.Second}
+		for idx := 0; idx < 8; idx++ {
+			backoffs = append(backoffs, retryNextBackoff(backoffs[len(backoffs)-1]))
+		}
+		expect := []time.Duration{
+			time.Second,
+			2 * time.Second,
+			4 * time.Second,
+			8 * time.Second,
+			16 * time.Second,
+			32 * time.Second,
+			time.Minute,
+			time.Minute,
+			time.Minute,
+		}
+		if diff := cmp.Diff(expect, backoffs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we do not retry exceptions", func(t *testing.T) {
+		pipeline := Retry(DNSLookupStatic("antani"), 3, time.Hour)
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, NewValue("www.example.com"))
+		if !IsErrException(results.Error) {
+			t.Fatal("not an ErrException", results.Error)
+		}
+	})
+}
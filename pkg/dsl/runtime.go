@@ -1,6 +1,8 @@
 package dsl
 
 import (
+	"context"
+	"crypto/tls"
 	"io"
 	"net/http"
 	"sync"
@@ -9,6 +11,7 @@ import (
 	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/netxlite"
 	"github.com/quic-go/quic-go"
+	utls "gitlab.com/yawning/utls.git"
 )
 
 // Runtime is a runtime for running measurement pipelines.
@@ -19,6 +22,10 @@ type Runtime interface {
 	// Close closes all the closers tracker by the runtime.
 	Close() error
 
+	// ConcurrencyBudget returns the budget limiting the number of workers that parallel
+	// stages run concurrently. A nil return value means that there is no limit.
+	ConcurrencyBudget() *ConcurrencyBudget
+
 	// Logger returns the logger to use.
 	Logger() model.Logger
 
@@ -46,6 +53,9 @@ type Runtime interface {
 // [MinimalRuntime.Close]. The zero value of this struct is not ready to use; construct
 // using the [NewMinimalRuntime] factory function.
 type MinimalRuntime struct {
+	// budget is the OPTIONAL concurrency budget.
+	budget *ConcurrencyBudget
+
 	// closers contains the closers to close.
 	closers []io.Closer
 
@@ -62,16 +72,32 @@ type MinimalRuntime struct {
 	observations []*Observations
 }
 
+// RuntimeOption is an option for [NewMinimalRuntime] and [NewMeasurexliteRuntime].
+type RuntimeOption func(r *MinimalRuntime)
+
+// RuntimeOptionConcurrencyBudget configures the maximum number of workers that all
+// the parallel stages run concurrently. By default, there is no limit.
+func RuntimeOptionConcurrencyBudget(size int) RuntimeOption {
+	return func(r *MinimalRuntime) {
+		r.budget = NewConcurrencyBudget(size)
+	}
+}
+
 // NewMinimalRuntime creates a minimal [Runtime] that increments
 // [Trace] indexes and tracks connections.
-func NewMinimalRuntime(logger model.Logger) *MinimalRuntime {
-	return &MinimalRuntime{
+func NewMinimalRuntime(logger model.Logger, options ...RuntimeOption) *MinimalRuntime {
+	r := &MinimalRuntime{
+		budget:       nil,
 		closers:      []io.Closer{},
 		idGenerator:  &atomic.Int64{},
 		logger:       logger,
 		mu:           sync.Mutex{},
 		observations: []*Observations{},
 	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
 }
 
 // Close implements Runtime.
@@ -85,6 +111,11 @@ func (r *MinimalRuntime) Close() error {
 	return nil
 }
 
+// ConcurrencyBudget implements Runtime.
+func (r *MinimalRuntime) ConcurrencyBudget() *ConcurrencyBudget {
+	return r.budget
+}
+
 // ExtractObservations implements Runtime.
 func (r *MinimalRuntime) ExtractObservations() []*Observations {
 	defer r.mu.Unlock()
@@ -163,6 +194,20 @@ func (t *minimalTrace) ExtractObservations() []*Observations {
 	return []*Observations{}
 }
 
+// DNSRoundTrip implements Trace.
+func (t *minimalTrace) DNSRoundTrip(
+	ctx context.Context,
+	txp model.DNSTransport,
+	query model.DNSQuery,
+) (model.DNSResponse, []*DNSAnswer, error) {
+	resp, err := txp.RoundTrip(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	answers, err := dnsDecodeResponse(query, resp)
+	return resp, answers, err
+}
+
 // HTTPTransaction implements Trace.
 func (t *minimalTrace) HTTPTransaction(
 	conn *HTTPConnection,
@@ -200,14 +245,35 @@ func (t *minimalTrace) NewDialerWithoutResolver() model.Dialer {
 	return netxlite.NewDialerWithoutResolver(t.r.logger)
 }
 
+// NewParallelDNSOverHTTPSResolver implements Trace.
+func (t *minimalTrace) NewParallelDNSOverHTTPSResolver(URL string) model.Resolver {
+	return netxlite.NewParallelDNSOverHTTPSResolver(t.r.logger, URL)
+}
+
+// NewParallelDNSOverTCPResolver implements Trace.
+func (t *minimalTrace) NewParallelDNSOverTCPResolver(endpoint string) model.Resolver {
+	return newParallelDNSOverTCPResolver(t.r.logger, netxlite.NewDialerWithoutResolver(t.r.logger), endpoint)
+}
+
+// NewParallelDNSOverTLSResolver implements Trace.
+func (t *minimalTrace) NewParallelDNSOverTLSResolver(endpoint, sni string) model.Resolver {
+	return newParallelDNSOverTLSResolver(
+		t.r.logger,
+		netxlite.NewDialerWithoutResolver(t.r.logger),
+		netxlite.NewTLSHandshakerStdlib(t.r.logger),
+		endpoint,
+		sni,
+	)
+}
+
 // NewParallelUDPResolver implements Trace.
 func (t *minimalTrace) NewParallelUDPResolver(endpoint string) model.Resolver {
 	return netxlite.NewParallelUDPResolver(t.r.logger, netxlite.NewDialerWithoutResolver(t.r.logger), endpoint)
 }
 
 // NewQUICDialerWithoutResolver implements Trace.
-func (t *minimalTrace) NewQUICDialerWithoutResolver() model.QUICDialer {
-	return netxlite.NewQUICDialerWithoutResolver(netxlite.NewQUICListener(), t.r.logger)
+func (t *minimalTrace) NewQUICDialerWithoutResolver(listener model.QUICListener) model.QUICDialer {
+	return newQUICDialerWithoutResolver(listener, t.r.logger, nil)
 }
 
 // NewStdlibResolver implements Trace.
@@ -220,7 +286,56 @@ func (t *minimalTrace) NewTLSHandshakerStdlib() model.TLSHandshaker {
 	return netxlite.NewTLSHandshakerStdlib(t.r.logger)
 }
 
+// NewTLSHandshakerCryptoTLS implements Trace.
+func (t *minimalTrace) NewTLSHandshakerCryptoTLS() model.TLSHandshaker {
+	return newTLSHandshakerCryptoTLS(t.r.logger, nil)
+}
+
+// NewTLSHandshakerUTLS implements Trace.
+func (t *minimalTrace) NewTLSHandshakerUTLS(id *utls.ClientHelloID) model.TLSHandshaker {
+	return netxlite.NewTLSHandshakerUTLS(t.r.logger, id)
+}
+
 // Tags implements Trace.
 func (t *minimalTrace) Tags() []string {
 	return []string{}
 }
+
+// WebSocketHandshake implements Trace.
+func (t *minimalTrace) WebSocketHandshake(conn *WebSocketConnection, req *http.Request) (*http.Response, error) {
+	return webSocketHandshake(conn, req)
+}
+
+// WebSocketReadFrame implements Trace.
+func (t *minimalTrace) WebSocketReadFrame(conn *WebSocketConnection) (*WebSocketFrame, error) {
+	return webSocketReadFrame(conn)
+}
+
+// WebSocketWriteFrame implements Trace.
+func (t *minimalTrace) WebSocketWriteFrame(conn *WebSocketConnection, frame *WebSocketFrame) error {
+	return webSocketWriteFrame(conn, frame)
+}
+
+// newParallelDNSOverTCPResolver creates a DNS-over-TCP resolver using the given dialer.
+func newParallelDNSOverTCPResolver(logger model.Logger, dialer model.Dialer, endpoint string) model.Resolver {
+	txp := netxlite.WrapDNSTransport(netxlite.NewUnwrappedDNSOverTCPTransport(dialer.DialContext, endpoint))
+	return netxlite.WrapResolver(logger, netxlite.NewUnwrappedParallelResolver(txp))
+}
+
+// newParallelDNSOverTLSResolver creates a DNS-over-TLS resolver using the given dialer and handshaker.
+func newParallelDNSOverTLSResolver(
+	logger model.Logger,
+	dialer model.Dialer,
+	handshaker model.TLSHandshaker,
+	endpoint string,
+	sni string,
+) model.Resolver {
+	// Note: the TLS dialer uses the endpoint IP address as the SNI when the SNI is empty
+	tlsDialer := netxlite.NewTLSDialerWithConfig(dialer, handshaker, &tls.Config{
+		NextProtos: []string{"dot"},
+		RootCAs:    nil, // use the cached default Mozilla cert pool
+		ServerName: sni,
+	})
+	txp := netxlite.WrapDNSTransport(netxlite.NewUnwrappedDNSOverTLSTransport(tlsDialer.DialTLSContext, endpoint))
+	return netxlite.WrapResolver(logger, netxlite.NewUnwrappedParallelResolver(txp))
+}
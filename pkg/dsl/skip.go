@@ -1,6 +1,10 @@
 package dsl
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 // ErrSkip is a sentinel error indicating to a [Stage] that it should not run.
 var ErrSkip = errors.New("dsl: skip this stage")
@@ -9,3 +13,42 @@ var ErrSkip = errors.New("dsl: skip this stage")
 func IsErrSkip(err error) bool {
 	return errors.Is(err, ErrSkip)
 }
+
+// skippableStage is the part of a [Stage] we need to record that it did not run.
+type skippableStage interface {
+	ASTNode() *SerializableASTNode
+}
+
+// maybeSkipStage returns an [ErrSkip] when the deadline set by [Deadline] expired and nil
+// otherwise. When it returns an [ErrSkip], this function also saves the name of the stage and
+// of the stages it contains into the SkippedStages field of the [Observations] and, if the
+// [Metrics] implement [SkipMetrics], increments their skipped counter. Stages call this function
+// after checking whether their input is an error, such that we preserve the errors of the
+// previous stages, and we do not skip stages whose context has been canceled (e.g., the
+// losing attempts of [HappyEyeballs]). Stages that only pass their input to inner stages
+// (e.g., [Compose]) do not call this function, and we instead record the inner stages.
+func maybeSkipStage(ctx context.Context, rtx Runtime, stage skippableStage) error {
+	err := ctx.Err()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	names := skippedStageNames(stage.ASTNode())
+	observations := NewObservations()
+	observations.SkippedStages = names
+	rtx.SaveObservations(observations)
+	if metrics, good := rtx.Metrics().(SkipMetrics); good {
+		for _, name := range names {
+			metrics.Skip(name)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrSkip, err.Error())
+}
+
+// skippedStageNames returns the names of the stages inside the given node in depth-first order.
+func skippedStageNames(node *SerializableASTNode) (out []string) {
+	out = append(out, node.StageName)
+	for _, child := range node.Children {
+		out = append(out, skippedStageNames(child)...)
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package dsl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// FailureSSLPinMismatch is the failure string we use when none of the peer certificates
+// matches the configured SPKI pins (see [TLSHandshakeOptionSPKIPins]).
+const FailureSSLPinMismatch = "ssl_pin_mismatch"
+
+// ErrSPKIPinMismatch indicates that none of the peer certificates matches the SPKI pins.
+var ErrSPKIPinMismatch = errors.New("dsl: no peer certificate matches the SPKI pins")
+
+// newErrSPKIPinMismatch returns an [ErrSPKIPinMismatch] wrapped by a [*netxlite.ErrWrapper]
+// using [FailureSSLPinMismatch] as the failure and the given operation.
+func newErrSPKIPinMismatch(operation string) error {
+	classifier := func(error) string {
+		return FailureSSLPinMismatch
+	}
+	return netxlite.NewErrWrapper(classifier, operation, ErrSPKIPinMismatch)
+}
+
+// parseSPKIPins decodes the given base64-encoded SHA-256 SPKI pins.
+func parseSPKIPins(values []string) (pins [][]byte, err error) {
+	for _, value := range values {
+		pin, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(pin) != sha256.Size {
+			return nil, &ErrInvalidSPKIPin{value}
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// matchSPKIPins returns whether any certificate of any of the given chains matches any of the
+// given pins. When there are no pins, this function returns true because there is nothing to enforce.
+func matchSPKIPins(chains [][]*x509.Certificate, pins [][]byte) bool {
+	if len(pins) <= 0 {
+		return true
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(digest[:], pin) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// newSPKIPinsVerifier returns a tls.Config VerifyPeerCertificate callback that fails with
+// [ErrSPKIPinMismatch] unless a certificate of the chains returned by the given function
+// matches the given pins. Enforcing the pins during the handshake ensures that the handshake
+// we trace fails with [FailureSSLPinMismatch]. When there are no pins, we return nil.
+func newSPKIPinsVerifier(pins [][]byte, operation string, chains spkiPinsChainsFunc) spkiPinsVerifyFunc {
+	if len(pins) <= 0 {
+		return nil
+	}
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		candidates, err := chains(rawCerts, verifiedChains)
+		if err != nil {
+			return err
+		}
+		if !matchSPKIPins(candidates, pins) {
+			return newErrSPKIPinMismatch(operation)
+		}
+		return nil
+	}
+}
+
+// spkiPinsVerifyFunc is the type of the tls.Config VerifyPeerCertificate callback.
+type spkiPinsVerifyFunc = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
+// spkiPinsChainsFunc returns the certificate chains on which we enforce the SPKI pins given the
+// arguments of the tls.Config VerifyPeerCertificate callback. We cannot use all the certificates
+// sent by the peer, because a MITM could append a pinned certificate to its own chain.
+type spkiPinsChainsFunc = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) ([][]*x509.Certificate, error)
+
+// spkiPinsVerifiedChains is the [spkiPinsChainsFunc] returning the chains verified by crypto/tls.
+func spkiPinsVerifiedChains(_ [][]byte, verifiedChains [][]*x509.Certificate) ([][]*x509.Certificate, error) {
+	return verifiedChains, nil
+}
+
+// spkiPinsLeaf is the [spkiPinsChainsFunc] we use when we do not verify the certificates, which
+// returns the leaf certificate because it is the only one proving the peer holds its private key.
+func spkiPinsLeaf(rawCerts [][]byte, _ [][]*x509.Certificate) ([][]*x509.Certificate, error) {
+	if len(rawCerts) <= 0 {
+		return nil, ErrNoPeerCertificates
+	}
+	leaf, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return nil, err
+	}
+	return [][]*x509.Certificate{{leaf}}, nil
+}
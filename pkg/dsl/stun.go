@@ -0,0 +1,144 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+	"github.com/pion/stun"
+)
+
+// STUNBindingRequest returns a stage that sends a STUN binding request (see RFC 5389) to
+// a UDP endpoint and waits for the corresponding binding success response, which contains
+// our reflexive transport address. The [Trace] created by this stage records the I/O as
+// network events.
+//
+// This function returns an [ErrUDPExchange] when we do not receive a valid response before
+// the timeout expires. Remember to use the [IsErrUDPExchange] predicate when setting an
+// experiment test keys.
+func STUNBindingRequest(options ...STUNBindingRequestOption) Stage[*Endpoint, *STUNBindingResult] {
+	operation := &stunBindingRequestOperation{
+		Tags: []string{},
+	}
+	for _, option := range options {
+		option(operation)
+	}
+	return wrapOperation[*Endpoint, *STUNBindingResult](operation)
+}
+
+type stunBindingRequestOperation struct {
+	Tags    []string      `json:"tags,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+const stunBindingRequestStageName = "stun_binding_request"
+
+// ASTNode implements operation.
+func (op *stunBindingRequestOperation) ASTNode() *SerializableASTNode {
+	// Note: we serialize the structure because this gives us forward compatibility (i.e., we
+	// may add a field to a future version without breaking the AST structure and old probes will
+	// be fine as long as the zero value of the new field is the default)
+	return &SerializableASTNode{
+		StageName: stunBindingRequestStageName,
+		Arguments: op,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type stunBindingRequestLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*stunBindingRequestLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var op stunBindingRequestOperation
+	if err := json.Unmarshal(node.Arguments, &op); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := wrapOperation[*Endpoint, *STUNBindingResult](&op)
+	return &StageRunnableASTNode[*Endpoint, *STUNBindingResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*stunBindingRequestLoader) StageName() string {
+	return stunBindingRequestStageName
+}
+
+// Run implements operation.
+func (op *stunBindingRequestOperation) Run(ctx context.Context, rtx Runtime, endpoint *Endpoint) (*STUNBindingResult, error) {
+	// create the binding request or return an exception
+	request, err := stun.Build(stun.TransactionID, stun.BindingRequest, stun.Fingerprint)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+
+	// create trace
+	trace := rtx.NewTrace(endpoint.tags(op.Tags...)...)
+
+	// start the operation logger
+	ol := measurexlite.NewOperationLogger(
+		rtx.Logger(),
+		"[#%d] STUNBindingRequest with %s",
+		trace.Index(),
+		endpoint.Address,
+	)
+
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(op.Timeout, defaultUDPExchangeTimeout))
+	defer cancel()
+
+	// send the request and wait for the response
+	var mappedAddress string
+	_, err = udpExchange(ctx, trace, endpoint.Address, request.Raw, func(datagram []byte) bool {
+		mappedAddress = stunParseBindingResponse(request, datagram)
+		return mappedAddress != ""
+	})
+	if err == nil && mappedAddress == "" {
+		err = ErrSTUNInvalidResponse
+	}
+
+	// stop the operation logger
+	ol.Stop(err)
+
+	// save observations
+	rtx.SaveObservations(trace.ExtractObservations()...)
+
+	// handle the error case
+	if err != nil {
+		rtx.Metrics().Error(stunBindingRequestStageName)
+		return nil, &ErrUDPExchange{err}
+	}
+
+	// prepare the return value
+	rtx.Metrics().Success(stunBindingRequestStageName)
+	out := &STUNBindingResult{
+		Address:       endpoint.Address,
+		Domain:        endpoint.Domain,
+		MappedAddress: mappedAddress,
+		Trace:         trace,
+	}
+	return out, nil
+}
+
+// stunParseBindingResponse returns the mapped address contained by the datagram when the datagram
+// is the binding success response for the given request and otherwise returns an empty string.
+func stunParseBindingResponse(request *stun.Message, datagram []byte) string {
+	response := &stun.Message{Raw: append([]byte{}, datagram...)}
+	if err := response.Decode(); err != nil {
+		return ""
+	}
+	if response.Type != stun.BindingSuccess || response.TransactionID != request.TransactionID {
+		return ""
+	}
+	var xorAddr stun.XORMappedAddress
+	if err := xorAddr.GetFrom(response); err == nil {
+		return xorAddr.String()
+	}
+	var addr stun.MappedAddress
+	if err := addr.GetFrom(response); err == nil {
+		return addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/pion/stun"
+)
+
+func TestSTUNBindingRequest(t *testing.T) {
+	// newServer creates a STUN server that first sends a spurious datagram and then
+	// replies to each binding request with the address of the client
+	newServer := func(t *testing.T) net.PacketConn {
+		pconn := runtimex.Try1(net.ListenPacket("udp", "127.0.0.1:0"))
+		go func() {
+			buffer := make([]byte, 1024)
+			for {
+				count, addr, err := pconn.ReadFrom(buffer)
+				if err != nil {
+					return
+				}
+				request := &stun.Message{Raw: append([]byte{}, buffer[:count]...)}
+				if err := request.Decode(); err != nil {
+					continue
+				}
+				udpAddr := addr.(*net.UDPAddr)
+				response := stun.MustBuild(
+					stun.NewTransactionIDSetter(request.TransactionID),
+					stun.BindingSuccess,
+					&stun.XORMappedAddress{IP: udpAddr.IP, Port: udpAddr.Port},
+					stun.Fingerprint,
+				)
+				pconn.WriteTo([]byte("antani"), addr)
+				pconn.WriteTo(response.Raw, addr)
+			}
+		}()
+		t.Cleanup(func() { pconn.Close() })
+		return pconn
+	}
+
+	t.Run("we obtain the mapped address", func(t *testing.T) {
+		// serialize and load the pipeline
+		pipeline := STUNBindingRequest(STUNBindingRequestOptionTimeout(time.Second))
+		rawAST := runtimex.Try1(json.Marshal(pipeline.ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run the pipeline
+		rtx := NewMinimalRuntime(log.Log)
+		endpoint := NewValue(&Endpoint{Address: newServer(t).LocalAddr().String(), Domain: "stun.example.com"})
+		results := runnable.Run(context.Background(), rtx, endpoint.AsGeneric())
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		// make sure the mapped address is a loopback address
+		address, _ := runtimex.Try2(net.SplitHostPort(results.Value.(*STUNBindingResult).MappedAddress))
+		if address != "127.0.0.1" {
+			t.Fatal("unexpected mapped address", address)
+		}
+	})
+
+	t.Run("we fail when the server does not respond", func(t *testing.T) {
+		pconn := runtimex.Try1(net.ListenPacket("udp", "127.0.0.1:0"))
+		defer pconn.Close()
+		pipeline := STUNBindingRequest(STUNBindingRequestOptionTimeout(10 * time.Millisecond))
+		rtx := NewMinimalRuntime(log.Log)
+		endpoint := NewValue(&Endpoint{Address: pconn.LocalAddr().String(), Domain: "stun.example.com"})
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+		if !IsErrUDPExchange(results.Error) {
+			t.Fatal("not an ErrUDPExchange", results.Error)
+		}
+	})
+}
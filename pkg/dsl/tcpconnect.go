@@ -19,6 +19,14 @@ func TCPConnectOptionTags(tags ...string) TCPConnectOption {
 	}
 }
 
+// TCPConnectOptionTimeout configures the timeout of the [TCPConnect] pipeline
+// stage; the default is 15s.
+func TCPConnectOptionTimeout(value time.Duration) TCPConnectOption {
+	return func(operation *tcpConnectOperation) {
+		operation.Timeout = value
+	}
+}
+
 // TCPConnect returns a stage that performs a TCP connect.
 //
 // This function returns an [ErrTCPConnect] if the error is a TCP connect error. Remember to
@@ -34,7 +42,8 @@ func TCPConnect(options ...TCPConnectOption) Stage[*Endpoint, *TCPConnection] {
 }
 
 type tcpConnectOperation struct {
-	Tags []string `json:"tags,omitempty"`
+	Tags    []string      `json:"tags,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
 }
 
 const tcpConnectStageName = "tcp_connect"
@@ -74,7 +83,7 @@ func (*tcpConnectLoader) StageName() string {
 // Run implements operation.
 func (op *tcpConnectOperation) Run(ctx context.Context, rtx Runtime, endpoint *Endpoint) (*TCPConnection, error) {
 	// create trace
-	trace := rtx.NewTrace(op.Tags...)
+	trace := rtx.NewTrace(endpoint.tags(op.Tags...)...)
 
 	// start the operation logger
 	ol := measurexlite.NewOperationLogger(
@@ -85,8 +94,7 @@ func (op *tcpConnectOperation) Run(ctx context.Context, rtx Runtime, endpoint *E
 	)
 
 	// setup
-	const timeout = 15 * time.Second
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(op.Timeout, defaultTCPConnectTimeout))
 	defer cancel()
 
 	// obtain the dialer to use
@@ -2,11 +2,15 @@ package dsl
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/ooni/netem"
 	"github.com/ooni/probe-engine/pkg/netemx"
+	"github.com/ooni/probe-engine/pkg/netxlite"
 	"github.com/ooni/probe-engine/pkg/runtimex"
 )
 
@@ -39,4 +43,42 @@ func TestTCPConnect(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("we honour the timeout configured through the AST", func(t *testing.T) {
+		// create a topology where packets take a very long time to arrive
+		topology := runtimex.Try1(netem.NewPPPTopology(
+			"10.0.0.99", "10.0.0.1", log.Log, &netem.LinkConfig{
+				LeftToRightDelay: 30 * time.Second,
+			}))
+		defer topology.Close()
+
+		// serialize and load a pipeline with a short timeout
+		rawAST := runtimex.Try1(json.Marshal(TCPConnect(TCPConnectOptionTimeout(250 * time.Millisecond)).ASTNode()))
+		if !strings.Contains(string(rawAST), `"timeout":250000000`) {
+			t.Fatal("unexpected AST", string(rawAST))
+		}
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run function using the client stack
+		netemx.WithCustomTProxy(topology.Client, func() {
+			endpoint := NewValue(&Endpoint{
+				Address: "10.0.0.1:80",
+				Domain:  "www.example.com",
+			})
+
+			rtx := NewMinimalRuntime(log.Log)
+			t0 := time.Now()
+			results := runnable.Run(context.Background(), rtx, endpoint.AsGeneric())
+
+			// make sure we failed because of the timeout
+			if results.Error == nil || results.Error.Error() != netxlite.FailureGenericTimeoutError {
+				t.Fatal("unexpected error", results.Error)
+			}
+			if elapsed := time.Since(t0); elapsed > 5*time.Second {
+				t.Fatal("the timeout was not honoured", elapsed)
+			}
+		})
+	})
 }
@@ -0,0 +1,248 @@
+package dsl
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// TCPExchange returns a stage that sends the configured payload over a TCP connection and
+// then reads until we have read the configured maximum number of bytes, we have read the
+// configured delimiter, the peer closes the connection, or the timeout expires. Use this stage
+// to measure protocols other than HTTP (e.g., to read the banner of an SMTP server). The
+// [Trace] of the connection records all the I/O as network events.
+//
+// This stage succeeds when the peer closes the connection or the timeout expires after we have
+// read at least one byte. Otherwise, this stage returns an [ErrTCPExchange]. Remember to use
+// the [IsErrTCPExchange] predicate when setting an experiment test keys.
+func TCPExchange(options ...TCPExchangeOption) Stage[*TCPConnection, *TCPExchangeResult] {
+	return wrapOperation[*TCPConnection, *TCPExchangeResult](&tcpExchangeOperation{options})
+}
+
+type tcpExchangeOperation struct {
+	options []TCPExchangeOption
+}
+
+const tcpExchangeStageName = "tcp_exchange"
+
+// ASTNode implements operation.
+func (op *tcpExchangeOperation) ASTNode() *SerializableASTNode {
+	return &SerializableASTNode{
+		StageName: tcpExchangeStageName,
+		Arguments: newTCPExchangeConfig(op.options...),
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type tcpExchangeLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*tcpExchangeLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var config tcpExchangeConfig
+	if err := json.Unmarshal(node.Arguments, &config); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := TCPExchange(config.options()...)
+	return &StageRunnableASTNode[*TCPConnection, *TCPExchangeResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*tcpExchangeLoader) StageName() string {
+	return tcpExchangeStageName
+}
+
+// Run implements operation.
+func (op *tcpExchangeOperation) Run(ctx context.Context, rtx Runtime, conn *TCPConnection) (*TCPExchangeResult, error) {
+	return tcpExchange(ctx, rtx, tcpExchangeStageName, "TCPExchange", conn.Conn,
+		conn.Address, conn.Domain, conn.Trace, op.options...)
+}
+
+// TLSExchange is like [TCPExchange] but uses a TLS connection. Note that the network events
+// contain the size of the TLS records rather than the size of the payload.
+func TLSExchange(options ...TCPExchangeOption) Stage[*TLSConnection, *TCPExchangeResult] {
+	return wrapOperation[*TLSConnection, *TCPExchangeResult](&tlsExchangeOperation{options})
+}
+
+type tlsExchangeOperation struct {
+	options []TCPExchangeOption
+}
+
+const tlsExchangeStageName = "tls_exchange"
+
+// ASTNode implements operation.
+func (op *tlsExchangeOperation) ASTNode() *SerializableASTNode {
+	return &SerializableASTNode{
+		StageName: tlsExchangeStageName,
+		Arguments: newTCPExchangeConfig(op.options...),
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type tlsExchangeLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*tlsExchangeLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var config tcpExchangeConfig
+	if err := json.Unmarshal(node.Arguments, &config); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := TLSExchange(config.options()...)
+	return &StageRunnableASTNode[*TLSConnection, *TCPExchangeResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*tlsExchangeLoader) StageName() string {
+	return tlsExchangeStageName
+}
+
+// Run implements operation.
+func (op *tlsExchangeOperation) Run(ctx context.Context, rtx Runtime, conn *TLSConnection) (*TCPExchangeResult, error) {
+	return tcpExchange(ctx, rtx, tlsExchangeStageName, "TLSExchange", conn.Conn,
+		conn.Address, conn.Domain, conn.Trace, op.options...)
+}
+
+// newTCPExchangeConfig creates a new config using the given options.
+func newTCPExchangeConfig(options ...TCPExchangeOption) *tcpExchangeConfig {
+	config := &tcpExchangeConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	return config
+}
+
+// tcpExchangeDefaultMaxBytes is the default maximum number of bytes to read.
+const tcpExchangeDefaultMaxBytes = 8192
+
+// tcpExchangeMaxMaxBytes is the largest maximum number of bytes to read we allow, which
+// prevents an AST from making the probe allocate a huge buffer.
+const tcpExchangeMaxMaxBytes = 1 << 20
+
+// tcpExchange implements [TCPExchange] and [TLSExchange], where stageName is the name we use for
+// the [Metrics] and logName is the name we use for logging (e.g., "TLSExchange").
+func tcpExchange(ctx context.Context, rtx Runtime, stageName, logName string, conn net.Conn,
+	address, domain string, trace Trace, options ...TCPExchangeOption) (*TCPExchangeResult, error) {
+	// create configuration
+	config := &tcpExchangeConfig{
+		MaxBytes: tcpExchangeDefaultMaxBytes,
+		Timeout:  defaultTCPExchangeTimeout,
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	// make sure the maximum number of bytes to read is reasonable or return an exception
+	if config.MaxBytes > tcpExchangeMaxMaxBytes {
+		return nil, &ErrException{&ErrInvalidMaxBytes{config.MaxBytes}}
+	}
+
+	// obtain the payload and the delimiter or return an exception
+	payload, err := decodeBase64OrText("payload", config.PayloadBase64, config.PayloadText)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+	delimiter, err := decodeBase64OrText("delimiter", config.DelimiterBase64, config.DelimiterText)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+
+	// start the operation logger
+	ol := measurexlite.NewOperationLogger(
+		rtx.Logger(),
+		"[#%d] %s with %s payloadSize=%d maxBytes=%d",
+		trace.Index(),
+		logName,
+		address,
+		len(payload),
+		config.MaxBytes,
+	)
+
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(config.Timeout, defaultTCPExchangeTimeout))
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+
+	// exchange data
+	received, err := tcpExchangeReadWrite(conn, payload, delimiter, config.MaxBytes)
+
+	// stop the operation logger
+	ol.Stop(err)
+
+	// save observations
+	rtx.SaveObservations(trace.ExtractObservations()...)
+
+	// handle the error case
+	if err != nil {
+		rtx.Metrics().Error(stageName)
+		return nil, &ErrTCPExchange{err}
+	}
+
+	// prepare the return value
+	rtx.Metrics().Success(stageName)
+	out := &TCPExchangeResult{
+		Address:  address,
+		Domain:   domain,
+		Received: received,
+		Trace:    trace,
+	}
+	return out, nil
+}
+
+// decodeBase64OrText returns the bytes configured using either base64 or text, where name is
+// the name of the option (e.g., "payload"), and fails if both are configured.
+func decodeBase64OrText(name, base64Value, textValue string) ([]byte, error) {
+	switch {
+	case base64Value != "" && textValue != "":
+		return nil, &ErrConflictingOptions{name + "_base64", name + "_text"}
+	case base64Value != "":
+		return base64.StdEncoding.DecodeString(base64Value)
+	default:
+		return []byte(textValue), nil
+	}
+}
+
+// tcpExchangeReadWrite writes the payload and then reads from the conn.
+func tcpExchangeReadWrite(conn net.Conn, payload, delimiter []byte, maxBytes int) ([]byte, error) {
+	if len(payload) > 0 {
+		if _, err := conn.Write(payload); err != nil {
+			return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.WriteOperation, err)
+		}
+	}
+	if maxBytes <= 0 {
+		maxBytes = tcpExchangeDefaultMaxBytes
+	}
+	received := []byte{}
+	buffer := make([]byte, maxBytes)
+	for len(received) < maxBytes {
+		count, err := conn.Read(buffer[:maxBytes-len(received)])
+		received = append(received, buffer[:count]...)
+		if len(delimiter) > 0 && bytes.Contains(received, delimiter) {
+			break
+		}
+		if err != nil {
+			// the peer closing the connection or the timeout expiring after we have
+			// received some bytes are normal ways to terminate the exchange
+			if len(received) > 0 && (errors.Is(err, io.EOF) || errors.Is(err, os.ErrDeadlineExceeded)) {
+				break
+			}
+			return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.ReadOperation, err)
+		}
+	}
+	return received, nil
+}
@@ -0,0 +1,127 @@
+package dsl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestTCPExchange(t *testing.T) {
+	// newServer creates a server that sends a banner and then echoes the first line
+	newServer := func(t *testing.T) net.Listener {
+		listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					conn.Write([]byte("220 antani ESMTP\r\n"))
+					line, err := bufio.NewReader(conn).ReadString('\n')
+					if err != nil {
+						return
+					}
+					conn.Write([]byte(line))
+				}()
+			}
+		}()
+		t.Cleanup(func() { listener.Close() })
+		return listener
+	}
+
+	// newEndpoint returns the endpoint of the given listener
+	newEndpoint := func(listener net.Listener) Maybe[*Endpoint] {
+		return NewValue(&Endpoint{Address: listener.Addr().String(), Domain: "www.example.com"})
+	}
+
+	t.Run("we can read a banner until the delimiter", func(t *testing.T) {
+		// serialize and load the exchange stage
+		exchange := TCPExchange(TCPExchangeOptionDelimiterText("\r\n"))
+		rawAST := runtimex.Try1(json.Marshal(exchange.ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run the measurement
+		pipeline := Compose[*Endpoint, *TCPConnection, *TCPExchangeResult](
+			TCPConnect(), &RunnableASTNodeStage[*TCPConnection, *TCPExchangeResult]{runnable})
+		rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		defer rtx.Close()
+		results := pipeline.Run(context.Background(), rtx, newEndpoint(newServer(t)))
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		if string(results.Value.Received) != "220 antani ESMTP\r\n" {
+			t.Fatal("unexpected banner", string(results.Value.Received))
+		}
+
+		// make sure we have archived the read
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		var found bool
+		for _, ev := range observations.NetworkEvents {
+			found = found || (ev.Operation == netxlite.ReadOperation && ev.NumBytes > 0)
+		}
+		if !found {
+			t.Fatal("expected a read network event")
+		}
+	})
+
+	t.Run("we succeed when the peer closes the connection after sending data", func(t *testing.T) {
+		pipeline := Compose(TCPConnect(), TCPExchange(TCPExchangeOptionPayloadText("HELO antani\r\n")))
+		rtx := NewMinimalRuntime(log.Log)
+		defer rtx.Close()
+		results := pipeline.Run(context.Background(), rtx, newEndpoint(newServer(t)))
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		expect := "220 antani ESMTP\r\nHELO antani\r\n"
+		if string(results.Value.Received) != expect {
+			t.Fatal("unexpected data", string(results.Value.Received))
+		}
+	})
+
+	t.Run("we fail when the timeout expires before receiving any data", func(t *testing.T) {
+		listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+		defer listener.Close()
+		pipeline := Compose(TCPConnect(), TCPExchange(TCPExchangeOptionTimeout(10*time.Millisecond)))
+		rtx := NewMinimalRuntime(log.Log)
+		defer rtx.Close()
+		results := pipeline.Run(context.Background(), rtx, newEndpoint(listener))
+		if !IsErrTCPExchange(results.Error) {
+			t.Fatal("not an ErrTCPExchange", results.Error)
+		}
+	})
+
+	t.Run("we return an exception when both payloads are set", func(t *testing.T) {
+		pipeline := Compose(TCPConnect(), TCPExchange(
+			TCPExchangeOptionPayloadText("antani"),
+			TCPExchangeOptionPayloadBase64("YW50YW5p"),
+		))
+		rtx := NewMinimalRuntime(log.Log)
+		defer rtx.Close()
+		results := pipeline.Run(context.Background(), rtx, newEndpoint(newServer(t)))
+		if !IsErrException(results.Error) {
+			t.Fatal("not an ErrException", results.Error)
+		}
+	})
+	t.Run("we return an exception when max_bytes is too large", func(t *testing.T) {
+		pipeline := Compose(TCPConnect(), TCPExchange(TCPExchangeOptionMaxBytes(1<<30)))
+		rtx := NewMinimalRuntime(log.Log)
+		defer rtx.Close()
+		results := pipeline.Run(context.Background(), rtx, newEndpoint(newServer(t)))
+		var exc *ErrInvalidMaxBytes
+		if !IsErrException(results.Error) || !errors.As(results.Error, &exc) {
+			t.Fatal("unexpected error", results.Error)
+		}
+	})
+}
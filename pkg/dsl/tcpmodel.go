@@ -3,6 +3,7 @@ package dsl
 import (
 	"errors"
 	"net"
+	"time"
 )
 
 // TCPConnection is the result of performing a TCP connect operation.
@@ -40,3 +41,127 @@ func IsErrTCPConnect(err error) bool {
 	var exc *ErrTCPConnect
 	return errors.As(err, &exc)
 }
+
+// TCPExchangeResult is the result of exchanging data over a TCP or TLS connection.
+type TCPExchangeResult struct {
+	// Address is the endpoint address we're using.
+	Address string
+
+	// Domain is the domain we're using.
+	Domain string
+
+	// Received contains the bytes we received.
+	Received []byte
+
+	// Trace is the trace we're using.
+	Trace Trace
+}
+
+// TCPExchangeOption is an option for configuring [TCPExchange] and [TLSExchange].
+type TCPExchangeOption func(config *tcpExchangeConfig)
+
+// TODO(bassosimone): we should probably autogenerate the config, the functional optional
+// setters, and the conversion from config to list of options.
+
+type tcpExchangeConfig struct {
+	DelimiterBase64 string        `json:"delimiter_base64,omitempty"`
+	DelimiterText   string        `json:"delimiter_text,omitempty"`
+	MaxBytes        int           `json:"max_bytes,omitempty"`
+	PayloadBase64   string        `json:"payload_base64,omitempty"`
+	PayloadText     string        `json:"payload_text,omitempty"`
+	Timeout         time.Duration `json:"timeout,omitempty"`
+}
+
+func (c *tcpExchangeConfig) options() (options []TCPExchangeOption) {
+	if c.DelimiterBase64 != "" {
+		options = append(options, TCPExchangeOptionDelimiterBase64(c.DelimiterBase64))
+	}
+	if c.DelimiterText != "" {
+		options = append(options, TCPExchangeOptionDelimiterText(c.DelimiterText))
+	}
+	if c.MaxBytes > 0 {
+		options = append(options, TCPExchangeOptionMaxBytes(c.MaxBytes))
+	}
+	if c.PayloadBase64 != "" {
+		options = append(options, TCPExchangeOptionPayloadBase64(c.PayloadBase64))
+	}
+	if c.PayloadText != "" {
+		options = append(options, TCPExchangeOptionPayloadText(c.PayloadText))
+	}
+	if c.Timeout > 0 {
+		options = append(options, TCPExchangeOptionTimeout(c.Timeout))
+	}
+	return
+}
+
+// TCPExchangeOptionDelimiterBase64 configures the base64 encoded delimiter after which we
+// stop reading. Setting this option and [TCPExchangeOptionDelimiterText] at the same time
+// is an error. By default, there is no delimiter.
+func TCPExchangeOptionDelimiterBase64(value string) TCPExchangeOption {
+	return func(config *tcpExchangeConfig) {
+		config.DelimiterBase64 = value
+	}
+}
+
+// TCPExchangeOptionDelimiterText configures the delimiter after which we stop reading using
+// a text string (e.g., "\r\n"). Setting this option and [TCPExchangeOptionDelimiterBase64] at
+// the same time is an error. By default, there is no delimiter.
+func TCPExchangeOptionDelimiterText(value string) TCPExchangeOption {
+	return func(config *tcpExchangeConfig) {
+		config.DelimiterText = value
+	}
+}
+
+// TCPExchangeOptionMaxBytes configures the maximum number of bytes to read; the default is 8192
+// and the stage returns an exception when the value is larger than 1 MiB.
+func TCPExchangeOptionMaxBytes(value int) TCPExchangeOption {
+	return func(config *tcpExchangeConfig) {
+		config.MaxBytes = value
+	}
+}
+
+// TCPExchangeOptionPayloadBase64 configures the base64 encoded payload to send, which allows
+// sending binary payloads. Setting this option and [TCPExchangeOptionPayloadText] at the same
+// time is an error. By default, we do not send any payload.
+func TCPExchangeOptionPayloadBase64(value string) TCPExchangeOption {
+	return func(config *tcpExchangeConfig) {
+		config.PayloadBase64 = value
+	}
+}
+
+// TCPExchangeOptionPayloadText configures the payload to send using a text string. Setting this
+// option and [TCPExchangeOptionPayloadBase64] at the same time is an error. By default, we do
+// not send any payload.
+func TCPExchangeOptionPayloadText(value string) TCPExchangeOption {
+	return func(config *tcpExchangeConfig) {
+		config.PayloadText = value
+	}
+}
+
+// TCPExchangeOptionTimeout allows to configure the timeout; the default is 10s.
+func TCPExchangeOptionTimeout(value time.Duration) TCPExchangeOption {
+	return func(config *tcpExchangeConfig) {
+		config.Timeout = value
+	}
+}
+
+// ErrTCPExchange wraps errors occurred when exchanging data over a TCP or TLS connection.
+type ErrTCPExchange struct {
+	Err error
+}
+
+// Unwrap supports [errors.Unwrap].
+func (exc *ErrTCPExchange) Unwrap() error {
+	return exc.Err
+}
+
+// Error implements error.
+func (exc *ErrTCPExchange) Error() string {
+	return exc.Err.Error()
+}
+
+// IsErrTCPExchange returns true when an error is an [ErrTCPExchange].
+func IsErrTCPExchange(err error) bool {
+	var exc *ErrTCPExchange
+	return errors.As(err, &exc)
+}
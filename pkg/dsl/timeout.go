@@ -0,0 +1,40 @@
+package dsl
+
+import "time"
+
+// These are the default timeouts used by stages when the AST does not configure a timeout. Note
+// that the AST serializes timeouts as [time.Duration] (i.e., as nanoseconds) and that zero means
+// using the default timeout, so that ASTs without timeouts continue to work as intended.
+const (
+	// defaultDNSLookupTimeout is the default timeout of DNS lookup stages.
+	defaultDNSLookupTimeout = 4 * time.Second
+
+	// defaultTCPConnectTimeout is the default timeout of [TCPConnect].
+	defaultTCPConnectTimeout = 15 * time.Second
+
+	// defaultTCPExchangeTimeout is the default timeout of [TCPExchange] and [TLSExchange].
+	defaultTCPExchangeTimeout = 10 * time.Second
+
+	// defaultTLSHandshakeTimeout is the default timeout of [TLSHandshake].
+	defaultTLSHandshakeTimeout = 10 * time.Second
+
+	// defaultQUICHandshakeTimeout is the default timeout of [QUICHandshake].
+	defaultQUICHandshakeTimeout = 10 * time.Second
+
+	// defaultUDPExchangeTimeout is the default timeout of [UDPExchange] and [STUNBindingRequest].
+	defaultUDPExchangeTimeout = 5 * time.Second
+
+	// defaultHTTPTransactionTimeout is the default timeout of [HTTPTransaction].
+	defaultHTTPTransactionTimeout = 10 * time.Second
+
+	// defaultWebSocketExchangeTimeout is the default timeout of [WebSocketExchange] and [WebSocketExchangeTLS].
+	defaultWebSocketExchangeTimeout = 10 * time.Second
+)
+
+// timeoutOrDefault returns the given timeout when positive and the default otherwise.
+func timeoutOrDefault(timeout, defaultTimeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultTimeout
+	}
+	return timeout
+}
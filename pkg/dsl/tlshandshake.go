@@ -3,7 +3,6 @@ package dsl
 import (
 	"context"
 	"encoding/json"
-	"time"
 
 	"github.com/ooni/probe-engine/pkg/measurexlite"
 	"github.com/ooni/probe-engine/pkg/netxlite"
@@ -71,24 +70,62 @@ func (op *tlsHandshakeOperation) Run(ctx context.Context, rtx Runtime, tcpConn *
 		return nil, &ErrException{err}
 	}
 
+	// make sure the ClientHello splits are valid or return an exception
+	if err := config.validateSplits(); err != nil {
+		return nil, &ErrException{err}
+	}
+
+	// obtain the SPKI pins or return an exception
+	pins, err := parseSPKIPins(config.SPKIPins)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+
+	// obtain the uTLS ClientHello ID or return an exception
+	clientHelloID, err := newClientHelloID(config.ClientHelloID)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+	if clientHelloID != nil && config.hasConstraints() {
+		return nil, &ErrException{ErrClientHelloIDWithTLSConstraints}
+	}
+
+	// enforce the SPKI pins during the handshake, which uTLS does not support
+	if clientHelloID != nil && len(pins) > 0 {
+		return nil, &ErrException{&ErrConflictingOptions{"client_hello_id", "spki_pins"}}
+	}
+	tlsConfig.VerifyPeerCertificate = newSPKIPinsVerifier(pins, netxlite.TLSHandshakeOperation, config.spkiPinsChains())
+
 	// start the operation logger
 	ol := measurexlite.NewOperationLogger(
 		rtx.Logger(),
-		"[#%d] TLSHandshake with %s SNI=%s ALPN=%v",
+		"[#%d] TLSHandshake with %s SNI=%s ALPN=%v ClientHelloID=%s",
 		tcpConn.Trace.Index(),
 		tcpConn.Address,
 		config.SNI,
 		config.ALPN,
+		config.ClientHelloID,
 	)
 
 	// setup
 	handshaker := tcpConn.Trace.NewTLSHandshakerStdlib()
-	const timeout = 10 * time.Second
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	switch {
+	case clientHelloID != nil:
+		handshaker = tcpConn.Trace.NewTLSHandshakerUTLS(clientHelloID)
+	case config.needsCryptoTLS():
+		handshaker = tcpConn.Trace.NewTLSHandshakerCryptoTLS()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(config.Timeout, defaultTLSHandshakeTimeout))
 	defer cancel()
 
 	// handshake
-	conn, state, err := handshaker.Handshake(ctx, tcpConn.Conn, tlsConfig)
+	netConn := newClientHelloSplitterConn(
+		tcpConn.Conn,
+		config.ClientHelloRecordSplits,
+		config.ClientHelloSegmentSplits,
+		config.ClientHelloSplitsSNI,
+	)
+	conn, state, err := handshaker.Handshake(ctx, netConn, tlsConfig)
 
 	// stop the operation logger
 	ol.Stop(err)
@@ -111,6 +148,7 @@ func (op *tlsHandshakeOperation) Run(ctx context.Context, rtx Runtime, tcpConn *
 		Address:               tcpConn.Address,
 		Conn:                  conn.(netxlite.TLSConn), // guaranteed to work
 		Domain:                tcpConn.Domain,
+		State:                 newTLSConnectionState(state, tlsConfig),
 		TLSNegotiatedProtocol: state.NegotiatedProtocol,
 		Trace:                 tcpConn.Trace,
 	}
@@ -2,10 +2,27 @@ package dsl
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/netxlite"
 	"github.com/ooni/probe-engine/pkg/netxlite/filtering"
+	"github.com/ooni/probe-engine/pkg/runtimex"
 )
 
 func TestTLSHandshake(t *testing.T) {
@@ -35,4 +52,524 @@ func TestTLSHandshake(t *testing.T) {
 			t.Fatal("not an ErrTLSHandshake", results.Error)
 		}
 	})
+
+	t.Run("we can use uTLS to parrot a browser ClientHello", func(t *testing.T) {
+		// create a server that completes the handshake
+		srvr := httptest.NewTLSServer(http.NotFoundHandler())
+		defer srvr.Close()
+		URL, err := url.Parse(srvr.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// create a measurement pipeline
+		pipeline := Compose(
+			TCPConnect(),
+			TLSHandshake(
+				TLSHandshakeOptionClientHelloID("chrome"),
+				TLSHandshakeOptionSkipVerify(true),
+			),
+		)
+
+		// create the endpoint
+		endpoint := NewValue(&Endpoint{
+			Address: URL.Host,
+			Domain:  "www.example.com",
+		})
+
+		// perform the measurement
+		rtx := NewMinimalRuntime(log.Log)
+		defer rtx.Close()
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+
+		// make sure the handshake succeeded
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+	})
+
+	t.Run("we return an exception with an invalid ClientHello ID", func(t *testing.T) {
+		// create a measurement pipeline
+		pipeline := TLSHandshake(TLSHandshakeOptionClientHelloID("netscape"))
+
+		// create the input
+		input := NewValue(&TCPConnection{
+			Address: "127.0.0.1:443",
+			Domain:  "www.example.com",
+		})
+
+		// perform the measurement
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, input)
+
+		// make sure the error is an exception
+		if !IsErrException(results.Error) {
+			t.Fatal("not an ErrException", results.Error)
+		}
+	})
+	t.Run("we can constrain the TLS version, cipher suites, and curves", func(t *testing.T) {
+		// create a server that completes the handshake
+		srvr := httptest.NewTLSServer(http.NotFoundHandler())
+		defer srvr.Close()
+		URL, err := url.Parse(srvr.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// create a measurement pipeline
+		pipeline := Compose(
+			TCPConnect(),
+			TLSHandshake(
+				TLSHandshakeOptionCipherSuites("TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"),
+				TLSHandshakeOptionCurves("CurveP256"),
+				TLSHandshakeOptionMaxVersion("TLSv1.2"),
+				TLSHandshakeOptionSkipVerify(true),
+			),
+		)
+
+		// create the endpoint
+		endpoint := NewValue(&Endpoint{
+			Address: URL.Host,
+			Domain:  "www.example.com",
+		})
+
+		// perform the measurement
+		rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		defer rtx.Close()
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		// make sure we negotiated what we asked for
+		state := results.Value.Conn.ConnectionState()
+		if state.Version != tls.VersionTLS12 {
+			t.Fatal("unexpected version", state.Version)
+		}
+		if state.CipherSuite != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+			t.Fatal("unexpected cipher suite", state.CipherSuite)
+		}
+
+		// make sure we have traced the TLS handshake
+		var handshakes int
+		for _, obs := range rtx.ExtractObservations() {
+			handshakes += len(obs.TLSHandshakes)
+		}
+		if handshakes != 1 {
+			t.Fatal("expected one TLS handshake, got", handshakes)
+		}
+	})
+
+	t.Run("we return an exception with invalid TLS constraints", func(t *testing.T) {
+		for _, option := range []TLSHandshakeOption{
+			TLSHandshakeOptionCipherSuites("TLS_NULL_WITH_NULL_NULL"),
+			TLSHandshakeOptionCurves("CurveP224"),
+			TLSHandshakeOptionMaxVersion("SSLv3"),
+			TLSHandshakeOptionMinVersion("TLSv1.4"),
+		} {
+			// create a measurement pipeline
+			pipeline := TLSHandshake(option)
+
+			// create the input
+			input := NewValue(&TCPConnection{
+				Address: "127.0.0.1:443",
+				Domain:  "www.example.com",
+			})
+
+			// perform the measurement
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, input)
+
+			// make sure the error is an exception
+			if !IsErrException(results.Error) {
+				t.Fatal("not an ErrException", results.Error)
+			}
+		}
+	})
+
+	t.Run("we return an exception when combining TLS constraints with a ClientHello ID", func(t *testing.T) {
+		// create a measurement pipeline
+		pipeline := TLSHandshake(
+			TLSHandshakeOptionClientHelloID("firefox"),
+			TLSHandshakeOptionMinVersion("TLSv1.3"),
+		)
+
+		// create the input
+		input := NewValue(&TCPConnection{
+			Address: "127.0.0.1:443",
+			Domain:  "www.example.com",
+		})
+
+		// perform the measurement
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, input)
+
+		// make sure the error is correct
+		if !errors.Is(results.Error, ErrClientHelloIDWithTLSConstraints) {
+			t.Fatal("unexpected error", results.Error)
+		}
+	})
+	t.Run("we summarize the connection state", func(t *testing.T) {
+		// create a server that completes the handshake
+		srvr := httptest.NewTLSServer(http.NotFoundHandler())
+		defer srvr.Close()
+		URL, err := url.Parse(srvr.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certPEM := string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: srvr.Certificate().Raw,
+		}))
+
+		// create the endpoint
+		endpoint := NewValue(&Endpoint{
+			Address: URL.Host,
+			Domain:  "example.com",
+		})
+
+		// define the expectations
+		var testcases = []struct {
+			name     string
+			options  []TLSHandshakeOption
+			verified bool
+		}{{
+			name:     "with the default root CAs",
+			options:  []TLSHandshakeOption{TLSHandshakeOptionSkipVerify(true)},
+			verified: false,
+		}, {
+			name: "with the server certificate as the root CA",
+			options: []TLSHandshakeOption{
+				TLSHandshakeOptionSkipVerify(true),
+				TLSHandshakeOptionX509Certs(certPEM),
+			},
+			verified: true,
+		}}
+
+		for _, tc := range testcases {
+			t.Run(tc.name, func(t *testing.T) {
+				// create a measurement pipeline
+				pipeline := Compose(TCPConnect(), TLSHandshake(tc.options...))
+
+				// perform the measurement
+				rtx := NewMinimalRuntime(log.Log)
+				defer rtx.Close()
+				results := pipeline.Run(context.Background(), rtx, endpoint)
+				if results.Error != nil {
+					t.Fatal(results.Error)
+				}
+
+				// make sure the state is correct
+				state := results.Value.State
+				if state.Version != "TLSv1.3" {
+					t.Fatal("unexpected version", state.Version)
+				}
+				if state.ServerName != "example.com" {
+					t.Fatal("unexpected server name", state.ServerName)
+				}
+				if len(state.PeerCertificates) != 1 {
+					t.Fatal("unexpected number of peer certificates", len(state.PeerCertificates))
+				}
+				if state.Verified != tc.verified {
+					t.Fatal("unexpected verified", state.Verified, state.VerificationError)
+				}
+				if state.Verified != (state.VerificationError == "") {
+					t.Fatal("inconsistent verification error", state.VerificationError)
+				}
+			})
+		}
+	})
+	t.Run("we enforce the SPKI pins", func(t *testing.T) {
+		// create a server that completes the handshake
+		srvr := httptest.NewTLSServer(http.NotFoundHandler())
+		defer srvr.Close()
+		URL, err := url.Parse(srvr.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256(srvr.Certificate().RawSubjectPublicKeyInfo)
+		goodPin := base64.StdEncoding.EncodeToString(digest[:])
+		badPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+		// create the endpoint
+		endpoint := NewValue(&Endpoint{
+			Address: URL.Host,
+			Domain:  "example.com",
+		})
+
+		// define the expectations
+		var testcases = []struct {
+			name    string
+			pins    []string
+			failure string
+		}{{
+			name:    "with a matching pin",
+			pins:    []string{badPin, goodPin},
+			failure: "",
+		}, {
+			name:    "without any matching pin",
+			pins:    []string{badPin},
+			failure: FailureSSLPinMismatch,
+		}}
+
+		for _, tc := range testcases {
+			t.Run(tc.name, func(t *testing.T) {
+				// create a measurement pipeline
+				pipeline := Compose(
+					TCPConnect(),
+					TLSHandshake(
+						TLSHandshakeOptionSkipVerify(true),
+						TLSHandshakeOptionSPKIPins(tc.pins...),
+					),
+				)
+
+				// perform the measurement
+				rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+				defer rtx.Close()
+				results := pipeline.Run(context.Background(), rtx, endpoint)
+
+				// make sure the result is correct
+				switch {
+				case tc.failure == "" && results.Error != nil:
+					t.Fatal(results.Error)
+				case tc.failure == "":
+					// nothing
+				case !IsErrTLSHandshake(results.Error):
+					t.Fatal("not an ErrTLSHandshake", results.Error)
+				case !errors.Is(results.Error, ErrSPKIPinMismatch):
+					t.Fatal("not an ErrSPKIPinMismatch", results.Error)
+				case results.Error.Error() != tc.failure:
+					t.Fatal("unexpected failure", results.Error.Error())
+				}
+
+				// make sure we archived the same failure
+				observations := ReduceObservations(rtx.ExtractObservations()...)
+				if len(observations.TLSHandshakes) != 1 {
+					t.Fatal("expected a single TLS handshake")
+				}
+				failure := observations.TLSHandshakes[0].Failure
+				switch {
+				case tc.failure == "" && failure != nil:
+					t.Fatal("unexpected failure", *failure)
+				case tc.failure != "" && (failure == nil || *failure != tc.failure):
+					t.Fatal("unexpected failure", failure)
+				}
+			})
+		}
+	})
+
+	t.Run("we do not match the SPKI pins against certificates appended by the server", func(t *testing.T) {
+		// create a server that completes the handshake
+		srvr := httptest.NewTLSServer(http.NotFoundHandler())
+		defer srvr.Close()
+		certPEM := string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: srvr.Certificate().Raw,
+		}))
+		digest := sha256.Sum256(srvr.Certificate().RawSubjectPublicKeyInfo)
+		goodPin := base64.StdEncoding.EncodeToString(digest[:])
+
+		// create a self-signed certificate for the attacker
+		attackerKey := runtimex.Try1(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))
+		attackerTemplate := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "example.com"},
+			DNSNames:     []string{"example.com"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		attackerCert := runtimex.Try1(x509.CreateCertificate(
+			rand.Reader, attackerTemplate, attackerTemplate, &attackerKey.PublicKey, attackerKey))
+
+		// create a server sending the attacker certificate followed by the pinned certificate
+		mitm := httptest.NewUnstartedServer(http.NotFoundHandler())
+		mitm.TLS = &tls.Config{
+			Certificates: []tls.Certificate{{
+				Certificate: [][]byte{attackerCert, srvr.Certificate().Raw},
+				PrivateKey:  attackerKey,
+			}},
+		}
+		mitm.StartTLS()
+		defer mitm.Close()
+
+		// define the expectations
+		var testcases = []struct {
+			name    string
+			server  *httptest.Server
+			options []TLSHandshakeOption
+			failure string
+		}{{
+			name:   "with the pinned certificate verified",
+			server: srvr,
+			options: []TLSHandshakeOption{
+				TLSHandshakeOptionX509Certs(certPEM),
+			},
+			failure: "",
+		}, {
+			name:   "with the pinned certificate appended and verification",
+			server: mitm,
+			options: []TLSHandshakeOption{
+				TLSHandshakeOptionX509Certs(certPEM),
+			},
+			failure: netxlite.FailureSSLUnknownAuthority,
+		}, {
+			name:   "with the pinned certificate appended and without verification",
+			server: mitm,
+			options: []TLSHandshakeOption{
+				TLSHandshakeOptionSkipVerify(true),
+			},
+			failure: FailureSSLPinMismatch,
+		}}
+
+		for _, tc := range testcases {
+			t.Run(tc.name, func(t *testing.T) {
+				// create the endpoint
+				URL, err := url.Parse(tc.server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				endpoint := NewValue(&Endpoint{
+					Address: URL.Host,
+					Domain:  "example.com",
+				})
+
+				// create a measurement pipeline
+				options := append([]TLSHandshakeOption{
+					TLSHandshakeOptionSPKIPins(goodPin),
+				}, tc.options...)
+				pipeline := Compose(
+					TCPConnect(),
+					TLSHandshake(options...),
+				)
+
+				// perform the measurement
+				rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+				defer rtx.Close()
+				results := pipeline.Run(context.Background(), rtx, endpoint)
+
+				// make sure the result is correct
+				switch {
+				case tc.failure == "" && results.Error != nil:
+					t.Fatal(results.Error)
+				case tc.failure == "":
+					// nothing
+				case !IsErrTLSHandshake(results.Error):
+					t.Fatal("not an ErrTLSHandshake", results.Error)
+				case results.Error.Error() != tc.failure:
+					t.Fatal("unexpected failure", results.Error.Error())
+				}
+			})
+		}
+	})
+
+	t.Run("we return an exception when using SPKI pins with a ClientHello ID", func(t *testing.T) {
+		// create a measurement pipeline
+		pipeline := TLSHandshake(
+			TLSHandshakeOptionClientHelloID("firefox"),
+			TLSHandshakeOptionSPKIPins(base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))),
+		)
+
+		// create the input
+		input := NewValue(&TCPConnection{
+			Address: "127.0.0.1:443",
+			Domain:  "www.example.com",
+		})
+
+		// perform the measurement
+		rtx := NewMinimalRuntime(log.Log)
+		results := pipeline.Run(context.Background(), rtx, input)
+
+		// make sure the error is correct
+		var conflict *ErrConflictingOptions
+		if !IsErrException(results.Error) || !errors.As(results.Error, &conflict) {
+			t.Fatal("unexpected error", results.Error)
+		}
+	})
+
+	t.Run("we return an exception with invalid SPKI pins", func(t *testing.T) {
+		for _, pin := range []string{"!!!", base64.StdEncoding.EncodeToString([]byte("abc"))} {
+			// create a measurement pipeline
+			pipeline := TLSHandshake(TLSHandshakeOptionSPKIPins(pin))
+
+			// create the input
+			input := NewValue(&TCPConnection{
+				Address: "127.0.0.1:443",
+				Domain:  "www.example.com",
+			})
+
+			// perform the measurement
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, input)
+
+			// make sure the error is an exception
+			if !IsErrException(results.Error) {
+				t.Fatal("not an ErrException", results.Error)
+			}
+		}
+	})
+	t.Run("we can split the ClientHello", func(t *testing.T) {
+		// create a server that completes the handshake
+		srvr := httptest.NewTLSServer(http.NotFoundHandler())
+		defer srvr.Close()
+		URL, err := url.Parse(srvr.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// create the endpoint
+		endpoint := NewValue(&Endpoint{
+			Address: URL.Host,
+			Domain:  "www.example.com",
+		})
+
+		for _, options := range [][]TLSHandshakeOption{{
+			TLSHandshakeOptionClientHelloRecordSplits(16, 64),
+			TLSHandshakeOptionClientHelloSegmentSplits(1, 32),
+		}, {
+			TLSHandshakeOptionClientHelloRecordSplits(-2, 4),
+			TLSHandshakeOptionClientHelloSegmentSplits(0, 2),
+			TLSHandshakeOptionClientHelloSplitsSNI(true),
+		}} {
+			// create a measurement pipeline
+			pipeline := Compose(
+				TCPConnect(),
+				TLSHandshake(append(options, TLSHandshakeOptionSkipVerify(true))...),
+			)
+
+			// perform the measurement
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, endpoint)
+			rtx.Close()
+
+			// make sure the handshake succeeded
+			if results.Error != nil {
+				t.Fatal(results.Error)
+			}
+		}
+	})
+
+	t.Run("we return an exception with invalid ClientHello splits", func(t *testing.T) {
+		for _, option := range []TLSHandshakeOption{
+			TLSHandshakeOptionClientHelloRecordSplits(0),
+			TLSHandshakeOptionClientHelloSegmentSplits(10, 5),
+		} {
+			// create a measurement pipeline
+			pipeline := TLSHandshake(option)
+
+			// create the input
+			input := NewValue(&TCPConnection{
+				Address: "127.0.0.1:443",
+				Domain:  "www.example.com",
+			})
+
+			// perform the measurement
+			rtx := NewMinimalRuntime(log.Log)
+			results := pipeline.Run(context.Background(), rtx, input)
+
+			// make sure the error is an exception
+			if !IsErrException(results.Error) {
+				t.Fatal("not an ErrException", results.Error)
+			}
+		}
+	})
 }
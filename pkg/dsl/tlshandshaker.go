@@ -0,0 +1,83 @@
+package dsl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// newTLSHandshakerCryptoTLS creates a [model.TLSHandshaker] using crypto/tls. We need this
+// handshaker because the one returned by [netxlite.NewTLSHandshakerStdlib] uses a fork of
+// crypto/tls that refuses configs setting fields such as CipherSuites and CurvePreferences.
+//
+// The trace argument is OPTIONAL and, when nil, we use the trace inside the context.
+func newTLSHandshakerCryptoTLS(logger model.DebugLogger, trace model.Trace) model.TLSHandshaker {
+	return &tlsHandshakerCryptoTLS{logger, trace}
+}
+
+type tlsHandshakerCryptoTLS struct {
+	logger model.DebugLogger
+	trace  model.Trace
+}
+
+var (
+	// tlsDefaultCertPoolOnce allows to lazily create the cert pool.
+	tlsDefaultCertPoolOnce sync.Once
+
+	// tlsDefaultCertPoolValue is the cached default Mozilla cert pool.
+	tlsDefaultCertPoolValue *x509.CertPool
+)
+
+// tlsDefaultCertPool returns the cached default Mozilla cert pool.
+func tlsDefaultCertPool() *x509.CertPool {
+	tlsDefaultCertPoolOnce.Do(func() {
+		tlsDefaultCertPoolValue = netxlite.NewMozillaCertPool()
+	})
+	return tlsDefaultCertPoolValue
+}
+
+// Handshake implements model.TLSHandshaker. Like netxlite, we use the default Mozilla
+// cert pool when the config RootCAs is nil, we wrap errors, and we emit trace events.
+func (h *tlsHandshakerCryptoTLS) Handshake(
+	ctx context.Context, conn net.Conn, config *tls.Config) (net.Conn, tls.ConnectionState, error) {
+	if config.RootCAs == nil {
+		config = config.Clone()
+		config.RootCAs = tlsDefaultCertPool()
+	}
+	trace := h.trace
+	if trace == nil {
+		trace = netxlite.ContextTraceOrDefault(ctx)
+	}
+
+	h.logger.Debugf("tls {sni=%s next=%+v}...", config.ServerName, config.NextProtos)
+	remoteAddr := conn.RemoteAddr().String()
+	started := trace.TimeNow()
+	trace.OnTLSHandshakeStart(started, remoteAddr, config)
+
+	tlsConn := tls.Client(conn, config)
+	err := tlsConn.HandshakeContext(ctx)
+	err = netxlite.MaybeNewErrWrapper(netxlite.ClassifyTLSHandshakeError, netxlite.TLSHandshakeOperation, err)
+
+	finished := trace.TimeNow()
+	var state tls.ConnectionState
+	if err == nil {
+		state = tlsConn.ConnectionState()
+	}
+	trace.OnTLSHandshakeDone(started, remoteAddr, config, state, err, finished)
+
+	elapsed := finished.Sub(started).Round(time.Millisecond)
+	if err != nil {
+		h.logger.Debugf("tls {sni=%s next=%+v}... %s in %s", config.ServerName, config.NextProtos, err, elapsed)
+		return nil, tls.ConnectionState{}, err
+	}
+	h.logger.Debugf("tls {sni=%s next=%+v}... ok in %s {next=%s cipher=%s v=%s}",
+		config.ServerName, config.NextProtos, elapsed, state.NegotiatedProtocol,
+		netxlite.TLSCipherSuiteString(state.CipherSuite), netxlite.TLSVersionString(state.Version))
+	return tlsConn, state, nil
+}
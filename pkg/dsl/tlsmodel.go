@@ -4,8 +4,10 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"time"
 
 	"github.com/ooni/probe-engine/pkg/netxlite"
+	utls "gitlab.com/yawning/utls.git"
 )
 
 // TLSConnection is the result of performing a TLS handshake.
@@ -19,6 +21,9 @@ type TLSConnection struct {
 	// Domain is the domain we're using.
 	Domain string
 
+	// State summarizes the state of the TLS connection.
+	State *TLSConnectionState
+
 	// TLSNegotiatedProtocol is the result of the ALPN negotiation.
 	TLSNegotiatedProtocol string
 
@@ -26,6 +31,84 @@ type TLSConnection struct {
 	Trace Trace
 }
 
+// TLSConnectionState summarizes the state of a TLS connection after the handshake.
+type TLSConnectionState struct {
+	// CipherSuite is the negotiated cipher suite (e.g., "TLS_AES_128_GCM_SHA256").
+	CipherSuite string
+
+	// HasOCSPResponse indicates whether the server stapled an OCSP response.
+	HasOCSPResponse bool
+
+	// HasSignedCertificateTimestamps indicates whether the server sent SCTs.
+	HasSignedCertificateTimestamps bool
+
+	// NegotiatedProtocol is the result of the ALPN negotiation.
+	NegotiatedProtocol string
+
+	// PeerCertificates contains the certificates sent by the server, leaf first.
+	PeerCertificates []*x509.Certificate
+
+	// ServerName is the SNI we sent to the server.
+	ServerName string
+
+	// Verified indicates whether the certificate chain is valid for the server name
+	// according to the root CAs we're using, which we check also when we skip the
+	// verification during the handshake.
+	Verified bool
+
+	// VerificationError is the reason why Verified is false, if any.
+	VerificationError string
+
+	// Version is the negotiated TLS version (e.g., "TLSv1.3").
+	Version string
+}
+
+// newTLSConnectionState creates a [*TLSConnectionState] from the state returned by a
+// successful TLS handshake and the config we used for the handshake.
+func newTLSConnectionState(state tls.ConnectionState, config *tls.Config) *TLSConnectionState {
+	out := &TLSConnectionState{
+		CipherSuite:                    netxlite.TLSCipherSuiteString(state.CipherSuite),
+		HasOCSPResponse:                len(state.OCSPResponse) > 0,
+		HasSignedCertificateTimestamps: len(state.SignedCertificateTimestamps) > 0,
+		NegotiatedProtocol:             state.NegotiatedProtocol,
+		PeerCertificates:               state.PeerCertificates,
+		ServerName:                     config.ServerName,
+		Verified:                       false,
+		VerificationError:              "",
+		Version:                        netxlite.TLSVersionString(state.Version),
+	}
+	if _, err := tlsVerifyPeerCertificates(state.PeerCertificates, config); err != nil {
+		out.VerificationError = err.Error()
+		return out
+	}
+	out.Verified = true
+	return out
+}
+
+// tlsVerifyPeerCertificates verifies the peer certificates like crypto/tls would do
+// during the handshake with InsecureSkipVerify set to false and returns the verified chains.
+func tlsVerifyPeerCertificates(certs []*x509.Certificate, config *tls.Config) ([][]*x509.Certificate, error) {
+	if len(certs) <= 0 {
+		return nil, ErrNoPeerCertificates
+	}
+	roots := config.RootCAs
+	if roots == nil {
+		roots = tlsDefaultCertPool()
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	return certs[0].Verify(x509.VerifyOptions{
+		DNSName:       config.ServerName,
+		Intermediates: intermediates,
+		Roots:         roots,
+	})
+}
+
+// ErrNoPeerCertificates indicates that the peer did not send any certificate.
+var ErrNoPeerCertificates = errors.New("dsl: the peer did not send any certificate")
+
 // TLSHandshakeOption is an option for configuring the TLS handshake.
 type TLSHandshakeOption func(config *tlsHandshakeConfig)
 
@@ -33,22 +116,62 @@ type TLSHandshakeOption func(config *tlsHandshakeConfig)
 // setters, and the conversion from config to list of options.
 
 type tlsHandshakeConfig struct {
-	ALPN       []string `json:"alpn,omitempty"`
-	SkipVerify bool     `json:"skip_verify,omitempty"`
-	SNI        string   `json:"sni,omitempty"`
-	X509Certs  []string `json:"x509_certs,omitempty"`
+	ALPN                     []string      `json:"alpn,omitempty"`
+	CipherSuites             []string      `json:"cipher_suites,omitempty"`
+	ClientHelloID            string        `json:"client_hello_id,omitempty"`
+	ClientHelloRecordSplits  []int         `json:"client_hello_record_splits,omitempty"`
+	ClientHelloSegmentSplits []int         `json:"client_hello_segment_splits,omitempty"`
+	ClientHelloSplitsSNI     bool          `json:"client_hello_splits_sni,omitempty"`
+	Curves                   []string      `json:"curves,omitempty"`
+	MaxVersion               string        `json:"max_version,omitempty"`
+	MinVersion               string        `json:"min_version,omitempty"`
+	SkipVerify               bool          `json:"skip_verify,omitempty"`
+	SNI                      string        `json:"sni,omitempty"`
+	SPKIPins                 []string      `json:"spki_pins,omitempty"`
+	Timeout                  time.Duration `json:"timeout,omitempty"`
+	X509Certs                []string      `json:"x509_certs,omitempty"`
 }
 
 func (c *tlsHandshakeConfig) options() (options []TLSHandshakeOption) {
 	if len(c.ALPN) > 0 {
 		options = append(options, TLSHandshakeOptionALPN(c.ALPN...))
 	}
+	if len(c.CipherSuites) > 0 {
+		options = append(options, TLSHandshakeOptionCipherSuites(c.CipherSuites...))
+	}
+	if c.ClientHelloID != "" {
+		options = append(options, TLSHandshakeOptionClientHelloID(c.ClientHelloID))
+	}
+	if len(c.ClientHelloRecordSplits) > 0 {
+		options = append(options, TLSHandshakeOptionClientHelloRecordSplits(c.ClientHelloRecordSplits...))
+	}
+	if len(c.ClientHelloSegmentSplits) > 0 {
+		options = append(options, TLSHandshakeOptionClientHelloSegmentSplits(c.ClientHelloSegmentSplits...))
+	}
+	if c.ClientHelloSplitsSNI {
+		options = append(options, TLSHandshakeOptionClientHelloSplitsSNI(c.ClientHelloSplitsSNI))
+	}
+	if len(c.Curves) > 0 {
+		options = append(options, TLSHandshakeOptionCurves(c.Curves...))
+	}
+	if c.MaxVersion != "" {
+		options = append(options, TLSHandshakeOptionMaxVersion(c.MaxVersion))
+	}
+	if c.MinVersion != "" {
+		options = append(options, TLSHandshakeOptionMinVersion(c.MinVersion))
+	}
 	if c.SkipVerify {
 		options = append(options, TLSHandshakeOptionSkipVerify(c.SkipVerify))
 	}
 	if c.SNI != "" {
 		options = append(options, TLSHandshakeOptionSNI(c.SNI))
 	}
+	if len(c.SPKIPins) > 0 {
+		options = append(options, TLSHandshakeOptionSPKIPins(c.SPKIPins...))
+	}
+	if c.Timeout > 0 {
+		options = append(options, TLSHandshakeOptionTimeout(c.Timeout))
+	}
 	if len(c.X509Certs) > 0 {
 		options = append(options, TLSHandshakeOptionX509Certs(c.X509Certs...))
 	}
@@ -76,9 +199,109 @@ func (config *tlsHandshakeConfig) TLSConfig() (*tls.Config, error) {
 		out.RootCAs = certPool
 	}
 
+	if err := applyTLSConstraints(out, config.MinVersion, config.MaxVersion, config.CipherSuites, config.Curves); err != nil {
+		return nil, err
+	}
+
 	return out, nil
 }
 
+// validateSplits returns an error if the ClientHello splits offsets are invalid. Offsets
+// relative to the SNI may be negative or zero because they may precede the server name.
+func (config *tlsHandshakeConfig) validateSplits() error {
+	for _, offsets := range [][]int{config.ClientHelloRecordSplits, config.ClientHelloSegmentSplits} {
+		for idx, offset := range offsets {
+			if (offset <= 0 && !config.ClientHelloSplitsSNI) || (idx > 0 && offset <= offsets[idx-1]) {
+				return &ErrInvalidSplitOffsets{offsets}
+			}
+		}
+	}
+	return nil
+}
+
+// spkiPinsChains returns the function returning the chains on which we enforce the SPKI pins.
+func (config *tlsHandshakeConfig) spkiPinsChains() spkiPinsChainsFunc {
+	if config.SkipVerify {
+		return spkiPinsLeaf
+	}
+	return spkiPinsVerifiedChains
+}
+
+// needsCryptoTLS returns whether we need to use [Trace.NewTLSHandshakerCryptoTLS] because the
+// config sets fields the handshaker returned by [Trace.NewTLSHandshakerStdlib] does not support,
+// including the VerifyPeerCertificate callback we use to enforce the SPKI pins.
+func (config *tlsHandshakeConfig) needsCryptoTLS() bool {
+	return len(config.CipherSuites) > 0 || len(config.Curves) > 0 || len(config.SPKIPins) > 0
+}
+
+// hasConstraints returns whether the config constrains the TLS versions, cipher suites, or curves.
+func (config *tlsHandshakeConfig) hasConstraints() bool {
+	return len(config.CipherSuites) > 0 || len(config.Curves) > 0 ||
+		config.MinVersion != "" || config.MaxVersion != ""
+}
+
+// applyTLSConstraints sets the TLS versions, cipher suites, and curves of the given config
+// using their names and returns an error if any of the names is not valid.
+func applyTLSConstraints(config *tls.Config, minVersion, maxVersion string, cipherSuites, curves []string) (err error) {
+	if config.MinVersion, err = parseTLSVersion(minVersion); err != nil {
+		return err
+	}
+	if config.MaxVersion, err = parseTLSVersion(maxVersion); err != nil {
+		return err
+	}
+	for _, name := range cipherSuites {
+		id, err := parseTLSCipherSuite(name)
+		if err != nil {
+			return err
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	for _, name := range curves {
+		id, err := parseTLSCurve(name)
+		if err != nil {
+			return err
+		}
+		config.CurvePreferences = append(config.CurvePreferences, id)
+	}
+	return nil
+}
+
+// parseTLSVersion maps a TLS version name (e.g., "TLSv1.3") to the corresponding value. The
+// names are the ones we use in [Observations]. The empty name maps to zero, which means that
+// we use the default value.
+func parseTLSVersion(name string) (uint16, error) {
+	if name == "" {
+		return 0, nil
+	}
+	for _, version := range []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13} {
+		if netxlite.TLSVersionString(version) == name {
+			return version, nil
+		}
+	}
+	return 0, &ErrInvalidTLSVersion{name}
+}
+
+// parseTLSCipherSuite maps a cipher suite name (e.g., "TLS_AES_128_GCM_SHA256") to the
+// corresponding value. We also accept the names of insecure cipher suites.
+func parseTLSCipherSuite(name string) (uint16, error) {
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if suite.Name == name {
+			return suite.ID, nil
+		}
+	}
+	return 0, &ErrInvalidTLSCipherSuite{name}
+}
+
+// parseTLSCurve maps a curve name (e.g., "X25519" or "CurveP256") to the corresponding value.
+func parseTLSCurve(name string) (tls.CurveID, error) {
+	for _, curve := range []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521} {
+		if curve.String() == name {
+			return curve, nil
+		}
+	}
+	return 0, &ErrInvalidTLSCurve{name}
+}
+
 // TLSHandshakeOptionALPN configures the ALPN.
 func TLSHandshakeOptionALPN(value ...string) TLSHandshakeOption {
 	return func(config *tlsHandshakeConfig) {
@@ -86,6 +309,79 @@ func TLSHandshakeOptionALPN(value ...string) TLSHandshakeOption {
 	}
 }
 
+// TLSHandshakeOptionCipherSuites configures the cipher suites to use for TLS 1.0-1.2 using
+// their names (e.g., "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"). Note that Go does not allow to
+// configure the TLS 1.3 cipher suites. By default, we use the Go defaults.
+func TLSHandshakeOptionCipherSuites(value ...string) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.CipherSuites = value
+	}
+}
+
+// TLSHandshakeOptionClientHelloRecordSplits splits the ClientHello into several TLS records. The
+// offsets must be strictly increasing and are relative to the beginning of the ClientHello message
+// (i.e., the payload of the original TLS record) unless you use [TLSHandshakeOptionClientHelloSplitsSNI].
+// We ignore offsets out of range.
+func TLSHandshakeOptionClientHelloRecordSplits(offsets ...int) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.ClientHelloRecordSplits = offsets
+	}
+}
+
+// TLSHandshakeOptionClientHelloSegmentSplits splits the ClientHello into several TCP segments by
+// writing each chunk separately. The offsets must be strictly increasing and are relative to the
+// beginning of the bytes we send, which include the headers of the TLS records. When you also use
+// [TLSHandshakeOptionClientHelloRecordSplits], we split into TCP segments the resulting records. See
+// also [TLSHandshakeOptionClientHelloSplitsSNI].
+func TLSHandshakeOptionClientHelloSegmentSplits(offsets ...int) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.ClientHelloSegmentSplits = offsets
+	}
+}
+
+// TLSHandshakeOptionClientHelloSplitsSNI makes the offsets of [TLSHandshakeOptionClientHelloRecordSplits]
+// and [TLSHandshakeOptionClientHelloSegmentSplits] relative to the first byte of the server name inside
+// the server_name extension, which allows splitting inside the SNI regardless of the size of what precedes
+// it. In this mode, offsets may also be negative or zero and we do not split a ClientHello without SNI.
+func TLSHandshakeOptionClientHelloSplitsSNI(value bool) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.ClientHelloSplitsSNI = value
+	}
+}
+
+// TLSHandshakeOptionCurves configures the elliptic curves to use in order of preference using
+// their names (i.e., "X25519", "CurveP256", "CurveP384", and "CurveP521"). By default, we use
+// the Go defaults.
+func TLSHandshakeOptionCurves(value ...string) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.Curves = value
+	}
+}
+
+// TLSHandshakeOptionMaxVersion configures the maximum TLS version (i.e., "TLSv1", "TLSv1.1",
+// "TLSv1.2", or "TLSv1.3"). By default, we use the Go default.
+func TLSHandshakeOptionMaxVersion(value string) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.MaxVersion = value
+	}
+}
+
+// TLSHandshakeOptionMinVersion configures the minimum TLS version (see
+// [TLSHandshakeOptionMaxVersion]). By default, we use the Go default.
+func TLSHandshakeOptionMinVersion(value string) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.MinVersion = value
+	}
+}
+
+// TLSHandshakeOptionClientHelloID configures the uTLS ClientHello parrot to use. The valid
+// values are "chrome", "firefox", "ios", and "randomized". By default, we use the Go stdlib.
+func TLSHandshakeOptionClientHelloID(value string) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.ClientHelloID = value
+	}
+}
+
 // TLSHandshakeOptionSkipVerify allows to disable certificate verification.
 func TLSHandshakeOptionSkipVerify(value bool) TLSHandshakeOption {
 	return func(config *tlsHandshakeConfig) {
@@ -107,6 +403,51 @@ func TLSHandshakeOptionSNI(value string) TLSHandshakeOption {
 	}
 }
 
+// TLSHandshakeOptionSPKIPins configures the base64-encoded SHA-256 digests of the public keys
+// (SPKI) we expect to find in the verified certificate chains or, when skipping the verification, in
+// the leaf certificate. When we have pins, the handshake fails with [FailureSSLPinMismatch] unless
+// one of these certificates matches a pin. Because uTLS does not allow us to enforce the pins
+// during the handshake, you cannot use this option along with [TLSHandshakeOptionClientHelloID].
+func TLSHandshakeOptionSPKIPins(value ...string) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.SPKIPins = value
+	}
+}
+
+// TLSHandshakeOptionTimeout allows to configure the timeout; the default is 10s.
+func TLSHandshakeOptionTimeout(value time.Duration) TLSHandshakeOption {
+	return func(config *tlsHandshakeConfig) {
+		config.Timeout = value
+	}
+}
+
+// clientHelloIDs maps the valid client_hello_id values to the corresponding uTLS parrots.
+var clientHelloIDs = map[string]*utls.ClientHelloID{
+	"chrome":     &utls.HelloChrome_Auto,
+	"firefox":    &utls.HelloFirefox_Auto,
+	"ios":        &utls.HelloIOS_Auto,
+	"randomized": &utls.HelloRandomized,
+}
+
+// newClientHelloID returns the uTLS parrot corresponding to the given client_hello_id value. This
+// function returns nil when the value is empty, meaning that we should use the Go stdlib, and an
+// [ErrInvalidClientHelloID] when the value is not valid.
+func newClientHelloID(value string) (*utls.ClientHelloID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, found := clientHelloIDs[value]
+	if !found {
+		return nil, &ErrInvalidClientHelloID{value}
+	}
+	return id, nil
+}
+
+// ErrClientHelloIDWithTLSConstraints indicates that we cannot constrain the TLS versions,
+// cipher suites, or curves when using a uTLS ClientHello ID, which defines them.
+var ErrClientHelloIDWithTLSConstraints = errors.New(
+	"dsl: cannot set TLS versions, cipher suites, or curves with client_hello_id")
+
 // ErrTLSHandshake wraps errors occurred during a TLS handshake operation.
 type ErrTLSHandshake struct {
 	Err error
@@ -1,13 +1,44 @@
 package dsl
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/ooni/probe-engine/pkg/model"
+	utls "gitlab.com/yawning/utls.git"
 )
 
 // Trace traces measurement events and produces [Observations].
 type Trace interface {
+	// DNSRoundTrip executes and measures a DNS round trip.
+	//
+	// Arguments:
+	//
+	// - ctx is the context for deadline/cancellation;
+	//
+	// - txp is the DNS transport to use;
+	//
+	// - query is the DNS query to send.
+	//
+	// Return values:
+	//
+	// - resp is the DNS response (which MAY be nil on failure);
+	//
+	// - answers contains the typed answers inside the response;
+	//
+	// - err is the error that occurred (nil on success), which includes the
+	// case where the response Rcode indicates failure and the case where the
+	// response does not contain any answer for the query type.
+	DNSRoundTrip(
+		ctx context.Context,
+		txp model.DNSTransport,
+		query model.DNSQuery,
+	) (
+		resp model.DNSResponse,
+		answers []*DNSAnswer,
+		err error,
+	)
+
 	// ExtractObservations removes and returns the observations saved so far.
 	ExtractObservations() []*Observations
 
@@ -50,18 +81,58 @@ type Trace interface {
 	// NewDialerWithoutResolver creates a dialer not attached to any resolver.
 	NewDialerWithoutResolver() model.Dialer
 
+	// NewParallelDNSOverHTTPSResolver creates a DNS-over-HTTPS resolver resolving A and AAAA in parallel.
+	NewParallelDNSOverHTTPSResolver(URL string) model.Resolver
+
+	// NewParallelDNSOverTCPResolver creates a DNS-over-TCP resolver resolving A and AAAA in parallel.
+	NewParallelDNSOverTCPResolver(endpoint string) model.Resolver
+
+	// NewParallelDNSOverTLSResolver creates a DNS-over-TLS resolver resolving A and AAAA in parallel
+	// and using the given SNI (or the endpoint IP address, if the SNI is empty).
+	NewParallelDNSOverTLSResolver(endpoint, sni string) model.Resolver
+
 	// NewParallelUDPResolver creates an UDP resolver resolving A and AAAA in parallel.
 	NewParallelUDPResolver(endpoint string) model.Resolver
 
-	// NewQUICDialerWithoutResolver creates a QUIC dialer not using any resolver.
-	NewQUICDialerWithoutResolver() model.QUICDialer
+	// NewQUICDialerWithoutResolver creates a QUIC dialer not using any resolver
+	// and using the given listener to create UDP sockets.
+	NewQUICDialerWithoutResolver(listener model.QUICListener) model.QUICDialer
 
 	// NewTLSHandshakerStdlib creates a TLS handshaker using the stdlib.
 	NewTLSHandshakerStdlib() model.TLSHandshaker
 
+	// NewTLSHandshakerCryptoTLS creates a TLS handshaker using crypto/tls, which, unlike the
+	// one returned by NewTLSHandshakerStdlib, supports setting cipher suites and curves.
+	NewTLSHandshakerCryptoTLS() model.TLSHandshaker
+
+	// NewTLSHandshakerUTLS creates a TLS handshaker using uTLS and the given ClientHello ID.
+	NewTLSHandshakerUTLS(id *utls.ClientHelloID) model.TLSHandshaker
+
 	// NewStdlibResolver creates a resolver using the stdlib.
 	NewStdlibResolver() model.Resolver
 
 	// Tags returns the tags configured for the trace.
 	Tags() []string
+
+	// WebSocketHandshake executes and measures a WebSocket opening handshake.
+	//
+	// Arguments:
+	//
+	// - conn is the WebSocket connection to use;
+	//
+	// - request is the HTTP upgrade request.
+	//
+	// Return values:
+	//
+	// - resp is the HTTP response (which MAY be nil on failure);
+	//
+	// - err is the error that occurred (nil on success), which includes the
+	// case where the server does not accept the upgrade.
+	WebSocketHandshake(conn *WebSocketConnection, request *http.Request) (resp *http.Response, err error)
+
+	// WebSocketReadFrame reads and measures a WebSocket frame.
+	WebSocketReadFrame(conn *WebSocketConnection) (*WebSocketFrame, error)
+
+	// WebSocketWriteFrame writes and measures a WebSocket frame.
+	WebSocketWriteFrame(conn *WebSocketConnection, frame *WebSocketFrame) error
 }
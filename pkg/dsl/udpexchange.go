@@ -0,0 +1,162 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// UDPExchange returns a stage that sends the configured payload to a UDP endpoint and then
+// collects all the datagrams we receive from the endpoint until the timeout expires. The
+// [Trace] created by this stage records the I/O as network events.
+//
+// This stage succeeds when we receive at least one datagram. Otherwise, this stage returns
+// an [ErrUDPExchange]. Remember to use the [IsErrUDPExchange] predicate when setting an
+// experiment test keys.
+func UDPExchange(options ...UDPExchangeOption) Stage[*Endpoint, *UDPExchangeResult] {
+	return wrapOperation[*Endpoint, *UDPExchangeResult](&udpExchangeOperation{options})
+}
+
+type udpExchangeOperation struct {
+	options []UDPExchangeOption
+}
+
+const udpExchangeStageName = "udp_exchange"
+
+// ASTNode implements operation.
+func (op *udpExchangeOperation) ASTNode() *SerializableASTNode {
+	var config udpExchangeConfig
+	for _, option := range op.options {
+		option(&config)
+	}
+	return &SerializableASTNode{
+		StageName: udpExchangeStageName,
+		Arguments: &config,
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type udpExchangeLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*udpExchangeLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var config udpExchangeConfig
+	if err := json.Unmarshal(node.Arguments, &config); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := UDPExchange(config.options()...)
+	return &StageRunnableASTNode[*Endpoint, *UDPExchangeResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*udpExchangeLoader) StageName() string {
+	return udpExchangeStageName
+}
+
+// Run implements operation.
+func (op *udpExchangeOperation) Run(ctx context.Context, rtx Runtime, endpoint *Endpoint) (*UDPExchangeResult, error) {
+	// create configuration
+	config := &udpExchangeConfig{
+		Tags:    []string{},
+		Timeout: defaultUDPExchangeTimeout,
+	}
+	for _, option := range op.options {
+		option(config)
+	}
+
+	// obtain the payload or return an exception
+	payload, err := decodeBase64OrText("payload", config.PayloadBase64, config.PayloadText)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+
+	// create trace
+	trace := rtx.NewTrace(endpoint.tags(config.Tags...)...)
+
+	// start the operation logger
+	ol := measurexlite.NewOperationLogger(
+		rtx.Logger(),
+		"[#%d] UDPExchange with %s payloadSize=%d",
+		trace.Index(),
+		endpoint.Address,
+		len(payload),
+	)
+
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(config.Timeout, defaultUDPExchangeTimeout))
+	defer cancel()
+
+	// exchange datagrams
+	datagrams, err := udpExchange(ctx, trace, endpoint.Address, payload, nil)
+
+	// stop the operation logger
+	ol.Stop(err)
+
+	// save observations
+	rtx.SaveObservations(trace.ExtractObservations()...)
+
+	// handle the error case
+	if err != nil {
+		rtx.Metrics().Error(udpExchangeStageName)
+		return nil, &ErrUDPExchange{err}
+	}
+
+	// prepare the return value
+	rtx.Metrics().Success(udpExchangeStageName)
+	out := &UDPExchangeResult{
+		Address:   endpoint.Address,
+		Datagrams: datagrams,
+		Domain:    endpoint.Domain,
+		Trace:     trace,
+	}
+	return out, nil
+}
+
+// udpExchangeMaxDatagramSize is the maximum size of a UDP datagram.
+const udpExchangeMaxDatagramSize = 1 << 16
+
+// udpExchange sends the payload to the given address using a connected UDP socket created using
+// the trace and collects the datagrams we receive until the context is done. When the done
+// function is not nil, we stop collecting datagrams as soon as it returns true. This function
+// fails when we cannot send the payload or we do not receive any datagram.
+func udpExchange(ctx context.Context, trace Trace, address string,
+	payload []byte, done func(datagram []byte) bool) ([][]byte, error) {
+	// create a connected UDP socket
+	conn, err := trace.NewDialerWithoutResolver().DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// make sure reading stops when the context is done
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// send the payload
+	if _, err := conn.Write(payload); err != nil {
+		return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.WriteOperation, err)
+	}
+
+	// collect datagrams
+	var datagrams [][]byte
+	buffer := make([]byte, udpExchangeMaxDatagramSize)
+	for {
+		count, err := conn.Read(buffer)
+		if err != nil {
+			if len(datagrams) > 0 {
+				return datagrams, nil
+			}
+			return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.ReadOperation, err)
+		}
+		datagram := append([]byte{}, buffer[:count]...)
+		datagrams = append(datagrams, datagram)
+		if done != nil && done(datagram) {
+			return datagrams, nil
+		}
+	}
+}
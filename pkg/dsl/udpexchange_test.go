@@ -0,0 +1,90 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestUDPExchange(t *testing.T) {
+	t.Run("we collect all the datagrams", func(t *testing.T) {
+		// create a server that replies twice to each datagram
+		pconn := runtimex.Try1(net.ListenPacket("udp", "127.0.0.1:0"))
+		defer pconn.Close()
+		go func() {
+			buffer := make([]byte, 1024)
+			for {
+				count, addr, err := pconn.ReadFrom(buffer)
+				if err != nil {
+					return
+				}
+				pconn.WriteTo(buffer[:count], addr)
+				pconn.WriteTo([]byte("antani"), addr)
+			}
+		}()
+
+		// serialize and load the pipeline
+		pipeline := UDPExchange(
+			UDPExchangeOptionPayloadText("mascetti"),
+			UDPExchangeOptionTimeout(250*time.Millisecond),
+		)
+		rawAST := runtimex.Try1(json.Marshal(pipeline.ASTNode()))
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+
+		// run the pipeline
+		rtx := NewMeasurexliteRuntime(log.Log, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		endpoint := NewValue(&Endpoint{Address: pconn.LocalAddr().String(), Domain: "www.example.com"})
+		results := runnable.Run(context.Background(), rtx, endpoint.AsGeneric())
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+
+		// make sure we have received both datagrams
+		var datagrams []string
+		for _, datagram := range results.Value.(*UDPExchangeResult).Datagrams {
+			datagrams = append(datagrams, string(datagram))
+		}
+		if diff := cmp.Diff([]string{"mascetti", "antani"}, datagrams); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// make sure we have archived the I/O
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+		var reads, writes int
+		for _, ev := range observations.NetworkEvents {
+			switch {
+			case ev.Operation == netxlite.ReadOperation && ev.Failure == nil:
+				reads++
+			case ev.Operation == netxlite.WriteOperation && ev.Failure == nil:
+				writes++
+			}
+		}
+		if reads != 2 || writes != 1 {
+			t.Fatal("unexpected network events", reads, writes)
+		}
+	})
+
+	t.Run("we fail when we do not receive any datagram", func(t *testing.T) {
+		pconn := runtimex.Try1(net.ListenPacket("udp", "127.0.0.1:0"))
+		defer pconn.Close()
+		pipeline := UDPExchange(
+			UDPExchangeOptionPayloadText("mascetti"),
+			UDPExchangeOptionTimeout(10*time.Millisecond),
+		)
+		rtx := NewMinimalRuntime(log.Log)
+		endpoint := NewValue(&Endpoint{Address: pconn.LocalAddr().String(), Domain: "www.example.com"})
+		results := pipeline.Run(context.Background(), rtx, endpoint)
+		if !IsErrUDPExchange(results.Error) {
+			t.Fatal("not an ErrUDPExchange", results.Error)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package dsl
+
+import (
+	"errors"
+	"time"
+)
+
+// UDPExchangeResult is the result of exchanging datagrams with a UDP endpoint.
+type UDPExchangeResult struct {
+	// Address is the endpoint address we're using.
+	Address string
+
+	// Datagrams contains the datagrams we received in the order in which we received them.
+	Datagrams [][]byte
+
+	// Domain is the domain we're using.
+	Domain string
+
+	// Trace is the trace we're using.
+	Trace Trace
+}
+
+// UDPExchangeOption is an option for configuring [UDPExchange].
+type UDPExchangeOption func(config *udpExchangeConfig)
+
+// TODO(bassosimone): we should probably autogenerate the config, the functional optional
+// setters, and the conversion from config to list of options.
+
+type udpExchangeConfig struct {
+	PayloadBase64 string        `json:"payload_base64,omitempty"`
+	PayloadText   string        `json:"payload_text,omitempty"`
+	Tags          []string      `json:"tags,omitempty"`
+	Timeout       time.Duration `json:"timeout,omitempty"`
+}
+
+func (c *udpExchangeConfig) options() (options []UDPExchangeOption) {
+	if c.PayloadBase64 != "" {
+		options = append(options, UDPExchangeOptionPayloadBase64(c.PayloadBase64))
+	}
+	if c.PayloadText != "" {
+		options = append(options, UDPExchangeOptionPayloadText(c.PayloadText))
+	}
+	if len(c.Tags) > 0 {
+		options = append(options, UDPExchangeOptionTags(c.Tags...))
+	}
+	if c.Timeout > 0 {
+		options = append(options, UDPExchangeOptionTimeout(c.Timeout))
+	}
+	return
+}
+
+// UDPExchangeOptionPayloadBase64 configures the base64 encoded payload to send, which allows
+// sending binary payloads. Setting this option and [UDPExchangeOptionPayloadText] at the same
+// time is an error.
+func UDPExchangeOptionPayloadBase64(value string) UDPExchangeOption {
+	return func(config *udpExchangeConfig) {
+		config.PayloadBase64 = value
+	}
+}
+
+// UDPExchangeOptionPayloadText configures the payload to send using a text string. Setting this
+// option and [UDPExchangeOptionPayloadBase64] at the same time is an error.
+func UDPExchangeOptionPayloadText(value string) UDPExchangeOption {
+	return func(config *udpExchangeConfig) {
+		config.PayloadText = value
+	}
+}
+
+// UDPExchangeOptionTags allows to configure the tags to include into the measurement.
+func UDPExchangeOptionTags(tags ...string) UDPExchangeOption {
+	return func(config *udpExchangeConfig) {
+		config.Tags = append(config.Tags, tags...)
+	}
+}
+
+// UDPExchangeOptionTimeout configures for how long we collect datagrams; the default is 5s.
+func UDPExchangeOptionTimeout(value time.Duration) UDPExchangeOption {
+	return func(config *udpExchangeConfig) {
+		config.Timeout = value
+	}
+}
+
+// STUNBindingResult is the result of a STUN binding request.
+type STUNBindingResult struct {
+	// Address is the STUN server address we're using.
+	Address string
+
+	// Domain is the domain we're using.
+	Domain string
+
+	// MappedAddress is the reflexive transport address returned by the server
+	// (i.e., our address and port as seen by the STUN server).
+	MappedAddress string
+
+	// Trace is the trace we're using.
+	Trace Trace
+}
+
+// STUNBindingRequestOption is an option for [STUNBindingRequest].
+type STUNBindingRequestOption func(operation *stunBindingRequestOperation)
+
+// STUNBindingRequestOptionTags allows configuring tags to include into measurements
+// generated by the [STUNBindingRequest] pipeline stage.
+func STUNBindingRequestOptionTags(tags ...string) STUNBindingRequestOption {
+	return func(operation *stunBindingRequestOperation) {
+		operation.Tags = append(operation.Tags, tags...)
+	}
+}
+
+// STUNBindingRequestOptionTimeout configures the timeout of the [STUNBindingRequest] pipeline
+// stage; the default is 5s.
+func STUNBindingRequestOptionTimeout(value time.Duration) STUNBindingRequestOption {
+	return func(operation *stunBindingRequestOperation) {
+		operation.Timeout = value
+	}
+}
+
+// ErrSTUNInvalidResponse indicates that we did not receive any STUN binding success
+// response containing a mapped address.
+var ErrSTUNInvalidResponse = errors.New("dsl: missing or invalid STUN binding response")
+
+// ErrUDPExchange wraps errors occurred when exchanging datagrams with a UDP endpoint.
+type ErrUDPExchange struct {
+	Err error
+}
+
+// Unwrap supports [errors.Unwrap].
+func (exc *ErrUDPExchange) Unwrap() error {
+	return exc.Err
+}
+
+// Error implements error.
+func (exc *ErrUDPExchange) Error() string {
+	return exc.Err.Error()
+}
+
+// IsErrUDPExchange returns true when an error is an [ErrUDPExchange].
+func IsErrUDPExchange(err error) bool {
+	var exc *ErrUDPExchange
+	return errors.As(err, &exc)
+}
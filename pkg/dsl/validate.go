@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"net/url"
 	"strconv"
 )
 
@@ -37,6 +38,146 @@ func (err *ErrInvalidAddressList) Error() string {
 	return fmt.Sprintf("dsl: invalid address list: %v", err.Addresses)
 }
 
+// ErrInvalidAddressFamily indicates that an address family is invalid.
+type ErrInvalidAddressFamily struct {
+	Family string
+}
+
+// Error implements error.
+func (err *ErrInvalidAddressFamily) Error() string {
+	return fmt.Sprintf("dsl: invalid address family: %s", err.Family)
+}
+
+// ErrInvalidClientHelloID indicates that a uTLS ClientHello ID is invalid.
+type ErrInvalidClientHelloID struct {
+	ID string
+}
+
+// Error implements error.
+func (err *ErrInvalidClientHelloID) Error() string {
+	return fmt.Sprintf("dsl: invalid client hello ID: %s", err.ID)
+}
+
+// ErrInvalidTLSVersion indicates that a TLS version is invalid.
+type ErrInvalidTLSVersion struct {
+	Version string
+}
+
+// Error implements error.
+func (err *ErrInvalidTLSVersion) Error() string {
+	return fmt.Sprintf("dsl: invalid TLS version: %s", err.Version)
+}
+
+// ErrInvalidTLSCipherSuite indicates that a TLS cipher suite is invalid.
+type ErrInvalidTLSCipherSuite struct {
+	CipherSuite string
+}
+
+// Error implements error.
+func (err *ErrInvalidTLSCipherSuite) Error() string {
+	return fmt.Sprintf("dsl: invalid TLS cipher suite: %s", err.CipherSuite)
+}
+
+// ErrInvalidTLSCurve indicates that a TLS curve is invalid.
+type ErrInvalidTLSCurve struct {
+	Curve string
+}
+
+// Error implements error.
+func (err *ErrInvalidTLSCurve) Error() string {
+	return fmt.Sprintf("dsl: invalid TLS curve: %s", err.Curve)
+}
+
+// ErrInvalidSPKIPin indicates that an SPKI pin is not a base64-encoded SHA-256 digest.
+type ErrInvalidSPKIPin struct {
+	Pin string
+}
+
+// Error implements error.
+func (err *ErrInvalidSPKIPin) Error() string {
+	return fmt.Sprintf("dsl: invalid SPKI pin: %s", err.Pin)
+}
+
+// ErrInvalidSplitOffsets indicates that the offsets to split a message are invalid.
+type ErrInvalidSplitOffsets struct {
+	Offsets []int
+}
+
+// Error implements error.
+func (err *ErrInvalidSplitOffsets) Error() string {
+	return fmt.Sprintf("dsl: invalid split offsets: %v", err.Offsets)
+}
+
+// ErrInvalidQUICVersion indicates that a QUIC version is invalid.
+type ErrInvalidQUICVersion struct {
+	Version string
+}
+
+// Error implements error.
+func (err *ErrInvalidQUICVersion) Error() string {
+	return fmt.Sprintf("dsl: invalid QUIC version: %s", err.Version)
+}
+
+// ErrInvalidInitialPacketSize indicates that a QUIC initial packet size is invalid.
+type ErrInvalidInitialPacketSize struct {
+	Size int
+}
+
+// Error implements error.
+func (err *ErrInvalidInitialPacketSize) Error() string {
+	return fmt.Sprintf("dsl: invalid initial packet size: %d", err.Size)
+}
+
+// ErrInvalidMaxBytes indicates that the maximum number of bytes to read is invalid.
+type ErrInvalidMaxBytes struct {
+	MaxBytes int
+}
+
+// Error implements error.
+func (err *ErrInvalidMaxBytes) Error() string {
+	return fmt.Sprintf("dsl: invalid max bytes: %d", err.MaxBytes)
+}
+
+// ErrInvalidBogonsAction indicates that the action to perform with bogons is invalid.
+type ErrInvalidBogonsAction struct {
+	Action string
+}
+
+// Error implements error.
+func (err *ErrInvalidBogonsAction) Error() string {
+	return fmt.Sprintf("dsl: invalid bogons action: %s", err.Action)
+}
+
+// ErrInvalidDNSNetwork indicates that a DNS resolver network is invalid.
+type ErrInvalidDNSNetwork struct {
+	Network string
+}
+
+// Error implements error.
+func (err *ErrInvalidDNSNetwork) Error() string {
+	return fmt.Sprintf("dsl: invalid DNS network: %s", err.Network)
+}
+
+// ErrInvalidDNSQueryType indicates that a DNS query type is invalid.
+type ErrInvalidDNSQueryType struct {
+	QueryType string
+}
+
+// Error implements error.
+func (err *ErrInvalidDNSQueryType) Error() string {
+	return fmt.Sprintf("dsl: invalid DNS query type: %s", err.QueryType)
+}
+
+// ErrInvalidURL indicates that a URL is invalid.
+type ErrInvalidURL struct {
+	URL string
+}
+
+// Error implements error.
+func (err *ErrInvalidURL) Error() string {
+	return fmt.Sprintf("dsl: invalid URL: %s", err.URL)
+}
+
 // ValidDomainNames returns whether the given list of domain names is valid.
 func ValidDomainNames(domains ...string) bool {
 	// TODO(bassosimone): how to validate domains considering IDN?
@@ -100,3 +241,44 @@ func ValidPorts(ports ...string) bool {
 	}
 	return true
 }
+
+// ValidDoHURLs returns whether the given list contains valid DNS-over-HTTPS URLs.
+func ValidDoHURLs(URLs ...string) bool {
+	if len(URLs) <= 0 {
+		return false
+	}
+	for _, entry := range URLs {
+		URL, err := url.Parse(entry)
+		if err != nil {
+			return false
+		}
+		if URL.Scheme != "https" && URL.Scheme != "http" {
+			return false
+		}
+		if URL.Host == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrInvalidHTTPProtocol indicates that an HTTP protocol is invalid.
+type ErrInvalidHTTPProtocol struct {
+	Protocol string
+}
+
+// Error implements error.
+func (err *ErrInvalidHTTPProtocol) Error() string {
+	return fmt.Sprintf("dsl: invalid HTTP protocol: %s", err.Protocol)
+}
+
+// ErrConflictingOptions indicates that two mutually exclusive options are both set.
+type ErrConflictingOptions struct {
+	First  string
+	Second string
+}
+
+// Error implements error.
+func (err *ErrConflictingOptions) Error() string {
+	return fmt.Sprintf("dsl: cannot set both %s and %s", err.First, err.Second)
+}
@@ -0,0 +1,334 @@
+package dsl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// WebSocketExchange returns a stage that performs the WebSocket opening handshake over a TCP
+// connection and then sends the configured messages and reads at most the configured number of
+// data frames. Use this stage to determine whether the upgrade to WebSocket is blocked, which
+// is something that HTTP-level success does not tell us. The [Trace] of the connection records
+// the upgrade as an HTTP request result and each frame we send or receive as a network event
+// whose operation includes the opcode name (e.g., "websocket_write_text").
+//
+// When reading frames, we reply to ping frames and we stop reading when the server sends a close
+// frame, the server closes the connection after we have read at least one data frame, or the
+// timeout expires after we have read at least one data frame. At the end of the exchange, we send a
+// close frame without waiting for the server to reply. Note that we do not reassemble fragmented
+// messages, so each fragment is a distinct frame.
+//
+// This stage returns an [ErrWebSocketExchange] on failure, which wraps [ErrWebSocketUpgradeRejected]
+// when the server does not accept the upgrade. Remember to use the [IsErrWebSocketExchange]
+// predicate when setting an experiment test keys.
+func WebSocketExchange(options ...WebSocketExchangeOption) Stage[*TCPConnection, *WebSocketExchangeResult] {
+	return wrapOperation[*TCPConnection, *WebSocketExchangeResult](&webSocketExchangeOperation{options})
+}
+
+type webSocketExchangeOperation struct {
+	options []WebSocketExchangeOption
+}
+
+const webSocketExchangeStageName = "websocket_exchange"
+
+// ASTNode implements operation.
+func (op *webSocketExchangeOperation) ASTNode() *SerializableASTNode {
+	return &SerializableASTNode{
+		StageName: webSocketExchangeStageName,
+		Arguments: newWebSocketExchangeConfig(op.options...),
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type webSocketExchangeLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*webSocketExchangeLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var config webSocketExchangeConfig
+	if err := json.Unmarshal(node.Arguments, &config); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := WebSocketExchange(config.options()...)
+	return &StageRunnableASTNode[*TCPConnection, *WebSocketExchangeResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*webSocketExchangeLoader) StageName() string {
+	return webSocketExchangeStageName
+}
+
+// Run implements operation.
+func (op *webSocketExchangeOperation) Run(ctx context.Context, rtx Runtime, conn *TCPConnection) (*WebSocketExchangeResult, error) {
+	wsconn := &WebSocketConnection{
+		Address:               conn.Address,
+		Conn:                  conn.Conn,
+		Domain:                conn.Domain,
+		Network:               "tcp",
+		Reader:                bufio.NewReader(conn.Conn),
+		TLSNegotiatedProtocol: "",
+		Trace:                 conn.Trace,
+	}
+	return webSocketExchange(ctx, rtx, webSocketExchangeStageName, "ws", wsconn, op.options...)
+}
+
+// WebSocketExchangeTLS is like [WebSocketExchange] but uses a TLS connection. Because WebSocket
+// requires HTTP/1.1, this stage fails with an error wrapping [ErrHTTPProtocolNotNegotiated] when
+// the TLS handshake negotiated "h2", so you should use [TLSHandshakeOptionALPN] to only offer
+// "http/1.1".
+func WebSocketExchangeTLS(options ...WebSocketExchangeOption) Stage[*TLSConnection, *WebSocketExchangeResult] {
+	return wrapOperation[*TLSConnection, *WebSocketExchangeResult](&webSocketExchangeTLSOperation{options})
+}
+
+type webSocketExchangeTLSOperation struct {
+	options []WebSocketExchangeOption
+}
+
+const webSocketExchangeTLSStageName = "websocket_exchange_tls"
+
+// ASTNode implements operation.
+func (op *webSocketExchangeTLSOperation) ASTNode() *SerializableASTNode {
+	return &SerializableASTNode{
+		StageName: webSocketExchangeTLSStageName,
+		Arguments: newWebSocketExchangeConfig(op.options...),
+		Children:  []*SerializableASTNode{},
+	}
+}
+
+type webSocketExchangeTLSLoader struct{}
+
+// Load implements ASTLoaderRule.
+func (*webSocketExchangeTLSLoader) Load(loader *ASTLoader, node *LoadableASTNode) (RunnableASTNode, error) {
+	var config webSocketExchangeConfig
+	if err := json.Unmarshal(node.Arguments, &config); err != nil {
+		return nil, err
+	}
+	if err := loader.RequireExactlyNumChildren(node, 0); err != nil {
+		return nil, err
+	}
+	stage := WebSocketExchangeTLS(config.options()...)
+	return &StageRunnableASTNode[*TLSConnection, *WebSocketExchangeResult]{stage}, nil
+}
+
+// StageName implements ASTLoaderRule.
+func (*webSocketExchangeTLSLoader) StageName() string {
+	return webSocketExchangeTLSStageName
+}
+
+// Run implements operation.
+func (op *webSocketExchangeTLSOperation) Run(ctx context.Context, rtx Runtime, conn *TLSConnection) (*WebSocketExchangeResult, error) {
+	wsconn := &WebSocketConnection{
+		Address:               conn.Address,
+		Conn:                  conn.Conn,
+		Domain:                conn.Domain,
+		Network:               "tcp",
+		Reader:                bufio.NewReader(conn.Conn),
+		TLSNegotiatedProtocol: conn.TLSNegotiatedProtocol,
+		Trace:                 conn.Trace,
+	}
+	return webSocketExchange(ctx, rtx, webSocketExchangeTLSStageName, "wss", wsconn, op.options...)
+}
+
+// newWebSocketExchangeConfig creates a new config using the given options.
+func newWebSocketExchangeConfig(options ...WebSocketExchangeOption) *webSocketExchangeConfig {
+	config := &webSocketExchangeConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	return config
+}
+
+// webSocketExchange implements [WebSocketExchange] and [WebSocketExchangeTLS].
+func webSocketExchange(ctx context.Context, rtx Runtime, stageName, scheme string,
+	conn *WebSocketConnection, options ...WebSocketExchangeOption) (*WebSocketExchangeResult, error) {
+	// create configuration
+	config := &webSocketExchangeConfig{
+		HostHeader:      conn.Domain,
+		MaxFrames:       0,
+		Messages:        []string{},
+		OriginHeader:    "",
+		Subprotocols:    []string{},
+		Timeout:         defaultWebSocketExchangeTimeout,
+		URLPath:         "/",
+		URLRawQuery:     "",
+		UserAgentHeader: model.HTTPHeaderUserAgent,
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	// setup
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(config.Timeout, defaultWebSocketExchangeTimeout))
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	conn.Conn.SetDeadline(deadline)
+	defer conn.Conn.SetDeadline(time.Time{})
+
+	// create the upgrade request
+	req, err := newWebSocketRequest(ctx, scheme, config)
+	if err != nil {
+		return nil, &ErrException{err}
+	}
+
+	// start the operation logger
+	ol := measurexlite.NewOperationLogger(
+		rtx.Logger(),
+		"[#%d] WebSocketExchange %s with %s host=%s messages=%d maxFrames=%d",
+		conn.Trace.Index(),
+		req.URL.String(),
+		conn.Address,
+		req.Host,
+		len(config.Messages),
+		config.MaxFrames,
+	)
+
+	// perform the exchange unless the TLS handshake negotiated HTTP/2
+	var (
+		resp     *http.Response
+		received []*WebSocketFrame
+	)
+	if conn.TLSNegotiatedProtocol == HTTPProtocolH2 {
+		err = newErrHTTPProtocolNotNegotiated()
+	} else {
+		resp, received, err = webSocketExchangeFrames(conn, req, config)
+	}
+
+	// stop the operation logger
+	ol.Stop(err)
+
+	// save observations
+	rtx.SaveObservations(conn.Trace.ExtractObservations()...)
+
+	// handle the error case
+	if err != nil {
+		rtx.Metrics().Error(stageName)
+		return nil, &ErrWebSocketExchange{err}
+	}
+
+	// prepare the return value
+	rtx.Metrics().Success(stageName)
+	out := &WebSocketExchangeResult{
+		Address:  conn.Address,
+		Domain:   conn.Domain,
+		Received: received,
+		Response: resp,
+		Trace:    conn.Trace,
+	}
+	return out, nil
+}
+
+// newWebSocketRequest creates the HTTP upgrade request.
+func newWebSocketRequest(ctx context.Context, scheme string, config *webSocketExchangeConfig) (*http.Request, error) {
+	URL := &url.URL{
+		Scheme:   scheme,
+		Host:     config.HostHeader,
+		Path:     config.URLPath,
+		RawQuery: config.URLRawQuery,
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", URL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = config.HostHeader
+
+	// req.Header["Host"] is ignored by Go but we want to have it in the measurement
+	// to reflect what we think has been sent as HTTP headers.
+	req.Header.Set("Host", req.Host)
+
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", webSocketNewKey())
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if v := config.OriginHeader; v != "" {
+		req.Header.Set("Origin", v)
+	}
+	if v := config.Subprotocols; len(v) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(v, ", "))
+	}
+	if v := config.UserAgentHeader; v != "" {
+		req.Header.Set("User-Agent", v)
+	}
+	return req, nil
+}
+
+// webSocketCloseTimeout is the timeout for sending the close frame at the end of the exchange.
+const webSocketCloseTimeout = time.Second
+
+// webSocketExchangeFrames performs the handshake, sends the messages, and reads the frames.
+func webSocketExchangeFrames(conn *WebSocketConnection, req *http.Request,
+	config *webSocketExchangeConfig) (*http.Response, []*WebSocketFrame, error) {
+	resp, err := conn.Trace.WebSocketHandshake(conn, req)
+	if err != nil {
+		// when the server rejects the upgrade, we also have a response
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, nil, err
+	}
+
+	// make sure we always attempt to close the WebSocket connection, using a new deadline
+	// because the exchange deadline may have expired while we were reading frames
+	defer func() {
+		conn.Conn.SetDeadline(time.Now().Add(webSocketCloseTimeout))
+		conn.Trace.WebSocketWriteFrame(conn, &WebSocketFrame{
+			Final:   true,
+			Opcode:  WebSocketOpcodeClose,
+			Payload: []byte{0x03, 0xe8}, // 1000 (normal closure)
+		})
+	}()
+
+	for _, message := range config.Messages {
+		frame := &WebSocketFrame{
+			Final:   true,
+			Opcode:  WebSocketOpcodeText,
+			Payload: []byte(message),
+		}
+		if err := conn.Trace.WebSocketWriteFrame(conn, frame); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	received := []*WebSocketFrame{}
+	for len(received) < config.MaxFrames {
+		frame, err := conn.Trace.WebSocketReadFrame(conn)
+		if err != nil {
+			// the peer closing the connection or the timeout expiring after we have
+			// received some frames are normal ways to terminate the exchange
+			if len(received) > 0 && (errors.Is(err, io.EOF) || errors.Is(err, os.ErrDeadlineExceeded)) {
+				break
+			}
+			return nil, nil, err
+		}
+		switch frame.Opcode {
+		case WebSocketOpcodeClose:
+			return resp, received, nil
+		case WebSocketOpcodePing:
+			pong := &WebSocketFrame{
+				Final:   true,
+				Opcode:  WebSocketOpcodePong,
+				Payload: frame.Payload,
+			}
+			if err := conn.Trace.WebSocketWriteFrame(conn, pong); err != nil {
+				return nil, nil, err
+			}
+		case WebSocketOpcodePong:
+			// nothing to do
+		default:
+			received = append(received, frame)
+		}
+	}
+	return resp, received, nil
+}
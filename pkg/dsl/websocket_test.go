@@ -0,0 +1,306 @@
+package dsl
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// webSocketTestReadClientFrame reads a masked frame sent by the client.
+func webSocketTestReadClientFrame(reader *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, nil, err
+	}
+	size := int(header[1] & 0x7f)
+	if size == 126 {
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(reader, extended); err != nil {
+			return 0, nil, err
+		}
+		size = int(binary.BigEndian.Uint16(extended))
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(reader, mask); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for idx := range payload {
+		payload[idx] ^= mask[idx%4]
+	}
+	return header[0] & 0x0f, payload, nil
+}
+
+// webSocketTestHandler is a WebSocket echo server that sends a ping after the upgrade.
+var webSocketTestHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/reject":
+		w.WriteHeader(http.StatusForbidden)
+		return
+	case "/reset":
+		conn, _ := runtimex.Try2(w.(http.Hijacker).Hijack())
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+		return
+	}
+
+	conn, rw := runtimex.Try2(w.(http.Hijacker).Hijack())
+	defer conn.Close()
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n")
+	fmt.Fprintf(rw, "Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	fmt.Fprintf(rw, "Sec-WebSocket-Accept: %s\r\n\r\n", webSocketAcceptKey(r.Header.Get("Sec-WebSocket-Key")))
+
+	if r.URL.Path == "/masked" {
+		rw.Write([]byte{0x81, 0x81, 0, 0, 0, 0, 'a'}) // servers must not mask frames
+		rw.Flush()
+		return
+	}
+
+	rw.Write([]byte{0x89, 0x00}) // ping
+	rw.Flush()
+	for {
+		opcode, payload, err := webSocketTestReadClientFrame(rw.Reader)
+		if err != nil || opcode == WebSocketOpcodeClose {
+			return
+		}
+		if opcode != WebSocketOpcodeText {
+			continue
+		}
+		rw.Write(append([]byte{0x81, byte(len(payload))}, payload...))
+		rw.Flush()
+	}
+})
+
+func TestWebSocketExchange(t *testing.T) {
+	srvr := httptest.NewServer(webSocketTestHandler)
+	defer srvr.Close()
+
+	// measure runs the measurement pipeline using the given options
+	measure := func(rtx Runtime, options ...WebSocketExchangeOption) Maybe[*WebSocketExchangeResult] {
+		pipeline := Compose(TCPConnect(), WebSocketExchange(options...))
+		endpoint := NewValue(&Endpoint{
+			Address: srvr.Listener.Addr().String(),
+			Domain:  "www.example.com",
+		})
+		return pipeline.Run(context.Background(), rtx, endpoint)
+	}
+
+	t.Run("we exchange messages after the upgrade", func(t *testing.T) {
+		results := measure(
+			NewMinimalRuntime(log.Log),
+			WebSocketExchangeOptionMessages("hello", "world"),
+			WebSocketExchangeOptionMaxFrames(2),
+		)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		if results.Value.Response.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatal("unexpected status code", results.Value.Response.StatusCode)
+		}
+		expect := []*WebSocketFrame{{
+			Final:   true,
+			Opcode:  WebSocketOpcodeText,
+			Payload: []byte("hello"),
+		}, {
+			Final:   true,
+			Opcode:  WebSocketOpcodeText,
+			Payload: []byte("world"),
+		}}
+		if diff := cmp.Diff(expect, results.Value.Received); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we archive the upgrade and the frames", func(t *testing.T) {
+		rtx := NewMeasurexliteRuntime(model.DiscardLogger, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		results := measure(
+			rtx,
+			WebSocketExchangeOptionMessages("hello"),
+			WebSocketExchangeOptionMaxFrames(1),
+		)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+
+		if len(observations.Requests) != 1 {
+			t.Fatal("expected a single request entry")
+		}
+		request := observations.Requests[0]
+		if request.Failure != nil || request.Response.Code != http.StatusSwitchingProtocols {
+			t.Fatal("unexpected request entry", request.Failure, request.Response.Code)
+		}
+		if request.Request.URL != "ws://www.example.com/" {
+			t.Fatal("unexpected URL", request.Request.URL)
+		}
+
+		var operations []string
+		for _, ev := range observations.NetworkEvents {
+			if strings.HasPrefix(ev.Operation, "websocket_") {
+				operations = append(operations, ev.Operation)
+			}
+		}
+		expect := []string{
+			"websocket_write_text",
+			"websocket_read_ping",
+			"websocket_write_pong",
+			"websocket_read_text",
+			"websocket_write_close",
+		}
+		if diff := cmp.Diff(expect, operations); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we close the connection when the timeout expires after reading frames", func(t *testing.T) {
+		rtx := NewMeasurexliteRuntime(model.DiscardLogger, &NullMetrics{}, &NullProgressMeter{}, time.Now())
+		results := measure(
+			rtx,
+			WebSocketExchangeOptionMessages("hello"),
+			WebSocketExchangeOptionMaxFrames(2),
+			WebSocketExchangeOptionTimeout(250*time.Millisecond),
+		)
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		if len(results.Value.Received) != 1 {
+			t.Fatal("expected a single frame", results.Value.Received)
+		}
+		observations := ReduceObservations(rtx.ExtractObservations()...)
+
+		var closeEvents int
+		for _, ev := range observations.NetworkEvents {
+			if ev.Operation != "websocket_write_close" {
+				continue
+			}
+			if ev.Failure != nil {
+				t.Fatal("unexpected failure", *ev.Failure)
+			}
+			closeEvents++
+		}
+		if closeEvents != 1 {
+			t.Fatal("expected a single close event", closeEvents)
+		}
+	})
+
+	t.Run("we detect when the server rejects the upgrade", func(t *testing.T) {
+		results := measure(NewMinimalRuntime(log.Log), WebSocketExchangeOptionURLPath("/reject"))
+		if !IsErrWebSocketExchange(results.Error) {
+			t.Fatal("not an ErrWebSocketExchange", results.Error)
+		}
+		if !errors.Is(results.Error, ErrWebSocketUpgradeRejected) {
+			t.Fatal("not an ErrWebSocketUpgradeRejected", results.Error)
+		}
+		var wrapper *netxlite.ErrWrapper
+		if !errors.As(results.Error, &wrapper) || wrapper.Failure != FailureWebSocketUpgradeRejected {
+			t.Fatal("unexpected failure", results.Error)
+		}
+	})
+
+	t.Run("we detect when the server resets the connection", func(t *testing.T) {
+		results := measure(NewMinimalRuntime(log.Log), WebSocketExchangeOptionURLPath("/reset"))
+		if !IsErrWebSocketExchange(results.Error) {
+			t.Fatal("not an ErrWebSocketExchange", results.Error)
+		}
+		var wrapper *netxlite.ErrWrapper
+		if !errors.As(results.Error, &wrapper) || wrapper.Failure != netxlite.FailureConnectionReset {
+			t.Fatal("unexpected failure", results.Error)
+		}
+	})
+
+	t.Run("we reject masked frames sent by the server", func(t *testing.T) {
+		results := measure(
+			NewMinimalRuntime(log.Log),
+			WebSocketExchangeOptionURLPath("/masked"),
+			WebSocketExchangeOptionMaxFrames(1),
+		)
+		var wrapper *netxlite.ErrWrapper
+		if !errors.As(results.Error, &wrapper) || wrapper.Failure != FailureWebSocketInvalidFrame {
+			t.Fatal("unexpected failure", results.Error)
+		}
+	})
+
+	t.Run("we serialize and load the options", func(t *testing.T) {
+		stage := WebSocketExchange(
+			WebSocketExchangeOptionMessages("hello"),
+			WebSocketExchangeOptionMaxFrames(1),
+			WebSocketExchangeOptionSubprotocols("chat"),
+		)
+		rawAST := runtimex.Try1(json.Marshal(stage.ASTNode()))
+		if !strings.Contains(string(rawAST), `"messages":["hello"]`) {
+			t.Fatal("unexpected AST", string(rawAST))
+		}
+		var loadable LoadableASTNode
+		runtimex.Try0(json.Unmarshal(rawAST, &loadable))
+		runnable := runtimex.Try1(NewASTLoader().Load(&loadable))
+		if diff := cmp.Diff(rawAST, runtimex.Try1(json.Marshal(runnable.ASTNode()))); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestWebSocketExchangeTLS(t *testing.T) {
+	srvr := httptest.NewUnstartedServer(webSocketTestHandler)
+	srvr.EnableHTTP2 = true
+	srvr.StartTLS()
+	defer srvr.Close()
+
+	// measure runs the measurement pipeline using the given ALPN
+	measure := func(alpn ...string) Maybe[*WebSocketExchangeResult] {
+		pipeline := Compose3(
+			TCPConnect(),
+			TLSHandshake(
+				TLSHandshakeOptionALPN(alpn...),
+				TLSHandshakeOptionSkipVerify(true),
+			),
+			WebSocketExchangeTLS(
+				WebSocketExchangeOptionMessages("hello"),
+				WebSocketExchangeOptionMaxFrames(1),
+			),
+		)
+		endpoint := NewValue(&Endpoint{
+			Address: srvr.Listener.Addr().String(),
+			Domain:  "www.example.com",
+		})
+		return pipeline.Run(context.Background(), NewMinimalRuntime(log.Log), endpoint)
+	}
+
+	t.Run("we exchange messages when using HTTP/1.1", func(t *testing.T) {
+		results := measure("http/1.1")
+		if results.Error != nil {
+			t.Fatal(results.Error)
+		}
+		if len(results.Value.Received) != 1 || string(results.Value.Received[0].Payload) != "hello" {
+			t.Fatal("unexpected received frames", results.Value.Received)
+		}
+	})
+
+	t.Run("we fail when the TLS handshake negotiates h2", func(t *testing.T) {
+		results := measure("h2", "http/1.1")
+		if !IsErrWebSocketExchange(results.Error) {
+			t.Fatal("not an ErrWebSocketExchange", results.Error)
+		}
+		if !errors.Is(results.Error, ErrHTTPProtocolNotNegotiated) {
+			t.Fatal("not an ErrHTTPProtocolNotNegotiated", results.Error)
+		}
+	})
+}
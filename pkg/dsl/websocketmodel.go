@@ -0,0 +1,232 @@
+package dsl
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// WebSocketConnection is a TCP or TLS connection over which we speak the WebSocket protocol.
+type WebSocketConnection struct {
+	// Address is the endpoint address we're using.
+	Address string
+
+	// Conn is the underlying TCP or TLS connection.
+	Conn net.Conn
+
+	// Domain is the domain we're using.
+	Domain string
+
+	// Network is the underlying conn network (i.e., "tcp").
+	Network string
+
+	// Reader buffers the bytes read from Conn.
+	Reader *bufio.Reader
+
+	// TLSNegotiatedProtocol is the OPTIONAL negotiated protocol (e.g., "http/1.1").
+	TLSNegotiatedProtocol string
+
+	// Trace is the trace we're using.
+	Trace Trace
+}
+
+// These are the WebSocket opcodes defined by RFC 6455.
+const (
+	WebSocketOpcodeContinuation = 0x0
+	WebSocketOpcodeText         = 0x1
+	WebSocketOpcodeBinary       = 0x2
+	WebSocketOpcodeClose        = 0x8
+	WebSocketOpcodePing         = 0x9
+	WebSocketOpcodePong         = 0xa
+)
+
+// WebSocketFrame is a WebSocket frame.
+type WebSocketFrame struct {
+	// Final indicates whether this is the final fragment of a message.
+	Final bool
+
+	// Opcode is the frame opcode (e.g., [WebSocketOpcodeText]).
+	Opcode int
+
+	// Payload contains the unmasked payload.
+	Payload []byte
+}
+
+// WebSocketExchangeResult is the result of [WebSocketExchange] and [WebSocketExchangeTLS].
+type WebSocketExchangeResult struct {
+	// Address is the endpoint address we're using.
+	Address string
+
+	// Domain is the domain we're using.
+	Domain string
+
+	// Received contains the data frames we received.
+	Received []*WebSocketFrame
+
+	// Response is the response to the HTTP upgrade request.
+	Response *http.Response
+
+	// Trace is the trace we're using.
+	Trace Trace
+}
+
+// ErrWebSocketExchange wraps errors occurred when performing a WebSocket exchange.
+type ErrWebSocketExchange struct {
+	Err error
+}
+
+// Unwrap supports [errors.Unwrap].
+func (exc *ErrWebSocketExchange) Unwrap() error {
+	return exc.Err
+}
+
+// Error implements error.
+func (exc *ErrWebSocketExchange) Error() string {
+	return exc.Err.Error()
+}
+
+// IsErrWebSocketExchange returns true when an error is an [ErrWebSocketExchange].
+func IsErrWebSocketExchange(err error) bool {
+	var exc *ErrWebSocketExchange
+	return errors.As(err, &exc)
+}
+
+// FailureWebSocketUpgradeRejected is the failure string we use when the server does not
+// accept the WebSocket upgrade (e.g., because it does not reply with 101).
+const FailureWebSocketUpgradeRejected = "websocket_upgrade_rejected"
+
+// ErrWebSocketUpgradeRejected indicates that the server did not accept the WebSocket upgrade.
+var ErrWebSocketUpgradeRejected = errors.New("dsl: the server did not accept the WebSocket upgrade")
+
+// FailureWebSocketInvalidFrame is the failure string we use when we receive an invalid frame.
+const FailureWebSocketInvalidFrame = "websocket_invalid_frame"
+
+// ErrWebSocketInvalidFrame indicates that we received an invalid WebSocket frame.
+var ErrWebSocketInvalidFrame = errors.New("dsl: invalid WebSocket frame")
+
+// newErrWebSocket wraps the given error using a [*netxlite.ErrWrapper] with the
+// given failure string and operation.
+func newErrWebSocket(failure, operation string, err error) error {
+	classifier := func(error) string {
+		return failure
+	}
+	return netxlite.NewErrWrapper(classifier, operation, err)
+}
+
+// WebSocketExchangeOption is an option for configuring [WebSocketExchange] and [WebSocketExchangeTLS].
+type WebSocketExchangeOption func(config *webSocketExchangeConfig)
+
+// TODO(bassosimone): we should probably autogenerate the config, the functional optional
+// setters, and the conversion from config to list of options.
+
+type webSocketExchangeConfig struct {
+	HostHeader      string        `json:"host_header,omitempty"`
+	MaxFrames       int           `json:"max_frames,omitempty"`
+	Messages        []string      `json:"messages,omitempty"`
+	OriginHeader    string        `json:"origin_header,omitempty"`
+	Subprotocols    []string      `json:"subprotocols,omitempty"`
+	Timeout         time.Duration `json:"timeout,omitempty"`
+	URLPath         string        `json:"url_path,omitempty"`
+	URLRawQuery     string        `json:"url_raw_query,omitempty"`
+	UserAgentHeader string        `json:"user_agent_header,omitempty"`
+}
+
+func (c *webSocketExchangeConfig) options() (options []WebSocketExchangeOption) {
+	if c.HostHeader != "" {
+		options = append(options, WebSocketExchangeOptionHost(c.HostHeader))
+	}
+	if c.MaxFrames > 0 {
+		options = append(options, WebSocketExchangeOptionMaxFrames(c.MaxFrames))
+	}
+	if len(c.Messages) > 0 {
+		options = append(options, WebSocketExchangeOptionMessages(c.Messages...))
+	}
+	if c.OriginHeader != "" {
+		options = append(options, WebSocketExchangeOptionOrigin(c.OriginHeader))
+	}
+	if len(c.Subprotocols) > 0 {
+		options = append(options, WebSocketExchangeOptionSubprotocols(c.Subprotocols...))
+	}
+	if c.Timeout > 0 {
+		options = append(options, WebSocketExchangeOptionTimeout(c.Timeout))
+	}
+	if c.URLPath != "" {
+		options = append(options, WebSocketExchangeOptionURLPath(c.URLPath))
+	}
+	if c.URLRawQuery != "" {
+		options = append(options, WebSocketExchangeOptionURLRawQuery(c.URLRawQuery))
+	}
+	if c.UserAgentHeader != "" {
+		options = append(options, WebSocketExchangeOptionUserAgent(c.UserAgentHeader))
+	}
+	return
+}
+
+// WebSocketExchangeOptionHost sets the Host header; the default is the domain we're using.
+func WebSocketExchangeOptionHost(value string) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.HostHeader = value
+	}
+}
+
+// WebSocketExchangeOptionMaxFrames configures the number of data frames to read after sending
+// the messages. By default, we do not read any frame.
+func WebSocketExchangeOptionMaxFrames(value int) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.MaxFrames = value
+	}
+}
+
+// WebSocketExchangeOptionMessages configures the text messages to send after the upgrade,
+// each of which we send as a single frame. By default, we do not send any message.
+func WebSocketExchangeOptionMessages(value ...string) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.Messages = value
+	}
+}
+
+// WebSocketExchangeOptionOrigin sets the Origin header, which some servers require.
+func WebSocketExchangeOptionOrigin(value string) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.OriginHeader = value
+	}
+}
+
+// WebSocketExchangeOptionSubprotocols sets the Sec-WebSocket-Protocol header.
+func WebSocketExchangeOptionSubprotocols(value ...string) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.Subprotocols = value
+	}
+}
+
+// WebSocketExchangeOptionTimeout allows to configure the timeout; the default is 10s.
+func WebSocketExchangeOptionTimeout(value time.Duration) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.Timeout = value
+	}
+}
+
+// WebSocketExchangeOptionURLPath sets the URL path; the default is "/".
+func WebSocketExchangeOptionURLPath(value string) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.URLPath = value
+	}
+}
+
+// WebSocketExchangeOptionURLRawQuery sets the URL raw query; the default is empty.
+func WebSocketExchangeOptionURLRawQuery(value string) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.URLRawQuery = value
+	}
+}
+
+// WebSocketExchangeOptionUserAgent sets the User-Agent header.
+func WebSocketExchangeOptionUserAgent(value string) WebSocketExchangeOption {
+	return func(config *webSocketExchangeConfig) {
+		config.UserAgentHeader = value
+	}
+}
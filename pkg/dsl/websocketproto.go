@@ -0,0 +1,171 @@
+package dsl
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// webSocketGUID is the GUID we use to compute the Sec-WebSocket-Accept header (see RFC 6455).
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// webSocketMaxPayloadSize is the maximum payload size of the frames we're willing to read.
+const webSocketMaxPayloadSize = 1 << 20
+
+// webSocketNewKey returns a new random Sec-WebSocket-Key header value.
+func webSocketNewKey() string {
+	key := make([]byte, 16)
+	runtimex.Try1(rand.Read(key))
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// webSocketAcceptKey returns the Sec-WebSocket-Accept header value for the given key.
+func webSocketAcceptKey(key string) string {
+	digest := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// webSocketHandshake sends the upgrade request and reads the response. When the server
+// does not accept the upgrade, this function returns both the response and an error.
+func webSocketHandshake(conn *WebSocketConnection, req *http.Request) (*http.Response, error) {
+	if err := req.Write(conn.Conn); err != nil {
+		return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.HTTPRoundTripOperation, err)
+	}
+	resp, err := http.ReadResponse(conn.Reader, req)
+	if err != nil {
+		return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.HTTPRoundTripOperation, err)
+	}
+	if err := webSocketValidateResponse(req, resp); err != nil {
+		return resp, newErrWebSocket(FailureWebSocketUpgradeRejected, netxlite.HTTPRoundTripOperation, err)
+	}
+	return resp, nil
+}
+
+// webSocketValidateResponse ensures that the response accepts the upgrade.
+func webSocketValidateResponse(req *http.Request, resp *http.Response) error {
+	switch {
+	case resp.StatusCode != http.StatusSwitchingProtocols:
+		return fmt.Errorf("%w: unexpected status code %d", ErrWebSocketUpgradeRejected, resp.StatusCode)
+	case !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket"):
+		return fmt.Errorf("%w: invalid Upgrade header", ErrWebSocketUpgradeRejected)
+	case !webSocketHasToken(resp.Header.Values("Connection"), "upgrade"):
+		return fmt.Errorf("%w: invalid Connection header", ErrWebSocketUpgradeRejected)
+	case resp.Header.Get("Sec-WebSocket-Accept") != webSocketAcceptKey(req.Header.Get("Sec-WebSocket-Key")):
+		return fmt.Errorf("%w: invalid Sec-WebSocket-Accept header", ErrWebSocketUpgradeRejected)
+	default:
+		return nil
+	}
+}
+
+// webSocketHasToken returns whether the comma separated header values contain the given token.
+func webSocketHasToken(values []string, token string) bool {
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(entry), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// webSocketWriteFrame writes a masked frame, as required for frames sent by clients.
+func webSocketWriteFrame(conn *WebSocketConnection, frame *WebSocketFrame) error {
+	header := []byte{byte(frame.Opcode & 0x0f)}
+	if frame.Final {
+		header[0] |= 0x80
+	}
+	switch size := len(frame.Payload); {
+	case size < 126:
+		header = append(header, 0x80|byte(size))
+	case size <= 0xffff:
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(size))
+	default:
+		header = append(header, 0x80|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(size))
+	}
+	mask := make([]byte, 4)
+	runtimex.Try1(rand.Read(mask))
+	data := append(header, mask...)
+	for idx, value := range frame.Payload {
+		data = append(data, value^mask[idx%4])
+	}
+	if _, err := conn.Conn.Write(data); err != nil {
+		return netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.WriteOperation, err)
+	}
+	return nil
+}
+
+// webSocketReadFrame reads a frame, which must not be masked because it comes from the server.
+func webSocketReadFrame(conn *WebSocketConnection) (*WebSocketFrame, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn.Reader, header); err != nil {
+		return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.ReadOperation, err)
+	}
+	if header[0]&0x70 != 0 {
+		err := fmt.Errorf("%w: reserved bits set", ErrWebSocketInvalidFrame)
+		return nil, newErrWebSocket(FailureWebSocketInvalidFrame, netxlite.ReadOperation, err)
+	}
+	if header[1]&0x80 != 0 {
+		err := fmt.Errorf("%w: masked frame", ErrWebSocketInvalidFrame)
+		return nil, newErrWebSocket(FailureWebSocketInvalidFrame, netxlite.ReadOperation, err)
+	}
+	size := uint64(header[1] & 0x7f)
+	if size >= 126 {
+		extended := make([]byte, 2)
+		if size == 127 {
+			extended = make([]byte, 8)
+		}
+		if _, err := io.ReadFull(conn.Reader, extended); err != nil {
+			return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.ReadOperation, err)
+		}
+		size = uint64(binary.BigEndian.Uint16(extended[len(extended)-2:]))
+		if len(extended) == 8 {
+			size = binary.BigEndian.Uint64(extended)
+		}
+	}
+	if size > webSocketMaxPayloadSize {
+		err := fmt.Errorf("%w: payload too large", ErrWebSocketInvalidFrame)
+		return nil, newErrWebSocket(FailureWebSocketInvalidFrame, netxlite.ReadOperation, err)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(conn.Reader, payload); err != nil {
+		return nil, netxlite.NewErrWrapper(netxlite.ClassifyGenericError, netxlite.ReadOperation, err)
+	}
+	frame := &WebSocketFrame{
+		Final:   header[0]&0x80 != 0,
+		Opcode:  int(header[0] & 0x0f),
+		Payload: payload,
+	}
+	return frame, nil
+}
+
+// webSocketOpcodeNames maps opcodes to the names we use for network events.
+var webSocketOpcodeNames = map[int]string{
+	WebSocketOpcodeContinuation: "continuation",
+	WebSocketOpcodeText:         "text",
+	WebSocketOpcodeBinary:       "binary",
+	WebSocketOpcodeClose:        "close",
+	WebSocketOpcodePing:         "ping",
+	WebSocketOpcodePong:         "pong",
+}
+
+// webSocketFrameOperation returns the network event operation for reading or writing the
+// given frame (e.g., "websocket_read_text"). When the frame is nil, because reading
+// failed, or the opcode is unknown, we use "frame" instead of the opcode name.
+func webSocketFrameOperation(direction string, frame *WebSocketFrame) string {
+	name := "frame"
+	if frame != nil && webSocketOpcodeNames[frame.Opcode] != "" {
+		name = webSocketOpcodeNames[frame.Opcode]
+	}
+	return fmt.Sprintf("websocket_%s_%s", direction, name)
+}
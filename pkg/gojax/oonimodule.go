@@ -17,7 +17,29 @@ func (vm *VM) newModuleOONI(gojaVM *goja.Runtime, mod *goja.Object) {
 	exports.Set("runDSL", vm.ooniRunDSL)
 }
 
-func (vm *VM) ooniRunDSL(jsAST *goja.Object, zeroTime time.Time) (map[string]any, error) {
+// ooniRunDSLOptions contains the OPTIONAL options for ooniRunDSL.
+type ooniRunDSLOptions struct {
+	// ConcurrencyBudget is the OPTIONAL maximum number of workers that all the
+	// parallel stages run concurrently. By default, there is no limit.
+	ConcurrencyBudget int64
+
+	// Timeout is the OPTIONAL overall timeout in nanoseconds. When the timeout
+	// expires, the stages that did not run yet are skipped.
+	Timeout int64
+}
+
+func (vm *VM) ooniRunDSL(jsAST *goja.Object, zeroTime time.Time, jsOptions *goja.Object) (map[string]any, error) {
+	// parse the OPTIONAL options
+	var options ooniRunDSLOptions
+	if jsOptions != nil {
+		if value := jsOptions.Get("concurrency_budget"); value != nil {
+			options.ConcurrencyBudget = value.ToInteger()
+		}
+		if value := jsOptions.Get("timeout"); value != nil {
+			options.Timeout = value.ToInteger()
+		}
+	}
+
 	// serialize the incoming JS object
 	rawAST, err := jsAST.MarshalJSON()
 	if err != nil {
@@ -42,11 +64,25 @@ func (vm *VM) ooniRunDSL(jsAST *goja.Object, zeroTime time.Time) (map[string]any
 	// create the runtime objects required for interpreting a DSL
 	metrics := dsl.NewAccountingMetrics()
 	progressMeter := &dsl.NullProgressMeter{}
-	rtx := dsl.NewMeasurexliteRuntime(vm.logger, metrics, progressMeter, zeroTime)
+	rtx := dsl.NewMeasurexliteRuntime(
+		vm.logger,
+		metrics,
+		progressMeter,
+		zeroTime,
+		dsl.RuntimeOptionConcurrencyBudget(int(options.ConcurrencyBudget)),
+	)
 	input := dsl.NewValue(&dsl.Void{}).AsGeneric()
 
+	// honour the OPTIONAL overall timeout
+	ctx := context.Background()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(options.Timeout))
+		defer cancel()
+	}
+
 	// interpret the DSL and correctly route exceptions
-	if err := dsl.Try(runnableAST.Run(context.Background(), rtx, input)); err != nil {
+	if err := dsl.Try(runnableAST.Run(ctx, rtx, input)); err != nil {
 		return nil, err
 	}
 